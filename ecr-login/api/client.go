@@ -29,6 +29,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
 )
 
@@ -37,6 +38,10 @@ const (
 	programName            = "docker-credential-ecr-login"
 	ecrPublicName          = "public.ecr.aws"
 	ecrPublicDualStackName = "ecr-public.aws.com"
+
+	// maxRegistryIDsPerRequest is the largest number of registry IDs accepted
+	// by a single ECR.GetAuthorizationToken call.
+	maxRegistryIDsPerRequest = 10
 )
 
 var ecrPattern = regexp.MustCompile(`^(\d{12})\.dkr[\.\-]ecr(\-fips)?\.([a-zA-Z0-9][a-zA-Z0-9-_]*)\.(amazonaws\.(?:com(?:\.cn)?|eu)|on\.(?:aws|amazonwebservices\.com\.cn)|sc2s\.sgov\.gov|c2s\.ic\.gov|cloud\.adc-e\.uk|csp\.hci\.ic\.gov)$`)
@@ -55,6 +60,9 @@ type Registry struct {
 	FIPS    bool
 	Region  string
 	Name    string
+	// Alias is the custom hostname the registry was requested with, when it
+	// is reached through an alias rather than its own endpoint.
+	Alias string
 }
 
 // ExtractRegistry returns the ECR registry behind a given service endpoint
@@ -73,9 +81,9 @@ func ExtractRegistry(input string) (*Registry, error) {
 	}
 	matches := ecrPattern.FindStringSubmatch(serverURL.Hostname())
 	if len(matches) == 0 {
-		return nil, fmt.Errorf(programName + " can only be used with Amazon Elastic Container Registry.")
+		return nil, fmt.Errorf("%w: %s can only be used with Amazon Elastic Container Registry", ErrUnsupportedHost, programName)
 	} else if len(matches) < 3 {
-		return nil, fmt.Errorf("%q is not a valid repository URI for Amazon Elastic Container Registry.", input)
+		return nil, fmt.Errorf("%w: %q is not a valid repository URI for Amazon Elastic Container Registry", ErrUnsupportedHost, input)
 	}
 	return &Registry{
 		Service: ServiceECR,
@@ -89,6 +97,7 @@ func ExtractRegistry(input string) (*Registry, error) {
 type Client interface {
 	GetCredentials(ctx context.Context, serverURL string) (*Auth, error)
 	GetCredentialsByRegistryID(ctx context.Context, registryID string) (*Auth, error)
+	GetCredentialsByRegistryIDs(ctx context.Context, registryIDs []string) ([]RegistryCredentials, error)
 	ListCredentials(ctx context.Context) ([]*Auth, error)
 }
 
@@ -97,12 +106,57 @@ type Auth struct {
 	ProxyEndpoint string
 	Username      string
 	Password      string
+	// ExpiresAt is when the token backing these credentials expires.
+	ExpiresAt time.Time
+}
+
+// RegistryCredentials are the credentials of a registry returned by
+// GetCredentialsByRegistryIDs, or the error that prevented getting them.
+type RegistryCredentials struct {
+	RegistryID string
+	Auth       *Auth
+	Err        error
+}
+
+// ForAlias returns a copy of the credentials whose proxy endpoint is alias, a
+// custom hostname of the registry.
+func (a *Auth) ForAlias(alias string) *Auth {
+	aliasAuth := *a
+	aliasAuth.ProxyEndpoint = proxyEndpointScheme + alias
+	return &aliasAuth
+}
+
+// CredentialsInvalidator is implemented by clients that cache credentials, to
+// remove the cached credentials of a registry so that they are requested again.
+type CredentialsInvalidator interface {
+	InvalidateCredentials(registry *Registry)
 }
 
 type defaultClient struct {
 	ecrClient       ECRAPI
 	ecrPublicClient ECRPublicAPI
 	credentialCache cache.CredentialsCache
+	refreshPolicy   cache.RefreshPolicy
+	// clock tells the time tokens are requested and checked at, and defaults
+	// to the system clock
+	clock clock.Clock
+	// resolver finds the registry behind the server URLs passed to
+	// GetCredentials, and defaults to DefaultRegistryResolver
+	resolver RegistryResolver
+	// publicCacheName is the name ECR Public tokens are cached under when
+	// they are not obtained from the default region and endpoint
+	publicCacheName string
+	// timeout, when set, is the deadline of each GetAuthorizationToken call,
+	// including its retries
+	timeout time.Duration
+	// requests, when set, coalesces the concurrent token requests for the
+	// same registry, region and credentials
+	requests *requestGroup
+	// region, identity and credentials scope the coalesced requests. The
+	// access key ID of credentials is used when identity is empty
+	region      string
+	identity    string
+	credentials aws.CredentialsProvider
 }
 
 type ECRAPI interface {
@@ -163,9 +217,13 @@ func (w *ecrPublicClientWrapper) GetAuthorizationToken(ctx context.Context, inpu
 	return output, sanitizeURLError(err)
 }
 
+func (c *defaultClient) currentTime() time.Time {
+	return clock.OrSystem(c.clock).Now()
+}
+
 // GetCredentials returns username, password, and proxyEndpoint
 func (c *defaultClient) GetCredentials(ctx context.Context, serverURL string) (*Auth, error) {
-	registry, err := ExtractRegistry(serverURL)
+	registry, err := ResolverOrDefault(c.resolver).ResolveRegistry(serverURL)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +236,11 @@ func (c *defaultClient) GetCredentials(ctx context.Context, serverURL string) (*
 		Debug("Retrieving credentials")
 	switch registry.Service {
 	case ServiceECR:
-		return c.GetCredentialsByRegistryID(ctx, registry.ID)
+		auth, err := c.GetCredentialsByRegistryID(ctx, registry.ID)
+		if err != nil || registry.Alias == "" {
+			return auth, err
+		}
+		return auth.ForAlias(registry.Alias), nil
 	case ServiceECRPublic:
 		return c.GetPublicCredentials(ctx, registry.Name)
 	}
@@ -189,9 +251,9 @@ func (c *defaultClient) GetCredentials(ctx context.Context, serverURL string) (*
 func (c *defaultClient) GetCredentialsByRegistryID(ctx context.Context, registryID string) (*Auth, error) {
 	cachedEntry := c.credentialCache.Get(registryID)
 	if cachedEntry != nil {
-		if cachedEntry.IsValid(time.Now()) {
+		if c.refreshPolicy.IsValid(cachedEntry, c.currentTime()) {
 			logrus.WithField("registry", registryID).Debug("Using cached token")
-			return extractToken(cachedEntry.AuthorizationToken, cachedEntry.ProxyEndpoint)
+			return AuthFromEntry(cachedEntry)
 		}
 		logrus.
 			WithField("requestedAt", cachedEntry.RequestedAt).
@@ -199,24 +261,132 @@ func (c *defaultClient) GetCredentialsByRegistryID(ctx context.Context, registry
 			Debug("Cached token is no longer valid")
 	}
 
-	auth, err := c.getAuthorizationToken(ctx, registryID)
+	auth, err := c.coalescedAuthorizationToken(ctx, registryID)
 
 	// if we have a cached token, fall back to avoid failing the request. This may result an expired token
 	// being returned, but if there is a 500 or timeout from the service side, we'd like to attempt to re-use an
 	// old token. We invalidate tokens prior to their expiration date to help mitigate this scenario.
 	if err != nil && cachedEntry != nil {
 		logrus.WithError(err).Info("Got error fetching authorization token. Falling back to cached token.")
-		return extractToken(cachedEntry.AuthorizationToken, cachedEntry.ProxyEndpoint)
+		return AuthFromEntry(cachedEntry)
 	}
 	return auth, err
 }
 
+// GetCredentialsByRegistryIDs returns the credentials of each of
+// registryIDs, in the same order. The registries whose tokens are not cached
+// are requested together, in as few ECR.GetAuthorizationToken calls as the
+// API allows. When a request fails, the cached tokens that have not expired
+// yet are returned instead. The error joins those of the registries whose
+// credentials could not be retrieved, which are also set in their
+// RegistryCredentials.
+func (c *defaultClient) GetCredentialsByRegistryIDs(ctx context.Context, registryIDs []string) ([]RegistryCredentials, error) {
+	results := make([]RegistryCredentials, len(registryIDs))
+	cachedEntries := map[string]*cache.AuthEntry{}
+	var missing []string
+	for i, registryID := range registryIDs {
+		results[i].RegistryID = registryID
+		if registryID == "" {
+			results[i].Auth, results[i].Err = c.GetCredentialsByRegistryID(ctx, registryID)
+			continue
+		}
+		if _, ok := cachedEntries[registryID]; ok {
+			continue
+		}
+		cachedEntry := c.credentialCache.Get(registryID)
+		if cachedEntry != nil && c.refreshPolicy.IsValid(cachedEntry, c.currentTime()) {
+			logrus.WithField("registry", registryID).Debug("Using cached token")
+			results[i].Auth, results[i].Err = AuthFromEntry(cachedEntry)
+			continue
+		}
+		cachedEntries[registryID] = cachedEntry
+		missing = append(missing, registryID)
+	}
+
+	fetched := map[string]*Auth{}
+	fetchErrs := map[string]error{}
+	for len(missing) > 0 {
+		batch := missing[:min(len(missing), maxRegistryIDsPerRequest)]
+		missing = missing[len(batch):]
+		c.requestBatch(ctx, batch, fetched, fetchErrs)
+	}
+
+	var errs []error
+	for i := range results {
+		result := &results[i]
+		if cachedEntry, ok := cachedEntries[result.RegistryID]; ok {
+			result.Auth, result.Err = fetched[result.RegistryID], fetchErrs[result.RegistryID]
+			// fall back to the cached token, as GetCredentialsByRegistryID does,
+			// unless it has expired so that callers can tell the failure
+			if result.Err != nil && cachedEntry != nil && c.currentTime().Before(cachedEntry.ExpiresAt) {
+				logrus.WithError(result.Err).Info("Got error fetching authorization token. Falling back to cached token.")
+				result.Auth, result.Err = AuthFromEntry(cachedEntry)
+			}
+		}
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", registryName(result.RegistryID), result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// requestBatch requests the tokens of the registries of batch together, and
+// records them in fetched, or their error in fetchErrs. A single registry,
+// such as one the identity cannot access, fails the whole request, so the
+// registries of a failed batch are requested one at a time unless the
+// failure affects every registry.
+func (c *defaultClient) requestBatch(ctx context.Context, batch []string, fetched map[string]*Auth, fetchErrs map[string]error) {
+	auths, err := c.requestAuthorizationTokens(ctx, batch)
+	if err != nil && len(batch) > 1 && isRegistryError(ctx, err) {
+		logrus.WithError(err).Debug("Requesting the registries of the failed batch one at a time")
+		for _, registryID := range batch {
+			c.requestBatch(ctx, []string{registryID}, fetched, fetchErrs)
+		}
+		return
+	}
+	for _, auth := range auths {
+		fetched[auth.registryID] = auth.auth
+	}
+	for _, registryID := range batch {
+		if _, ok := fetched[registryID]; ok {
+			continue
+		}
+		if err != nil {
+			fetchErrs[registryID] = err
+		} else {
+			fetchErrs[registryID] = fmt.Errorf("No AuthorizationToken found for %s", registryID)
+		}
+	}
+}
+
+// isRegistryError reports whether err may be caused by a single registry of
+// a request, rather than by the credentials, the network or ECR itself.
+func isRegistryError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	for _, kind := range []error{ErrAWSCredentials, ErrAWSConfig, ErrThrottled, ErrServiceUnavailable} {
+		if errors.Is(err, kind) {
+			return false
+		}
+	}
+	return true
+}
+
+// registryName describes registryID in messages.
+func registryName(registryID string) string {
+	if registryID == "" {
+		return "default registry"
+	}
+	return registryID
+}
+
 func (c *defaultClient) GetPublicCredentials(ctx context.Context, registry string) (*Auth, error) {
-	cachedEntry := c.credentialCache.GetPublic()
+	cachedEntry := c.cachedPublicEntry()
 	if cachedEntry != nil {
-		if cachedEntry.IsValid(time.Now()) {
+		if c.refreshPolicy.IsValid(cachedEntry, c.currentTime()) {
 			logrus.WithField("registry", registry).Debug("Using cached token")
-			return extractToken(cachedEntry.AuthorizationToken, cachedEntry.ProxyEndpoint)
+			return AuthFromEntry(cachedEntry)
 		}
 		logrus.
 			WithField("requestedAt", cachedEntry.RequestedAt).
@@ -224,13 +394,13 @@ func (c *defaultClient) GetPublicCredentials(ctx context.Context, registry strin
 			Debug("Cached token is no longer valid")
 	}
 
-	auth, err := c.getPublicAuthorizationToken(ctx, registry)
+	auth, err := c.coalescedPublicAuthorizationToken(ctx, registry)
 	// if we have a cached token, fall back to avoid failing the request. This may result an expired token
 	// being returned, but if there is a 500 or timeout from the service side, we'd like to attempt to re-use an
 	// old token. We invalidate tokens prior to their expiration date to help mitigate this scenario.
 	if err != nil && cachedEntry != nil {
 		logrus.WithError(err).Info("Got error fetching authorization token. Falling back to cached token.")
-		return extractToken(cachedEntry.AuthorizationToken, cachedEntry.ProxyEndpoint)
+		return AuthFromEntry(cachedEntry)
 	}
 	return auth, err
 }
@@ -248,7 +418,7 @@ func (c *defaultClient) ListCredentials(ctx context.Context) ([]*Auth, error) {
 
 	auths := make([]*Auth, 0)
 	for _, authEntry := range c.credentialCache.List() {
-		auth, err := extractToken(authEntry.AuthorizationToken, authEntry.ProxyEndpoint)
+		auth, err := AuthFromEntry(authEntry)
 		if err != nil {
 			logrus.WithError(err).Debug("Could not extract token")
 		} else {
@@ -259,84 +429,220 @@ func (c *defaultClient) ListCredentials(ctx context.Context) ([]*Auth, error) {
 	return auths, nil
 }
 
+// coalescedAuthorizationToken requests the token of registryID, sharing the
+// request with the concurrent calls for the same registry.
+func (c *defaultClient) coalescedAuthorizationToken(ctx context.Context, registryID string) (*Auth, error) {
+	key, ok := c.requestKey(ctx, ServiceECR, registryID, c.region)
+	if !ok {
+		return c.getAuthorizationToken(ctx, registryID)
+	}
+	return c.requests.do(ctx, key, func(ctx context.Context) (*Auth, error) {
+		// the token may have been cached by a request that completed since
+		if cachedEntry := c.credentialCache.Get(registryID); cachedEntry != nil && c.refreshPolicy.IsValid(cachedEntry, c.currentTime()) {
+			return AuthFromEntry(cachedEntry)
+		}
+		return c.getAuthorizationToken(ctx, registryID)
+	})
+}
+
+// coalescedPublicAuthorizationToken requests the ECR Public token, sharing the
+// request with the concurrent calls for the same registry name, region and
+// endpoint.
+func (c *defaultClient) coalescedPublicAuthorizationToken(ctx context.Context, registry string) (*Auth, error) {
+	// the public cache name stands for the region and endpoint
+	publicName := c.publicCacheName
+	if publicName == "" {
+		publicName = cache.PublicRegistry
+	}
+	key, ok := c.requestKey(ctx, ServiceECRPublic, registry, publicName)
+	if !ok {
+		return c.getPublicAuthorizationToken(ctx, registry)
+	}
+	return c.requests.do(ctx, key, func(ctx context.Context) (*Auth, error) {
+		// the token may have been cached by a request that completed since
+		if cachedEntry := c.cachedPublicEntry(); cachedEntry != nil && c.refreshPolicy.IsValid(cachedEntry, c.currentTime()) {
+			return AuthFromEntry(cachedEntry)
+		}
+		return c.getPublicAuthorizationToken(ctx, registry)
+	})
+}
+
+// requestKey returns the key of the coalesced requests for registry, or false
+// if the requests of the client are not coalesced.
+func (c *defaultClient) requestKey(ctx context.Context, service Service, registry string, region string) (string, bool) {
+	if c.requests == nil {
+		return "", false
+	}
+	identity := c.identity
+	if identity == "" {
+		if c.credentials == nil {
+			return "", false
+		}
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		credentials, err := c.credentials.Retrieve(ctx)
+		if err != nil {
+			return "", false
+		}
+		identity = credentials.AccessKeyID
+	}
+	return strings.Join([]string{string(service), registry, region, identity}, "/"), true
+}
+
 func (c *defaultClient) getAuthorizationToken(ctx context.Context, registryID string) (*Auth, error) {
-	var input *ecr.GetAuthorizationTokenInput
-	if registryID == "" {
+	var registryIDs []string
+	if registryID != "" {
+		registryIDs = []string{registryID}
+	}
+	auths, err := c.requestAuthorizationTokens(ctx, registryIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(auths) == 0 {
+		if registryID == "" {
+			return nil, fmt.Errorf("No AuthorizationToken found for default registry")
+		}
+		return nil, fmt.Errorf("No AuthorizationToken found for %s", registryID)
+	}
+	return auths[0].auth, nil
+}
+
+// registryAuth is the credentials of a registry returned by ECR.
+type registryAuth struct {
+	registryID string
+	auth       *Auth
+}
+
+// requestAuthorizationTokens calls ECR.GetAuthorizationToken for registryIDs,
+// or for the default registry if there are none, and caches every token
+// returned under the ID of its registry, as found by the client's resolver.
+// The credentials are returned in the order of the response.
+func (c *defaultClient) requestAuthorizationTokens(ctx context.Context, registryIDs []string) ([]registryAuth, error) {
+	input := &ecr.GetAuthorizationTokenInput{}
+	if len(registryIDs) == 0 {
 		logrus.Debug("Calling ECR.GetAuthorizationToken for default registry")
-		input = &ecr.GetAuthorizationTokenInput{}
 	} else {
-		logrus.WithField("registry", registryID).Debug("Calling ECR.GetAuthorizationToken")
-		input = &ecr.GetAuthorizationTokenInput{
-			RegistryIds: []string{registryID},
-		}
+		logrus.WithField("registry", strings.Join(registryIDs, ",")).Debug("Calling ECR.GetAuthorizationToken")
+		input.RegistryIds = registryIDs
 	}
 
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	output, err := c.ecrClient.GetAuthorizationToken(ctx, input)
 	if err != nil || output == nil {
 		if err == nil {
-			if registryID == "" {
+			if len(registryIDs) == 0 {
 				err = fmt.Errorf("missing AuthorizationData in ECR response for default registry")
 			} else {
-				err = fmt.Errorf("missing AuthorizationData in ECR response for %s", registryID)
+				err = fmt.Errorf("missing AuthorizationData in ECR response for %s", strings.Join(registryIDs, ", "))
 			}
 		}
-		return nil, fmt.Errorf("ecr: Failed to get authorization token: %w", err)
+		return nil, fmt.Errorf("ecr: Failed to get authorization token: %w", classifyError(err))
 	}
 
+	var auths []registryAuth
 	for _, authData := range output.AuthorizationData {
 		if authData.ProxyEndpoint != nil && authData.AuthorizationToken != nil {
 			authEntry := cache.AuthEntry{
 				AuthorizationToken: aws.ToString(authData.AuthorizationToken),
-				RequestedAt:        time.Now(),
+				RequestedAt:        c.currentTime(),
 				ExpiresAt:          aws.ToTime(authData.ExpiresAt),
 				ProxyEndpoint:      aws.ToString(authData.ProxyEndpoint),
 				Service:            cache.ServiceECR,
 			}
-			registry, err := ExtractRegistry(authEntry.ProxyEndpoint)
+			registry, err := ResolverOrDefault(c.resolver).ResolveRegistry(authEntry.ProxyEndpoint)
 			if err != nil {
 				return nil, fmt.Errorf("Invalid ProxyEndpoint returned by ECR: %s", authEntry.ProxyEndpoint)
 			}
-			auth, err := extractToken(authEntry.AuthorizationToken, authEntry.ProxyEndpoint)
+			auth, err := AuthFromEntry(&authEntry)
 			if err != nil {
 				return nil, err
 			}
 			c.credentialCache.Set(registry.ID, &authEntry)
-			return auth, nil
+			auths = append(auths, registryAuth{registryID: registry.ID, auth: auth})
 		}
 	}
-	if registryID == "" {
-		return nil, fmt.Errorf("No AuthorizationToken found for default registry")
+	return auths, nil
+}
+
+// withTimeout returns ctx with the deadline of a GetAuthorizationToken call.
+func (c *defaultClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, c.timeout)
+}
+
+// withTimeout returns ctx with a deadline timeout from now, or ctx itself if
+// timeout is not positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
-	return nil, fmt.Errorf("No AuthorizationToken found for %s", registryID)
+	return context.WithTimeout(ctx, timeout)
 }
 
 func (c *defaultClient) getPublicAuthorizationToken(ctx context.Context, registry string) (*Auth, error) {
 	var input *ecrpublic.GetAuthorizationTokenInput
 
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	output, err := c.ecrPublicClient.GetAuthorizationToken(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("ecr: failed to get authorization token: %w", err)
+		return nil, fmt.Errorf("ecr: failed to get authorization token: %w", classifyError(err))
 	}
 	if output == nil || output.AuthorizationData == nil {
 		return nil, fmt.Errorf("ecr: missing AuthorizationData in ECR Public response")
 	}
-	endpoint := ecrPublicEndpoint(registry)
 	authData := output.AuthorizationData
-	token, err := extractToken(aws.ToString(authData.AuthorizationToken), endpoint)
-	if err != nil {
-		return nil, err
-	}
 	authEntry := cache.AuthEntry{
 		AuthorizationToken: aws.ToString(authData.AuthorizationToken),
-		RequestedAt:        time.Now(),
+		RequestedAt:        c.currentTime(),
 		ExpiresAt:          aws.ToTime(authData.ExpiresAt),
-		ProxyEndpoint:      endpoint,
+		ProxyEndpoint:      ecrPublicEndpoint(registry),
 		Service:            cache.ServiceECRPublic,
 	}
+	token, err := AuthFromEntry(&authEntry)
+	if err != nil {
+		return nil, err
+	}
+	if c.publicCacheName != "" {
+		registry = c.publicCacheName
+	}
 	c.credentialCache.Set(registry, &authEntry)
 	return token, nil
 }
 
+// InvalidateCredentials removes the cached credentials of registry.
+func (c *defaultClient) InvalidateCredentials(registry *Registry) {
+	if registry.Service == ServiceECRPublic {
+		name := c.publicCacheName
+		if name == "" {
+			name = cache.PublicRegistry
+		}
+		c.credentialCache.Delete(name)
+		return
+	}
+	c.credentialCache.Delete(registry.ID)
+}
+
+// cachedPublicEntry returns the cached ECR Public token of the client's
+// region and endpoint.
+func (c *defaultClient) cachedPublicEntry() *cache.AuthEntry {
+	if c.publicCacheName != "" {
+		return c.credentialCache.Get(c.publicCacheName)
+	}
+	return c.credentialCache.GetPublic()
+}
+
+// AuthFromEntry decodes the token held by a cache entry, carrying over its
+// expiry.
+func AuthFromEntry(entry *cache.AuthEntry) (*Auth, error) {
+	auth, err := extractToken(entry.AuthorizationToken, entry.ProxyEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	auth.ExpiresAt = entry.ExpiresAt
+	return auth, nil
+}
+
 func extractToken(token string, proxyEndpoint string) (*Auth, error) {
 	decodedToken, err := base64.StdEncoding.DecodeString(token)
 	if err != nil {
@@ -22,6 +22,9 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,9 +34,11 @@ import (
 	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
 	ecrpublictypes "github.com/aws/aws-sdk-go-v2/service/ecrpublic/types"
+	"github.com/aws/smithy-go"
 	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
 	mock_cache "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -300,6 +305,41 @@ func TestGetAuthConfigSuccess(t *testing.T) {
 	assert.Equal(t, auth.Username, expectedUsername)
 	assert.Equal(t, auth.Password, expectedPassword)
 	assert.Equal(t, auth.ProxyEndpoint, testProxyEndpoint)
+	assert.Equal(t, auth.ExpiresAt, expiresAt)
+}
+
+func TestGetAuthConfigCustomResolver(t *testing.T) {
+	const customEndpoint = "123456789012.registry.new-partition.example"
+	ecrClient := &mock_api.MockECRAPI{}
+	credentialCache := cache.NewMemoryCredentialsCache()
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+		resolver: ChainRegistryResolver(RegistryResolverFunc(func(serverURL string) (*Registry, error) {
+			if !strings.HasSuffix(serverURL, customEndpoint) {
+				return nil, ErrUnsupportedHost
+			}
+			return &Registry{Service: ServiceECR, ID: registryID, Region: "xx-new-1"}, nil
+		}), DefaultRegistryResolver),
+	}
+
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		return &ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []ecrtypes.AuthorizationData{{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + customEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			}},
+		}, nil
+	}
+
+	auth, err := client.GetCredentials(context.Background(), customEndpoint)
+	assert.NoError(t, err)
+	if assert.NotNil(t, auth) {
+		assert.Equal(t, expectedPassword, auth.Password)
+		assert.Equal(t, proxyEndpointScheme+customEndpoint, auth.ProxyEndpoint)
+	}
+	assert.NotNil(t, credentialCache.Get(registryID), "the token should be cached under the registry found by the resolver")
 }
 
 func TestGetAuthConfigNoMatchAuthorizationToken(t *testing.T) {
@@ -358,6 +398,22 @@ func TestGetAuthConfigGetCacheSuccess(t *testing.T) {
 	assert.Equal(t, auth.Username, expectedUsername)
 	assert.Equal(t, auth.Password, expectedPassword)
 	assert.Equal(t, auth.ProxyEndpoint, testProxyEndpoint)
+	assert.Equal(t, auth.ExpiresAt, expiresAt)
+}
+
+func TestInvalidateCredentials(t *testing.T) {
+	credentialCache := &mock_cache.MockCredentialsCache{}
+	client := &defaultClient{credentialCache: credentialCache}
+
+	var deleted []string
+	credentialCache.DeleteFn = func(r string) { deleted = append(deleted, r) }
+
+	client.InvalidateCredentials(&Registry{ID: registryID, Service: ServiceECR})
+	client.InvalidateCredentials(&Registry{Service: ServiceECRPublic})
+	client.publicCacheName = cache.PublicRegistryName("us-west-2", "")
+	client.InvalidateCredentials(&Registry{Service: ServiceECRPublic})
+
+	assert.Equal(t, []string{registryID, cache.PublicRegistry, cache.PublicRegistryName("us-west-2", "")}, deleted)
 }
 
 func TestGetAuthConfigSuccessInvalidCacheHit(t *testing.T) {
@@ -525,6 +581,195 @@ func TestGetAuthConfigSuccessInvalidCacheHitFallback(t *testing.T) {
 	assert.Equal(t, auth.ProxyEndpoint, testProxyEndpoint)
 }
 
+// batchAuthorizationData returns the authorization data ECR returns for
+// registryIDs.
+func batchAuthorizationData(registryIDs []string, expiresAt time.Time) []ecrtypes.AuthorizationData {
+	authorizationToken := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+	var authorizationData []ecrtypes.AuthorizationData
+	for _, id := range registryIDs {
+		authorizationData = append(authorizationData, ecrtypes.AuthorizationData{
+			ProxyEndpoint:      aws.String(proxyEndpointScheme + id + ".dkr.ecr.us-east-1.amazonaws.com"),
+			ExpiresAt:          aws.Time(expiresAt),
+			AuthorizationToken: aws.String(authorizationToken),
+		})
+	}
+	return authorizationData
+}
+
+func TestGetCredentialsByRegistryIDs(t *testing.T) {
+	ecrClient := &mock_api.MockECRAPI{}
+	credentialCache := cache.NewMemoryCredentialsCache()
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+	}
+
+	const (
+		cachedID  = "999999999999"
+		missingID = "100000000005"
+	)
+	expiresAt := time.Now().Add(12 * time.Hour)
+	credentialCache.Set(cachedID, &cache.AuthEntry{
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("cached:token")),
+		RequestedAt:        time.Now(),
+		ExpiresAt:          expiresAt,
+		ProxyEndpoint:      proxyEndpointScheme + cachedID + ".dkr.ecr.us-east-1.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+
+	var registryIDs []string
+	for i := 0; i < 11; i++ {
+		registryIDs = append(registryIDs, fmt.Sprintf("1000000000%02d", i))
+	}
+	registryIDs = append(registryIDs, cachedID, registryIDs[0])
+
+	var requested [][]string
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		requested = append(requested, input.RegistryIds)
+		var returned []string
+		for _, id := range input.RegistryIds {
+			if id != missingID {
+				returned = append(returned, id)
+			}
+		}
+		return &ecr.GetAuthorizationTokenOutput{AuthorizationData: batchAuthorizationData(returned, expiresAt)}, nil
+	}
+
+	results, err := client.GetCredentialsByRegistryIDs(context.Background(), registryIDs)
+	assert.ErrorContains(t, err, missingID+": No AuthorizationToken found for "+missingID)
+	assert.Equal(t, [][]string{registryIDs[:10], registryIDs[10:11]}, requested, "uncached registries should be requested in batches of 10")
+	if assert.Len(t, results, len(registryIDs)) {
+		for i, result := range results {
+			assert.Equal(t, registryIDs[i], result.RegistryID)
+			switch result.RegistryID {
+			case missingID:
+				assert.Error(t, result.Err)
+				assert.Nil(t, result.Auth)
+			case cachedID:
+				assert.NoError(t, result.Err)
+				assert.Equal(t, "cached", result.Auth.Username)
+			default:
+				assert.NoError(t, result.Err)
+				assert.Equal(t, expectedUsername, result.Auth.Username)
+				assert.Equal(t, proxyEndpointScheme+result.RegistryID+".dkr.ecr.us-east-1.amazonaws.com", result.Auth.ProxyEndpoint)
+			}
+		}
+	}
+	for _, id := range registryIDs[:11] {
+		if id == missingID {
+			assert.Nil(t, credentialCache.Get(id))
+		} else {
+			assert.NotNil(t, credentialCache.Get(id), "every returned token should be cached under its registry ID")
+		}
+	}
+
+	requested = nil
+	results, err = client.GetCredentialsByRegistryIDs(context.Background(), registryIDs[:3])
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Empty(t, requested, "cached registries should not be requested again")
+}
+
+func TestGetCredentialsByRegistryIDsError(t *testing.T) {
+	ecrClient := &mock_api.MockECRAPI{}
+	credentialCache := cache.NewMemoryCredentialsCache()
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: credentialCache,
+	}
+
+	const (
+		staleID   = "111111111111"
+		expiredID = "333333333333"
+	)
+	credentialCache.Set(staleID, &cache.AuthEntry{
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("stale:token")),
+		RequestedAt:        time.Now().Add(-11 * time.Hour),
+		ExpiresAt:          time.Now().Add(time.Hour),
+		ProxyEndpoint:      proxyEndpointScheme + staleID + ".dkr.ecr.us-east-1.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+	credentialCache.Set(expiredID, &cache.AuthEntry{
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte("expired:token")),
+		RequestedAt:        time.Now().Add(-13 * time.Hour),
+		ExpiresAt:          time.Now().Add(-time.Hour),
+		ProxyEndpoint:      proxyEndpointScheme + expiredID + ".dkr.ecr.us-east-1.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		if len(input.RegistryIds) == 0 {
+			return &ecr.GetAuthorizationTokenOutput{AuthorizationData: batchAuthorizationData([]string{registryID}, time.Now().Add(12*time.Hour))}, nil
+		}
+		return nil, errors.New("service unavailable")
+	}
+
+	results, err := client.GetCredentialsByRegistryIDs(context.Background(), []string{staleID, "222222222222", expiredID, ""})
+	assert.ErrorContains(t, err, "222222222222: ecr: Failed to get authorization token: service unavailable")
+	assert.ErrorContains(t, err, expiredID+": ecr: Failed to get authorization token: service unavailable")
+	assert.NotContains(t, err.Error(), staleID)
+	if assert.Len(t, results, 4) {
+		assert.NoError(t, results[0].Err, "the cached token should be used when the request fails")
+		assert.Equal(t, "stale", results[0].Auth.Username)
+		assert.Error(t, results[1].Err)
+		assert.Error(t, results[2].Err, "expired tokens should not be used when the request fails")
+		assert.Nil(t, results[2].Auth)
+		assert.NoError(t, results[3].Err, "the default registry should be requested on its own")
+		assert.Equal(t, proxyEndpointScheme+proxyEndpoint, results[3].Auth.ProxyEndpoint)
+	}
+}
+
+func TestGetCredentialsByRegistryIDsAccessDenied(t *testing.T) {
+	ecrClient := &mock_api.MockECRAPI{}
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewMemoryCredentialsCache(),
+	}
+
+	const deniedID = "222222222222"
+	var requested [][]string
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		requested = append(requested, input.RegistryIds)
+		for _, id := range input.RegistryIds {
+			if id == deniedID {
+				return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}
+			}
+		}
+		return &ecr.GetAuthorizationTokenOutput{AuthorizationData: batchAuthorizationData(input.RegistryIds, time.Now().Add(12*time.Hour))}, nil
+	}
+
+	registryIDs := []string{"111111111111", deniedID, "333333333333"}
+	results, err := client.GetCredentialsByRegistryIDs(context.Background(), registryIDs)
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Equal(t, [][]string{registryIDs, {"111111111111"}, {deniedID}, {"333333333333"}}, requested,
+		"the registries of a denied batch should be requested one at a time")
+	if assert.Len(t, results, 3) {
+		assert.NoError(t, results[0].Err)
+		assert.ErrorIs(t, results[1].Err, ErrAccessDenied)
+		assert.NoError(t, results[2].Err, "a registry that cannot be accessed should not fail the others")
+	}
+}
+
+func TestGetCredentialsByRegistryIDsThrottled(t *testing.T) {
+	ecrClient := &mock_api.MockECRAPI{}
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewMemoryCredentialsCache(),
+	}
+
+	var requests int
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		requests++
+		return nil, &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	}
+
+	results, err := client.GetCredentialsByRegistryIDs(context.Background(), []string{"111111111111", "222222222222"})
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, 1, requests, "failures that affect every registry should not be retried one at a time")
+	for _, result := range results {
+		assert.ErrorIs(t, result.Err, ErrThrottled)
+	}
+}
+
 func TestListCredentialsSuccess(t *testing.T) {
 	ecrClient := &mock_api.MockECRAPI{}
 	ecrPublicClient := &mock_api.MockECRPublicAPI{}
@@ -1051,3 +1296,333 @@ func TestContextCancel(t *testing.T) {
 		assert.ErrorIs(t, err, context.Canceled)
 	})
 }
+
+func TestFactoryWithCache(t *testing.T) {
+	credentialCache := cache.NewMemoryCredentialsCache()
+	factory := DefaultClientFactory{Cache: credentialCache}
+
+	client, err := factory.NewClient(context.Background(), aws.Config{
+		Region:      "us-east-1",
+		Credentials: awscreds.NewStaticCredentialsProvider("accessKey", "secretKey", ""),
+	})
+	assert.NoError(t, err)
+	assert.Same(t, credentialCache, client.(*defaultClient).credentialCache)
+	assert.Same(t, sharedRequests, client.(*defaultClient).requests)
+	assert.Equal(t, "us-east-1", client.(*defaultClient).region)
+}
+
+func TestGetCredentialsCoalescesConcurrentMisses(t *testing.T) {
+	credentialCache := cache.NewMemoryCredentialsCache()
+	requests := &requestGroup{}
+	var calls atomic.Int32
+	ecrClient := &mock_api.MockECRAPI{}
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return &ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: batchAuthorizationData(input.RegistryIds, time.Now().Add(12*time.Hour)),
+		}, nil
+	}
+	// newClient makes a client per call, as ECRHelper does
+	newClient := func(accessKey string) *defaultClient {
+		return &defaultClient{
+			ecrClient:       ecrClient,
+			credentialCache: credentialCache,
+			requests:        requests,
+			region:          "us-east-1",
+			credentials:     awscreds.NewStaticCredentialsProvider(accessKey, "secretKey", ""),
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auth, err := newClient("accessKey").GetCredentials(context.Background(), proxyEndpoint)
+			assert.NoError(t, err)
+			if assert.NotNil(t, auth) {
+				assert.Equal(t, expectedUsername, auth.Username)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "concurrent cache misses should share one request")
+
+	credentialCache.Clear()
+	for _, accessKey := range []string{"accessKey", "otherAccessKey"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := newClient(accessKey).GetCredentials(context.Background(), proxyEndpoint)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), calls.Load(), "requests made with other credentials should not be shared")
+}
+
+func TestGetPublicCredentialsCoalescesConcurrentMisses(t *testing.T) {
+	credentialCache := cache.NewMemoryCredentialsCache()
+	requests := &requestGroup{}
+	var calls atomic.Int32
+	ecrPublicClient := &mock_api.MockECRPublicAPI{}
+	ecrPublicClient.GetAuthorizationTokenFn = func(*ecrpublic.GetAuthorizationTokenInput) (*ecrpublic.GetAuthorizationTokenOutput, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return &ecrpublic.GetAuthorizationTokenOutput{
+			AuthorizationData: &ecrpublictypes.AuthorizationData{
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+			},
+		}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := &defaultClient{
+				ecrPublicClient: ecrPublicClient,
+				credentialCache: credentialCache,
+				requests:        requests,
+				identity:        "identity",
+			}
+			auth, err := client.GetCredentials(context.Background(), ecrPublicName)
+			assert.NoError(t, err)
+			if assert.NotNil(t, auth) {
+				assert.Equal(t, "https://"+ecrPublicName, auth.ProxyEndpoint)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "concurrent cache misses should share one request")
+}
+
+func TestGetCredentialsRefreshPolicy(t *testing.T) {
+	requestedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	expiresAt := requestedAt.Add(12 * time.Hour)
+	cachedToken := base64.StdEncoding.EncodeToString([]byte("cached:password"))
+	freshToken := base64.StdEncoding.EncodeToString([]byte("fresh:password"))
+
+	testCases := []struct {
+		name        string
+		policy      cache.RefreshPolicy
+		elapsed     time.Duration
+		expectFetch bool
+	}{
+		{name: "default before half-life", elapsed: 5 * time.Hour},
+		{name: "default at half-life", elapsed: 6 * time.Hour, expectFetch: true},
+		{name: "fraction before refresh", policy: cache.RefreshPolicy{Fraction: 0.75}, elapsed: 8 * time.Hour},
+		{name: "fraction after refresh", policy: cache.RefreshPolicy{Fraction: 0.75}, elapsed: 9 * time.Hour, expectFetch: true},
+		{name: "margin before refresh", policy: cache.RefreshPolicy{Margin: time.Hour}, elapsed: 10 * time.Hour},
+		{name: "margin after refresh", policy: cache.RefreshPolicy{Margin: time.Hour}, elapsed: 11*time.Hour + time.Minute, expectFetch: true},
+		{name: "min remaining before refresh", policy: cache.RefreshPolicy{MinRemaining: 8 * time.Hour}, elapsed: 3 * time.Hour},
+		{name: "min remaining after refresh", policy: cache.RefreshPolicy{MinRemaining: 8 * time.Hour}, elapsed: 4 * time.Hour, expectFetch: true},
+		{name: "min remaining shorter than half-life", policy: cache.RefreshPolicy{MinRemaining: time.Hour}, elapsed: 7 * time.Hour, expectFetch: true},
+	}
+
+	for _, tc := range testCases {
+		now := requestedAt.Add(tc.elapsed)
+
+		t.Run(tc.name+"/private", func(t *testing.T) {
+			ecrClient := &mock_api.MockECRAPI{}
+			credentialCache := &mock_cache.MockCredentialsCache{}
+			client := &defaultClient{
+				ecrClient:       ecrClient,
+				credentialCache: credentialCache,
+				refreshPolicy:   tc.policy,
+				clock:           clock.NewFake(now),
+			}
+
+			credentialCache.GetFn = func(string) *cache.AuthEntry {
+				return &cache.AuthEntry{
+					AuthorizationToken: cachedToken,
+					RequestedAt:        requestedAt,
+					ExpiresAt:          expiresAt,
+					ProxyEndpoint:      proxyEndpointScheme + proxyEndpoint,
+					Service:            cache.ServiceECR,
+				}
+			}
+			fetched := false
+			ecrClient.GetAuthorizationTokenFn = func(*ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+				fetched = true
+				return &ecr.GetAuthorizationTokenOutput{
+					AuthorizationData: []ecrtypes.AuthorizationData{{
+						ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+						ExpiresAt:          aws.Time(now.Add(12 * time.Hour)),
+						AuthorizationToken: aws.String(freshToken),
+					}},
+				}, nil
+			}
+			credentialCache.SetFn = func(_ string, entry *cache.AuthEntry) {
+				assert.Equal(t, now, entry.RequestedAt)
+			}
+
+			auth, err := client.GetCredentialsByRegistryID(context.Background(), registryID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectFetch, fetched)
+			if tc.expectFetch {
+				assert.Equal(t, "fresh", auth.Username)
+			} else {
+				assert.Equal(t, "cached", auth.Username)
+			}
+		})
+
+		t.Run(tc.name+"/public", func(t *testing.T) {
+			ecrPublicClient := &mock_api.MockECRPublicAPI{}
+			credentialCache := &mock_cache.MockCredentialsCache{}
+			client := &defaultClient{
+				ecrPublicClient: ecrPublicClient,
+				credentialCache: credentialCache,
+				refreshPolicy:   tc.policy,
+				clock:           clock.NewFake(now),
+			}
+
+			credentialCache.GetPublicFn = func() *cache.AuthEntry {
+				return &cache.AuthEntry{
+					AuthorizationToken: cachedToken,
+					RequestedAt:        requestedAt,
+					ExpiresAt:          expiresAt,
+					ProxyEndpoint:      ecrPublicEndpoint(ecrPublicName),
+					Service:            cache.ServiceECRPublic,
+				}
+			}
+			fetched := false
+			ecrPublicClient.GetAuthorizationTokenFn = func(*ecrpublic.GetAuthorizationTokenInput) (*ecrpublic.GetAuthorizationTokenOutput, error) {
+				fetched = true
+				return &ecrpublic.GetAuthorizationTokenOutput{
+					AuthorizationData: &ecrpublictypes.AuthorizationData{
+						ExpiresAt:          aws.Time(now.Add(12 * time.Hour)),
+						AuthorizationToken: aws.String(freshToken),
+					},
+				}, nil
+			}
+			credentialCache.SetFn = func(_ string, entry *cache.AuthEntry) {
+				assert.Equal(t, now, entry.RequestedAt)
+			}
+
+			auth, err := client.GetPublicCredentials(context.Background(), ecrPublicName)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectFetch, fetched)
+			if tc.expectFetch {
+				assert.Equal(t, "fresh", auth.Username)
+			} else {
+				assert.Equal(t, "cached", auth.Username)
+			}
+		})
+	}
+}
+
+func TestFactoryRefreshPolicy(t *testing.T) {
+	config := aws.Config{
+		Region:      "us-east-1",
+		Credentials: awscreds.NewStaticCredentialsProvider("accessKey", "secretKey", ""),
+	}
+	envPolicy := cache.RefreshPolicy{Fraction: 0.9}
+	factoryPolicy := cache.RefreshPolicy{Margin: time.Hour}
+	optionsPolicy := cache.RefreshPolicy{MinRemaining: 2 * time.Hour}
+	t.Setenv("AWS_ECR_TOKEN_REFRESH_FRACTION", "0.9")
+
+	testCases := []struct {
+		name     string
+		factory  DefaultClientFactory
+		opts     Options
+		expected cache.RefreshPolicy
+	}{
+		{name: "environment", expected: envPolicy},
+		{name: "factory", factory: DefaultClientFactory{RefreshPolicy: factoryPolicy}, expected: factoryPolicy},
+		{name: "options", factory: DefaultClientFactory{RefreshPolicy: factoryPolicy}, opts: Options{RefreshPolicy: optionsPolicy}, expected: optionsPolicy},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.factory.Cache = cache.NewNullCredentialsCache()
+			tc.opts.Config = config
+			client, err := tc.factory.NewClientWithOptions(context.Background(), tc.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, client.(*defaultClient).refreshPolicy)
+		})
+	}
+}
+
+func TestGetCredentialsWithFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(start)
+	ecrClient := &mock_api.MockECRAPI{}
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewMemoryCredentialsCache(),
+		clock:           fakeClock,
+	}
+
+	fetches := 0
+	var fetchErr error
+	ecrClient.GetAuthorizationTokenFn = func(*ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		fetches++
+		token := fmt.Sprintf("token%d:password", fetches)
+		return &ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []ecrtypes.AuthorizationData{{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(fakeClock.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(token))),
+			}},
+		}, nil
+	}
+
+	auth, err := client.GetCredentialsByRegistryID(context.Background(), registryID)
+	assert.NoError(t, err)
+	assert.Equal(t, "token1", auth.Username)
+	assert.Equal(t, start.Add(12*time.Hour), auth.ExpiresAt)
+
+	// cached until half of the token's lifetime has passed
+	fakeClock.Advance(5 * time.Hour)
+	auth, err = client.GetCredentialsByRegistryID(context.Background(), registryID)
+	assert.NoError(t, err)
+	assert.Equal(t, "token1", auth.Username)
+
+	fakeClock.Advance(time.Hour)
+	auth, err = client.GetCredentialsByRegistryID(context.Background(), registryID)
+	assert.NoError(t, err)
+	assert.Equal(t, "token2", auth.Username)
+	assert.Equal(t, start.Add(18*time.Hour), auth.ExpiresAt)
+
+	// the stale token is used when it cannot be refreshed
+	fakeClock.Advance(7 * time.Hour)
+	fetchErr = errors.New("service unavailable")
+	auth, err = client.GetCredentialsByRegistryID(context.Background(), registryID)
+	assert.NoError(t, err)
+	assert.Equal(t, "token2", auth.Username)
+}
+
+func TestFactoryClock(t *testing.T) {
+	config := aws.Config{
+		Region:      "us-east-1",
+		Credentials: awscreds.NewStaticCredentialsProvider("accessKey", "secretKey", ""),
+	}
+	factoryClock := clock.NewFake(time.Unix(1, 0))
+	optionsClock := clock.NewFake(time.Unix(2, 0))
+
+	testCases := []struct {
+		name     string
+		factory  DefaultClientFactory
+		opts     Options
+		expected clock.Clock
+	}{
+		{name: "system", expected: clock.System()},
+		{name: "factory", factory: DefaultClientFactory{Clock: factoryClock}, expected: factoryClock},
+		{name: "options", factory: DefaultClientFactory{Clock: factoryClock}, opts: Options{Clock: optionsClock}, expected: optionsClock},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.factory.Cache = cache.NewNullCredentialsCache()
+			tc.opts.Config = config
+			client, err := tc.factory.NewClientWithOptions(context.Background(), tc.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, client.(*defaultClient).clock)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sharedRequests coalesces the token requests of the clients made by
+// DefaultClientFactory, which are usually made for a single call.
+var sharedRequests = &requestGroup{}
+
+// requestGroup coalesces concurrent token requests with the same key, in the
+// manner of golang.org/x/sync/singleflight, so that concurrent cache misses
+// share one API call.
+type requestGroup struct {
+	mu       sync.Mutex
+	requests map[string]*request
+	// waiting, when set, is called with the key of each call before it
+	// waits for the request, which lets tests tell when calls share it.
+	waiting func(key string)
+}
+
+type request struct {
+	done chan struct{}
+	auth *Auth
+	err  error
+}
+
+// do calls fn once for the concurrent calls with the same key and returns its
+// result to each of them. fn runs with the values and deadline of the ctx of
+// the first call but not its cancellation, so that callers that give up do
+// not fail the others; each call returns as soon as its own ctx is done. A nil
+// group calls fn directly.
+func (g *requestGroup) do(ctx context.Context, key string, fn func(context.Context) (*Auth, error)) (*Auth, error) {
+	if g == nil {
+		return fn(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	if g.requests == nil {
+		g.requests = map[string]*request{}
+	}
+	r, ok := g.requests[key]
+	if ok {
+		logrus.WithField("key", key).Debug("Waiting for the token request in flight")
+	} else {
+		r = &request{done: make(chan struct{})}
+		g.requests[key] = r
+		go g.run(ctx, key, r, fn)
+	}
+	g.mu.Unlock()
+	if g.waiting != nil {
+		g.waiting(key)
+	}
+
+	select {
+	case <-r.done:
+		if r.auth == nil {
+			return nil, r.err
+		}
+		// each caller gets its own copy, as ForAlias and callers may modify it
+		auth := *r.auth
+		return &auth, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *requestGroup) run(ctx context.Context, key string, r *request, fn func(context.Context) (*Auth, error)) {
+	requestCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		requestCtx, cancel = context.WithDeadline(requestCtx, deadline)
+		defer cancel()
+	}
+	r.auth, r.err = fn(requestCtx)
+
+	g.mu.Lock()
+	delete(g.requests, key)
+	g.mu.Unlock()
+	close(r.done)
+}
@@ -0,0 +1,165 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type requestContextKey string
+
+// newWaitingGroup returns a requestGroup, and a function that waits until
+// calls calls have waited for a request with key.
+func newWaitingGroup(t *testing.T) (*requestGroup, func(key string, calls int)) {
+	var mu sync.Mutex
+	waiting := map[string]int{}
+	group := &requestGroup{waiting: func(key string) {
+		mu.Lock()
+		defer mu.Unlock()
+		waiting[key]++
+	}}
+	return group, func(key string, calls int) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return waiting[key] == calls
+		}, 5*time.Second, time.Millisecond)
+	}
+}
+
+func TestRequestGroupCoalescesCalls(t *testing.T) {
+	group, waitForCalls := newWaitingGroup(t)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(context.Context) (*Auth, error) {
+		calls.Add(1)
+		<-release
+		return &Auth{Username: expectedUsername}, nil
+	}
+
+	var wg sync.WaitGroup
+	auths := make([]*Auth, 8)
+	for i := range auths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auth, err := group.do(context.Background(), "key", fn)
+			assert.NoError(t, err)
+			auths[i] = auth
+		}()
+	}
+	waitForCalls("key", len(auths))
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, auth := range auths {
+		assert.Equal(t, expectedUsername, auth.Username)
+	}
+	assert.NotSame(t, auths[0], auths[1], "each call should get its own copy")
+	assert.Empty(t, group.requests, "completed requests should be forgotten")
+
+	_, err := group.do(context.Background(), "key", func(context.Context) (*Auth, error) {
+		calls.Add(1)
+		return nil, errors.New("denied")
+	})
+	assert.EqualError(t, err, "denied")
+	assert.Equal(t, int32(2), calls.Load(), "later calls should make a new request")
+}
+
+func TestRequestGroupKeys(t *testing.T) {
+	group := &requestGroup{}
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(context.Context) (*Auth, error) {
+		calls.Add(1)
+		<-release
+		return &Auth{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"ecr/111111111111/us-east-1", "ecr/111111111111/us-west-2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := group.do(context.Background(), key, fn)
+			assert.NoError(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond,
+		"requests with different keys should not be coalesced")
+	close(release)
+	wg.Wait()
+}
+
+func TestRequestGroupCancel(t *testing.T) {
+	group, waitForCalls := newWaitingGroup(t)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (*Auth, error) {
+		close(started)
+		<-release
+		return &Auth{Username: expectedUsername}, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), requestContextKey("test"), "value"))
+	firstDone := make(chan error)
+	go func() {
+		_, err := group.do(ctx, "key", func(ctx context.Context) (*Auth, error) {
+			assert.Equal(t, "value", ctx.Value(requestContextKey("test")), "the context values should be kept")
+			return fn(ctx)
+		})
+		firstDone <- err
+	}()
+	<-started
+
+	secondDone := make(chan *Auth)
+	go func() {
+		auth, err := group.do(context.Background(), "key", fn)
+		assert.NoError(t, err)
+		secondDone <- auth
+	}()
+	waitForCalls("key", 2)
+
+	cancel()
+	assert.ErrorIs(t, <-firstDone, context.Canceled, "a cancelled call should return at once")
+	close(release)
+	auth := <-secondDone
+	if assert.NotNil(t, auth, "the request should not be cancelled with the call that made it") {
+		assert.Equal(t, expectedUsername, auth.Username)
+	}
+
+	_, err := group.do(ctx, "key", func(context.Context) (*Auth, error) {
+		t.Error("a cancelled call should not make a request")
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNilRequestGroup(t *testing.T) {
+	var group *requestGroup
+	auth, err := group.do(context.Background(), "key", func(context.Context) (*Auth, error) {
+		return &Auth{Username: expectedUsername}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUsername, auth.Username)
+}
@@ -0,0 +1,107 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// defaultECRPublicRegion is the region of the ECR Public API, unless
+// overridden with Endpoints.ECRPublicRegion.
+const defaultECRPublicRegion = "us-east-1"
+
+// ECRPublicRegion returns the region of the ECR Public API used with
+// endpoints.
+func ECRPublicRegion(endpoints ecrconfig.Endpoints) string {
+	if endpoints.ECRPublicRegion != "" {
+		return endpoints.ECRPublicRegion
+	}
+	return defaultECRPublicRegion
+}
+
+// publicCacheName returns the name that the ECR Public tokens obtained with
+// endpoints are cached under, or an empty name for the default region and
+// endpoint, whose tokens are cached with GetPublic.
+func publicCacheName(endpoints ecrconfig.Endpoints) string {
+	region := ECRPublicRegion(endpoints)
+	if region == defaultECRPublicRegion && endpoints.ECRPublic == "" {
+		return ""
+	}
+	return cache.PublicRegistryName(region, endpoints.ECRPublic)
+}
+
+// withCABundle returns a copy of awsConfig whose HTTP client also trusts the
+// certificate authorities of the PEM file at caBundle.
+func withCABundle(awsConfig aws.Config, caBundle string) (aws.Config, error) {
+	if caBundle == "" {
+		return awsConfig, nil
+	}
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("ecr: could not read CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return aws.Config{}, fmt.Errorf("ecr: no certificates found in CA bundle %s", caBundle)
+	}
+
+	httpClient, ok := awsConfig.HTTPClient.(*awshttp.BuildableClient)
+	if awsConfig.HTTPClient == nil {
+		httpClient, ok = awshttp.NewBuildableClient(), true
+	}
+	if !ok {
+		return aws.Config{}, fmt.Errorf("ecr: cannot add a CA bundle to HTTP client %T", awsConfig.HTTPClient)
+	}
+	awsConfig = awsConfig.Copy()
+	awsConfig.HTTPClient = httpClient.WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.RootCAs = roots
+	})
+	return awsConfig, nil
+}
+
+// ecrEndpointOptions overrides the endpoint of an ECR client, if set.
+func ecrEndpointOptions(endpoints ecrconfig.Endpoints) func(*ecr.Options) {
+	return func(o *ecr.Options) {
+		if endpoints.ECR != "" {
+			o.BaseEndpoint = aws.String(endpoints.ECR)
+		}
+	}
+}
+
+// ecrPublicEndpointOptions overrides the endpoint of an ECR Public client, if
+// set.
+func ecrPublicEndpointOptions(endpoints ecrconfig.Endpoints) func(*ecrpublic.Options) {
+	return func(o *ecrpublic.Options) {
+		if endpoints.ECRPublic != "" {
+			o.BaseEndpoint = aws.String(endpoints.ECRPublic)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// newEndpointTestClient returns a client of a factory with the given
+// endpoints, which does not retry failed calls.
+func newEndpointTestClient(t *testing.T, endpoints ecrconfig.Endpoints) (Client, error) {
+	t.Helper()
+	factory := DefaultClientFactory{Cache: cache.NewMemoryCredentialsCache()}
+	return factory.NewClientWithOptions(context.Background(), Options{
+		Config: aws.Config{
+			Region:      "us-west-2",
+			Credentials: awscreds.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		Endpoints:   endpoints,
+		RetryPolicy: RetryPolicy{MaxAttempts: 1},
+	})
+}
+
+// writeCABundle writes the certificate of server to a PEM file.
+func writeCABundle(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(path, bundle, 0600))
+	return path
+}
+
+func TestEndpointOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAuthorizationData(w)
+	}))
+	defer server.Close()
+
+	client, err := newEndpointTestClient(t, ecrconfig.Endpoints{ECR: server.URL})
+	assert.NoError(t, err)
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.NoError(t, err)
+	if assert.NotNil(t, auth) {
+		assert.Equal(t, expectedPassword, auth.Password)
+	}
+}
+
+func TestPublicEndpointOverride(t *testing.T) {
+	var requests int
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+		fmt.Fprintf(w, `{"authorizationData": {"authorizationToken": %q, "expiresAt": %d}}`, token, time.Now().Add(time.Hour).Unix())
+	}))
+	defer server.Close()
+
+	credentialCache := cache.NewMemoryCredentialsCache()
+	factory := DefaultClientFactory{Cache: credentialCache}
+	client, err := factory.NewClientWithOptions(context.Background(), Options{
+		Config: aws.Config{
+			Region:      "us-west-2",
+			Credentials: awscreds.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		Endpoints: ecrconfig.Endpoints{ECRPublic: server.URL, ECRPublicRegion: "eu-west-1"},
+	})
+	assert.NoError(t, err)
+
+	for range 2 {
+		auth, err := client.GetCredentials(context.Background(), ecrPublicName)
+		assert.NoError(t, err)
+		if assert.NotNil(t, auth) {
+			assert.Equal(t, expectedPassword, auth.Password)
+			assert.Equal(t, "https://"+ecrPublicName, auth.ProxyEndpoint)
+		}
+	}
+	assert.Equal(t, 1, requests, "the token should be cached")
+	assert.Contains(t, authorization, "/eu-west-1/ecr-public/", "requests should be signed for the public region")
+	assert.Nil(t, credentialCache.GetPublic(), "the token of the default region and endpoint should be left alone")
+	assert.NotNil(t, credentialCache.Get(cache.PublicRegistryName("eu-west-1", server.URL)))
+}
+
+func TestPublicCacheName(t *testing.T) {
+	assert.Empty(t, publicCacheName(ecrconfig.Endpoints{}))
+	assert.Empty(t, publicCacheName(ecrconfig.Endpoints{ECRPublicRegion: "us-east-1"}))
+	assert.Equal(t, cache.PublicRegistryName("us-west-2", ""), publicCacheName(ecrconfig.Endpoints{ECRPublicRegion: "us-west-2"}))
+	assert.Equal(t, cache.PublicRegistryName("us-east-1", "http://localhost:8081"), publicCacheName(ecrconfig.Endpoints{ECRPublic: "http://localhost:8081"}))
+}
+
+func TestEndpointCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAuthorizationData(w)
+	}))
+	defer server.Close()
+
+	t.Run("trusted", func(t *testing.T) {
+		client, err := newEndpointTestClient(t, ecrconfig.Endpoints{ECR: server.URL, CABundle: writeCABundle(t, server)})
+		assert.NoError(t, err)
+		auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+		assert.NoError(t, err)
+		assert.NotNil(t, auth)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		client, err := newEndpointTestClient(t, ecrconfig.Endpoints{ECR: server.URL})
+		assert.NoError(t, err)
+		auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+		assert.Nil(t, auth)
+		assert.ErrorContains(t, err, "certificate")
+	})
+
+	t.Run("missing bundle", func(t *testing.T) {
+		_, err := newEndpointTestClient(t, ecrconfig.Endpoints{ECR: server.URL, CABundle: filepath.Join(t.TempDir(), "missing.pem")})
+		assert.ErrorContains(t, err, "could not read CA bundle")
+	})
+
+	t.Run("invalid bundle", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0600))
+		_, err := newEndpointTestClient(t, ecrconfig.Endpoints{ECR: server.URL, CABundle: path})
+		assert.ErrorContains(t, err, "no certificates found")
+	})
+}
+
+func TestFactoryEndpoints(t *testing.T) {
+	t.Setenv("AWS_ECR_ENDPOINT_URL", "http://env.example.com")
+	opts := Options{Endpoints: ecrconfig.Endpoints{ECR: "http://options.example.com"}}
+	factory := DefaultClientFactory{Endpoints: ecrconfig.Endpoints{ECR: "http://factory.example.com"}}
+
+	assert.Equal(t, opts.Endpoints, factory.clientEndpoints(opts), "Options should take precedence")
+	assert.Equal(t, factory.Endpoints, factory.clientEndpoints(Options{}), "the factory should take precedence over the environment")
+	assert.Equal(t, "http://env.example.com", DefaultClientFactory{}.clientEndpoints(Options{}).ECR)
+}
@@ -0,0 +1,132 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Errors returned by clients and resolvers wrap one of these errors when the
+// cause of a failure is known, so that callers can tell them apart with
+// errors.Is. The underlying SDK error remains available with errors.As.
+var (
+	// ErrUnsupportedHost is returned for hosts that are not ECR registries.
+	ErrUnsupportedHost = errors.New("unsupported host")
+	// ErrAWSCredentials is returned when AWS credentials cannot be loaded,
+	// or are rejected as invalid or expired.
+	ErrAWSCredentials = errors.New("invalid or missing AWS credentials")
+	// ErrAWSConfig is returned when the AWS configuration, such as a shared
+	// config file, a profile or a CA bundle, cannot be loaded.
+	ErrAWSConfig = errors.New("invalid AWS configuration")
+	// ErrAccessDenied is returned when the AWS identity is not allowed to get
+	// authorization tokens.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrThrottled is returned when requests to ECR are throttled.
+	ErrThrottled = errors.New("throttled")
+	// ErrServiceUnavailable is returned when ECR cannot be reached or fails
+	// to respond.
+	ErrServiceUnavailable = errors.New("service unavailable")
+)
+
+var errorKinds = []error{ErrUnsupportedHost, ErrAWSCredentials, ErrAWSConfig, ErrAccessDenied, ErrThrottled, ErrServiceUnavailable}
+
+// classifyError wraps err with the kind of failure it denotes, if known.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	if kind := errorKind(err); kind != nil {
+		return fmt.Errorf("%w: %w", kind, err)
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AccessDeniedException", "AccessDenied":
+			return ErrAccessDenied
+		case "UnrecognizedClientException", "InvalidSignatureException", "InvalidClientTokenId",
+			"ExpiredTokenException", "ExpiredToken", "MissingAuthenticationTokenException":
+			return ErrAWSCredentials
+		case "ThrottlingException", "Throttling", "TooManyRequestsException", "RequestLimitExceeded":
+			return ErrThrottled
+		case "ServerException", "ServiceUnavailableException", "ServiceUnavailable", "InternalFailure":
+			return ErrServiceUnavailable
+		}
+	}
+	var responseErr *smithyhttp.ResponseError
+	if errors.As(err, &responseErr) {
+		switch status := responseErr.HTTPStatusCode(); {
+		case status == http.StatusTooManyRequests:
+			return ErrThrottled
+		case status >= http.StatusInternalServerError:
+			return ErrServiceUnavailable
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrServiceUnavailable
+	}
+	return nil
+}
+
+// credentialsErrorProvider marks the errors of a credentials provider as
+// ErrAWSCredentials, as the SDK does not tell them apart from other failures
+// to sign a request.
+type credentialsErrorProvider struct {
+	provider aws.CredentialsProvider
+}
+
+func (p credentialsErrorProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.provider.Retrieve(ctx)
+	if err != nil {
+		return creds, fmt.Errorf("%w: %w", ErrAWSCredentials, err)
+	}
+	return creds, nil
+}
+
+// ProviderSources reports the sources of the wrapped provider, if known.
+func (p credentialsErrorProvider) ProviderSources() []aws.CredentialSource {
+	if source, ok := p.provider.(aws.CredentialProviderSource); ok {
+		return source.ProviderSources()
+	}
+	return nil
+}
+
+// withCredentialsErrors returns a copy of awsConfig whose credentials errors
+// are marked as ErrAWSCredentials.
+func withCredentialsErrors(awsConfig aws.Config) aws.Config {
+	awsConfig = awsConfig.Copy()
+	switch awsConfig.Credentials.(type) {
+	case nil, aws.AnonymousCredentials, *aws.AnonymousCredentials:
+		return awsConfig
+	}
+	awsConfig.Credentials = credentialsErrorProvider{provider: awsConfig.Credentials}
+	return awsConfig
+}
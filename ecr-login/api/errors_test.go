@@ -0,0 +1,142 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	mock_cache "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache/mocks"
+)
+
+func responseError(status int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      errors.New("response error"),
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDeniedException"}, ErrAccessDenied},
+		{"expired token", &smithy.GenericAPIError{Code: "ExpiredTokenException"}, ErrAWSCredentials},
+		{"unrecognized client", &smithy.GenericAPIError{Code: "UnrecognizedClientException"}, ErrAWSCredentials},
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, ErrThrottled},
+		{"server exception", &smithy.GenericAPIError{Code: "ServerException"}, ErrServiceUnavailable},
+		{"too many requests", responseError(http.StatusTooManyRequests), ErrThrottled},
+		{"bad gateway", responseError(http.StatusBadGateway), ErrServiceUnavailable},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrServiceUnavailable},
+		{"deadline", context.DeadlineExceeded, ErrServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyError(fmt.Errorf("operation error: %w", tc.err))
+			assert.ErrorIs(t, err, tc.expected)
+			assert.ErrorIs(t, err, tc.err, "the SDK error should remain available")
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		err := errors.New("test error")
+		assert.Same(t, err, classifyError(err))
+		assert.Nil(t, classifyError(nil))
+	})
+
+	t.Run("already classified", func(t *testing.T) {
+		err := fmt.Errorf("%w: %w", ErrAWSCredentials, &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+		assert.Same(t, err, classifyError(err))
+		assert.NotErrorIs(t, classifyError(err), ErrServiceUnavailable)
+	})
+}
+
+func TestExtractRegistryUnsupportedHost(t *testing.T) {
+	_, err := ExtractRegistry("index.docker.io")
+	assert.ErrorIs(t, err, ErrUnsupportedHost)
+}
+
+func TestGetCredentialsTypedErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		code     string
+		expected error
+	}{
+		{"access denied", http.StatusBadRequest, "AccessDeniedException", ErrAccessDenied},
+		{"expired token", http.StatusBadRequest, "ExpiredTokenException", ErrAWSCredentials},
+		{"throttled", http.StatusBadRequest, "ThrottlingException", ErrThrottled},
+		{"unavailable", http.StatusServiceUnavailable, "ServiceUnavailableException", ErrServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+				w.WriteHeader(tc.status)
+				fmt.Fprintf(w, `{"__type": %q, "message": "test error"}`, tc.code)
+			}))
+			defer server.Close()
+
+			client := &defaultClient{
+				ecrClient: ecr.NewFromConfig(aws.Config{
+					Region:           "us-east-1",
+					Credentials:      awscreds.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+					RetryMaxAttempts: 1,
+				}, func(o *ecr.Options) {
+					o.BaseEndpoint = aws.String(server.URL)
+				}),
+				credentialCache: &mock_cache.MockCredentialsCache{
+					GetFn: func(_ string) *cache.AuthEntry { return nil },
+				},
+			}
+			auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+			assert.Nil(t, auth)
+			assert.ErrorIs(t, err, tc.expected)
+			var apiErr smithy.APIError
+			assert.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tc.code, apiErr.ErrorCode())
+		})
+	}
+}
+
+func TestGetCredentialsCredentialsError(t *testing.T) {
+	factory := DefaultClientFactory{Cache: cache.NewMemoryCredentialsCache()}
+	client, err := factory.NewClient(context.Background(), aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{}, errors.New("the SSO session has expired")
+		}),
+	})
+	assert.NoError(t, err)
+
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.Nil(t, auth)
+	assert.ErrorIs(t, err, ErrAWSCredentials)
+	assert.ErrorContains(t, err, "the SSO session has expired")
+}
@@ -24,13 +24,37 @@ import (
 	"github.com/aws/smithy-go/middleware"
 	"github.com/aws/smithy-go/transport/http"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/version"
+	"github.com/sirupsen/logrus"
 )
 
 // Options makes the constructors more configurable
 type Options struct {
 	Config   aws.Config
 	CacheDir string
+	// CacheIdentity, when set, scopes cached tokens to this identity instead
+	// of the access key ID of Config's credentials.
+	CacheIdentity string
+	// RefreshPolicy decides when cached tokens are refreshed. It defaults to
+	// the factory's policy, then to the policy set in the environment.
+	RefreshPolicy cache.RefreshPolicy
+	// Clock tells the time tokens are requested and checked at. It defaults
+	// to the factory's clock, then to the system clock.
+	Clock clock.Clock
+	// Resolver finds the registry behind the server URLs passed to
+	// GetCredentials. It defaults to the factory's resolver, then to
+	// DefaultRegistryResolver.
+	Resolver RegistryResolver
+	// RetryPolicy decides how GetAuthorizationToken calls are retried and
+	// when they time out. It defaults to the factory's policy, then to the
+	// policy set in the environment.
+	RetryPolicy RetryPolicy
+	// Endpoints overrides the endpoints of the ECR and ECR Public APIs. It
+	// defaults to the factory's endpoints, then to the endpoints set in the
+	// environment.
+	Endpoints ecrconfig.Endpoints
 }
 
 // ClientFactory is a factory for creating clients to interact with ECR
@@ -42,18 +66,54 @@ type ClientFactory interface {
 	NewClientWithDefaults(ctx context.Context) (Client, error)
 }
 
+// EndpointsClientFactory is a ClientFactory that can make clients for other
+// endpoints than its own.
+type EndpointsClientFactory interface {
+	ClientFactory
+	// WithEndpoints returns a factory whose clients use endpoints, unless
+	// overridden in Options.
+	WithEndpoints(endpoints ecrconfig.Endpoints) ClientFactory
+}
+
+var _ EndpointsClientFactory = DefaultClientFactory{}
+
 // DefaultClientFactory is a default implementation of the ClientFactory
-type DefaultClientFactory struct{}
+type DefaultClientFactory struct {
+	// Cache, when set, is used by every client created by the factory instead
+	// of the file cache. It is not scoped to the credentials of the clients.
+	Cache cache.CredentialsCache
+	// RefreshPolicy, when set, decides when the tokens cached by the created
+	// clients are refreshed, unless overridden in Options.
+	RefreshPolicy cache.RefreshPolicy
+	// Clock, when set, tells the time for the created clients, unless
+	// overridden in Options.
+	Clock clock.Clock
+	// Resolver, when set, finds the registries of the created clients,
+	// unless overridden in Options.
+	Resolver RegistryResolver
+	// RetryPolicy, when set, decides how the created clients retry
+	// GetAuthorizationToken calls, unless overridden in Options.
+	RetryPolicy RetryPolicy
+	// Endpoints, when set, overrides the endpoints of the created clients,
+	// unless overridden in Options.
+	Endpoints ecrconfig.Endpoints
+}
 
 var userAgentLoadOption = config.WithAPIOptions([]func(*middleware.Stack) error{
 	http.AddHeaderValue("User-Agent", "amazon-ecr-credential-helper/"+version.Version),
 })
 
+// WithEndpoints returns a copy of the factory whose clients use endpoints.
+func (defaultClientFactory DefaultClientFactory) WithEndpoints(endpoints ecrconfig.Endpoints) ClientFactory {
+	defaultClientFactory.Endpoints = endpoints
+	return defaultClientFactory
+}
+
 // NewClientWithDefaults creates the client and defaults region
 func (defaultClientFactory DefaultClientFactory) NewClientWithDefaults(ctx context.Context) (Client, error) {
 	awsConfig, err := config.LoadDefaultConfig(ctx, userAgentLoadOption)
 	if err != nil {
-		return nil, fmt.Errorf("loading default AWS config: %w", err)
+		return nil, fmt.Errorf("%w: loading default AWS config: %w", ErrAWSConfig, err)
 	}
 
 	return defaultClientFactory.NewClientWithOptions(ctx, Options{Config: awsConfig})
@@ -68,7 +128,7 @@ func (defaultClientFactory DefaultClientFactory) NewClientWithFipsEndpoint(ctx c
 		config.WithEndpointDiscovery(aws.EndpointDiscoveryEnabled),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("loading AWS config for FIPS endpoint in %s: %w", region, err)
+		return nil, fmt.Errorf("%w: loading AWS config for FIPS endpoint in %s: %w", ErrAWSConfig, region, err)
 	}
 
 	return defaultClientFactory.NewClientWithOptions(ctx, Options{Config: awsConfig})
@@ -82,7 +142,7 @@ func (defaultClientFactory DefaultClientFactory) NewClientFromRegion(ctx context
 		config.WithRegion(region),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("loading AWS config for %s: %w", region, err)
+		return nil, fmt.Errorf("%w: loading AWS config for %s: %w", ErrAWSConfig, region, err)
 	}
 
 	return defaultClientFactory.NewClientWithOptions(ctx, Options{
@@ -97,12 +157,91 @@ func (defaultClientFactory DefaultClientFactory) NewClient(ctx context.Context,
 
 // NewClientWithOptions Create new client with Options
 func (defaultClientFactory DefaultClientFactory) NewClientWithOptions(ctx context.Context, opts Options) (Client, error) {
-	// The ECR Public API is only available in us-east-1 today
-	publicConfig := opts.Config.Copy()
-	publicConfig.Region = "us-east-1"
+	retryPolicy := defaultClientFactory.clientRetryPolicy(opts)
+	credentialCache := defaultClientFactory.Cache
+	if credentialCache == nil {
+		// building the cache may retrieve the AWS credentials
+		cacheCtx, cancel := withTimeout(ctx, retryPolicy.Timeout)
+		credentialCache = cache.BuildCredentialsCacheForIdentity(cacheCtx, opts.Config, opts.CacheDir, opts.CacheIdentity)
+		cancel()
+	}
+	endpoints := defaultClientFactory.clientEndpoints(opts)
+	clientConfig, err := withCABundle(withCredentialsErrors(opts.Config), endpoints.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAWSConfig, err)
+	}
+	publicConfig := clientConfig.Copy()
+	publicConfig.Region = ECRPublicRegion(endpoints)
 	return &defaultClient{
-		ecrClient:       NewECRClientWrapper(ecr.NewFromConfig(opts.Config)),
-		ecrPublicClient: NewECRPublicClientWrapper(ecrpublic.NewFromConfig(publicConfig)),
-		credentialCache: cache.BuildCredentialsCache(ctx, opts.Config, opts.CacheDir),
+		ecrClient: NewECRClientWrapper(ecr.NewFromConfig(clientConfig,
+			retryPolicy.ecrOptions, ecrEndpointOptions(endpoints))),
+		ecrPublicClient: NewECRPublicClientWrapper(ecrpublic.NewFromConfig(publicConfig,
+			retryPolicy.ecrPublicOptions, ecrPublicEndpointOptions(endpoints))),
+		publicCacheName: publicCacheName(endpoints),
+		timeout:         retryPolicy.Timeout,
+		credentialCache: credentialCache,
+		refreshPolicy:   defaultClientFactory.clientRefreshPolicy(opts),
+		clock:           defaultClientFactory.clientClock(opts),
+		resolver:        defaultClientFactory.clientResolver(opts),
+		requests:        sharedRequests,
+		region:          clientConfig.Region,
+		identity:        opts.CacheIdentity,
+		credentials:     clientConfig.Credentials,
 	}, nil
 }
+
+func (defaultClientFactory DefaultClientFactory) clientResolver(opts Options) RegistryResolver {
+	if opts.Resolver != nil {
+		return opts.Resolver
+	}
+	return ResolverOrDefault(defaultClientFactory.Resolver)
+}
+
+func (defaultClientFactory DefaultClientFactory) clientClock(opts Options) clock.Clock {
+	if opts.Clock != nil {
+		return opts.Clock
+	}
+	return clock.OrSystem(defaultClientFactory.Clock)
+}
+
+func (defaultClientFactory DefaultClientFactory) clientRefreshPolicy(opts Options) cache.RefreshPolicy {
+	if !opts.RefreshPolicy.IsZero() {
+		return opts.RefreshPolicy
+	}
+	if !defaultClientFactory.RefreshPolicy.IsZero() {
+		return defaultClientFactory.RefreshPolicy
+	}
+	policy, err := cache.RefreshPolicyFromEnv()
+	if err != nil {
+		logrus.WithError(err).Warning("Ignoring invalid token refresh policy")
+	}
+	return policy
+}
+
+func (defaultClientFactory DefaultClientFactory) clientRetryPolicy(opts Options) RetryPolicy {
+	if !opts.RetryPolicy.IsZero() {
+		return opts.RetryPolicy
+	}
+	if !defaultClientFactory.RetryPolicy.IsZero() {
+		return defaultClientFactory.RetryPolicy
+	}
+	policy, err := RetryPolicyFromEnv()
+	if err != nil {
+		logrus.WithError(err).Warning("Ignoring invalid retry policy")
+	}
+	return policy
+}
+
+func (defaultClientFactory DefaultClientFactory) clientEndpoints(opts Options) ecrconfig.Endpoints {
+	if !opts.Endpoints.IsZero() {
+		return opts.Endpoints
+	}
+	if !defaultClientFactory.Endpoints.IsZero() {
+		return defaultClientFactory.Endpoints
+	}
+	endpoints, err := ecrconfig.EndpointsFromEnv()
+	if err != nil {
+		logrus.WithError(err).Warning("Ignoring invalid endpoints")
+	}
+	return endpoints
+}
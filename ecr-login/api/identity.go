@@ -0,0 +1,85 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// LoadConfigForRegistry loads the AWS configuration used to call ECR for
+// registry, resolving credentials as described by registryConfig.
+func LoadConfigForRegistry(ctx context.Context, registry *Registry, registryConfig *ecrconfig.RegistryConfig) (aws.Config, error) {
+	loadOptions := []func(*config.LoadOptions) error{userAgentLoadOption}
+	if registry.Region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(registry.Region))
+	}
+	if registry.FIPS {
+		loadOptions = append(loadOptions, config.WithEndpointDiscovery(aws.EndpointDiscoveryEnabled))
+	}
+	if registryConfig.Profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(registryConfig.Profile))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("%w: loading AWS config for registry %s: %w", ErrAWSConfig, registry.ID, err)
+	}
+
+	if registryConfig.RoleARN != "" {
+		stsClient := sts.NewFromConfig(awsConfig, func(o *sts.Options) {
+			if registryConfig.STSRegion != "" {
+				o.Region = registryConfig.STSRegion
+			}
+		})
+		provider := stscreds.NewAssumeRoleProvider(stsClient, registryConfig.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if registryConfig.ExternalID != "" {
+				o.ExternalID = aws.String(registryConfig.ExternalID)
+			}
+			if registryConfig.SessionName != "" {
+				o.RoleSessionName = registryConfig.SessionName
+			}
+			o.Tags = sessionTags(registryConfig.SessionTags)
+		})
+		awsConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return awsConfig, nil
+}
+
+// sessionTags converts tags to STS session tags, sorted by key.
+func sessionTags(tags map[string]string) []ststypes.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []ststypes.Tag
+	for _, key := range keys {
+		result = append(result, ststypes.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+const testSharedConfig = `
+[profile build]
+aws_access_key_id = AKIDBUILD
+aws_secret_access_key = SECRETBUILD
+`
+
+// setupSharedConfig points the SDK at a shared config file containing a
+// "build" profile with static credentials.
+func setupSharedConfig(t *testing.T) {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(configFile, []byte(testSharedConfig), 0600))
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+}
+
+func TestLoadConfigForRegistryProfile(t *testing.T) {
+	setupSharedConfig(t)
+
+	registry := &Registry{Service: ServiceECR, ID: registryID, Region: "us-west-2"}
+	awsConfig, err := LoadConfigForRegistry(context.Background(), registry, &ecrconfig.RegistryConfig{Profile: "build"})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", awsConfig.Region)
+
+	credentials, err := awsConfig.Credentials.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDBUILD", credentials.AccessKeyID)
+}
+
+func TestLoadConfigForRegistryMissingProfile(t *testing.T) {
+	setupSharedConfig(t)
+
+	registry := &Registry{Service: ServiceECR, ID: registryID, Region: "us-west-2"}
+	_, err := LoadConfigForRegistry(context.Background(), registry, &ecrconfig.RegistryConfig{Profile: "missing"})
+	assert.Error(t, err)
+}
+
+func TestLoadConfigForRegistryRole(t *testing.T) {
+	setupSharedConfig(t)
+
+	registry := &Registry{Service: ServiceECR, ID: registryID, Region: "us-west-2"}
+	awsConfig, err := LoadConfigForRegistry(context.Background(), registry, &ecrconfig.RegistryConfig{
+		Profile:   "build",
+		RoleARN:   "arn:aws:iam::123456789012:role/pull",
+		STSRegion: "us-east-1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "us-west-2", awsConfig.Region, "the STS region should not change the region of the registry")
+	_, ok := awsConfig.Credentials.(*aws.CredentialsCache)
+	assert.True(t, ok, "assumed role credentials should be cached")
+}
+
+func TestSessionTags(t *testing.T) {
+	tags := sessionTags(map[string]string{"team": "platform", "env": "prod"})
+	assert.Len(t, tags, 2)
+	assert.Equal(t, "env", aws.ToString(tags[0].Key))
+	assert.Equal(t, "prod", aws.ToString(tags[0].Value))
+	assert.Equal(t, "team", aws.ToString(tags[1].Key))
+	assert.Equal(t, "platform", aws.ToString(tags[1].Value))
+
+	assert.Empty(t, sessionTags(nil))
+}
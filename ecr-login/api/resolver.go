@@ -0,0 +1,90 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RegistryResolver returns the ECR registry behind a server URL. It returns an
+// error when the server URL is not a registry it knows about.
+type RegistryResolver interface {
+	ResolveRegistry(serverURL string) (*Registry, error)
+}
+
+// RegistryResolverFunc adapts a function to a RegistryResolver.
+type RegistryResolverFunc func(serverURL string) (*Registry, error)
+
+// ResolveRegistry calls f(serverURL).
+func (f RegistryResolverFunc) ResolveRegistry(serverURL string) (*Registry, error) {
+	return f(serverURL)
+}
+
+// DefaultRegistryResolver resolves the endpoints of ECR and ECR Public with
+// ExtractRegistry.
+var DefaultRegistryResolver RegistryResolver = endpointRegistryResolver{}
+
+type endpointRegistryResolver struct{}
+
+func (endpointRegistryResolver) ResolveRegistry(serverURL string) (*Registry, error) {
+	return ExtractRegistry(serverURL)
+}
+
+// ResolverOrDefault returns r, or DefaultRegistryResolver if r is nil.
+func ResolverOrDefault(r RegistryResolver) RegistryResolver {
+	if r == nil {
+		return DefaultRegistryResolver
+	}
+	return r
+}
+
+type chainRegistryResolver []RegistryResolver
+
+// ChainRegistryResolver returns a RegistryResolver that tries each of
+// resolvers in order and returns the first registry found. Nil resolvers are
+// skipped. When none of them resolves the server URL, the error is the first
+// one that is not ErrUnsupportedHost, or the errors of all the resolvers
+// joined if every one of them reported the host as unsupported.
+func ChainRegistryResolver(resolvers ...RegistryResolver) RegistryResolver {
+	var chain chainRegistryResolver
+	for _, r := range resolvers {
+		if r != nil {
+			chain = append(chain, r)
+		}
+	}
+	return chain
+}
+
+func (chain chainRegistryResolver) ResolveRegistry(serverURL string) (*Registry, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: no registry resolver for %q", ErrUnsupportedHost, serverURL)
+	}
+	var errs []error
+	var firstErr error
+	for _, r := range chain {
+		registry, err := r.ResolveRegistry(serverURL)
+		if err == nil {
+			return registry, nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrUnsupportedHost) {
+			firstErr = err
+		}
+		errs = append(errs, err)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, errors.Join(errs...)
+}
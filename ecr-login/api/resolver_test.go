@@ -0,0 +1,153 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api/mocks"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostResolver resolves a single host to a registry.
+type hostResolver struct {
+	host     string
+	registry Registry
+}
+
+func (r hostResolver) ResolveRegistry(serverURL string) (*Registry, error) {
+	if serverURL != r.host {
+		return nil, fmt.Errorf("%w: unknown host %s", ErrUnsupportedHost, serverURL)
+	}
+	registry := r.registry
+	return &registry, nil
+}
+
+func TestDefaultRegistryResolver(t *testing.T) {
+	registry, err := DefaultRegistryResolver.ResolveRegistry(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, &Registry{Service: ServiceECR, ID: registryID, Region: "us-east-1"}, registry)
+
+	assert.Equal(t, DefaultRegistryResolver, ResolverOrDefault(nil))
+	custom := hostResolver{host: "registry.example.com"}
+	assert.Equal(t, custom, ResolverOrDefault(custom))
+}
+
+func TestChainRegistryResolver(t *testing.T) {
+	custom := hostResolver{
+		host:     "registry.example.com",
+		registry: Registry{Service: ServiceECR, ID: "210987654321", Region: "eu-west-1"},
+	}
+	shadow := hostResolver{
+		host:     proxyEndpoint,
+		registry: Registry{Service: ServiceECR, ID: "111111111111", Region: "us-west-2"},
+	}
+	resolver := ChainRegistryResolver(custom, nil, DefaultRegistryResolver, shadow)
+
+	registry, err := resolver.ResolveRegistry("registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "210987654321", registry.ID)
+
+	registry, err = resolver.ResolveRegistry(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, registryID, registry.ID, "the first resolver in the chain should win")
+
+	_, err = resolver.ResolveRegistry("other.example.com")
+	assert.ErrorIs(t, err, ErrUnsupportedHost)
+	assert.ErrorContains(t, err, "unknown host other.example.com")
+	assert.ErrorContains(t, err, "can only be used with Amazon Elastic Container Registry")
+
+	// other failures are not reported as unsupported hosts
+	failing := RegistryResolverFunc(func(string) (*Registry, error) { return nil, errors.New("lookup failed") })
+	_, err = ChainRegistryResolver(custom, failing, DefaultRegistryResolver).ResolveRegistry("other.example.com")
+	assert.EqualError(t, err, "lookup failed")
+	assert.NotErrorIs(t, err, ErrUnsupportedHost)
+
+	_, err = ChainRegistryResolver().ResolveRegistry(proxyEndpoint)
+	assert.Error(t, err)
+}
+
+func TestGetCredentialsWithResolver(t *testing.T) {
+	ecrClient := &mock_api.MockECRAPI{}
+	client := &defaultClient{
+		ecrClient:       ecrClient,
+		credentialCache: cache.NewNullCredentialsCache(),
+		resolver: ChainRegistryResolver(hostResolver{
+			host:     "registry.example.com",
+			registry: Registry{Service: ServiceECR, ID: registryID, Region: "us-east-1", Alias: "registry.example.com"},
+		}, DefaultRegistryResolver),
+	}
+
+	ecrClient.GetAuthorizationTokenFn = func(input *ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+		assert.Equal(t, []string{registryID}, input.RegistryIds)
+		return &ecr.GetAuthorizationTokenOutput{
+			AuthorizationData: []ecrtypes.AuthorizationData{{
+				ProxyEndpoint:      aws.String(proxyEndpointScheme + proxyEndpoint),
+				ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+				AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))),
+			}},
+		}, nil
+	}
+
+	auth, err := client.GetCredentials(context.Background(), "registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://registry.example.com", auth.ProxyEndpoint)
+	assert.Equal(t, expectedUsername, auth.Username)
+
+	auth, err = client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, proxyEndpointScheme+proxyEndpoint, auth.ProxyEndpoint)
+
+	_, err = client.GetCredentials(context.Background(), "other.example.com")
+	assert.Error(t, err)
+}
+
+func TestFactoryResolver(t *testing.T) {
+	config := aws.Config{
+		Region:      "us-east-1",
+		Credentials: awscreds.NewStaticCredentialsProvider("accessKey", "secretKey", ""),
+	}
+	factoryResolver := hostResolver{host: "factory.example.com"}
+	optionsResolver := hostResolver{host: "options.example.com"}
+
+	testCases := []struct {
+		name     string
+		factory  DefaultClientFactory
+		opts     Options
+		expected RegistryResolver
+	}{
+		{name: "default", expected: DefaultRegistryResolver},
+		{name: "factory", factory: DefaultClientFactory{Resolver: factoryResolver}, expected: factoryResolver},
+		{name: "options", factory: DefaultClientFactory{Resolver: factoryResolver}, opts: Options{Resolver: optionsResolver}, expected: optionsResolver},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.factory.Cache = cache.NewNullCredentialsCache()
+			tc.opts.Config = config
+			client, err := tc.factory.NewClientWithOptions(context.Background(), tc.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, client.(*defaultClient).resolver)
+		})
+	}
+}
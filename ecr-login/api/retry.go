@@ -0,0 +1,111 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+)
+
+// RetryPolicy decides how GetAuthorizationToken calls are retried, and how
+// long they may take. The zero value keeps the retry behavior of the AWS
+// config, and sets no deadline.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, including the
+	// first one.
+	MaxAttempts int
+	// MaxBackoff is the maximum delay between two attempts. Delays grow
+	// exponentially, with jitter, up to MaxBackoff.
+	MaxBackoff time.Duration
+	// Timeout is the deadline of a call, including all of its attempts and
+	// the retrieval of the AWS credentials it needs. Credentials retrieved
+	// when a client is created, to scope its token cache, get a deadline of
+	// their own.
+	Timeout time.Duration
+}
+
+// IsZero reports whether p is the zero value, i.e. the default policy.
+func (p RetryPolicy) IsZero() bool {
+	return p == RetryPolicy{}
+}
+
+// Validate checks that the fields of p are consistent.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("ecr: max attempts cannot be negative")
+	}
+	if p.MaxBackoff < 0 || p.Timeout < 0 {
+		return fmt.Errorf("ecr: retry durations cannot be negative")
+	}
+	return nil
+}
+
+// RetryPolicyFromEnv returns the retry policy set with the
+// AWS_ECR_MAX_ATTEMPTS, AWS_ECR_MAX_BACKOFF and AWS_ECR_TIMEOUT environment
+// variables.
+func RetryPolicyFromEnv() (RetryPolicy, error) {
+	var policy RetryPolicy
+	if value := os.Getenv("AWS_ECR_MAX_ATTEMPTS"); value != "" {
+		maxAttempts, err := strconv.Atoi(value)
+		if err != nil {
+			return RetryPolicy{}, fmt.Errorf("ecr: invalid AWS_ECR_MAX_ATTEMPTS: %w", err)
+		}
+		policy.MaxAttempts = maxAttempts
+	}
+	if value := os.Getenv("AWS_ECR_MAX_BACKOFF"); value != "" {
+		maxBackoff, err := time.ParseDuration(value)
+		if err != nil {
+			return RetryPolicy{}, fmt.Errorf("ecr: invalid AWS_ECR_MAX_BACKOFF: %w", err)
+		}
+		policy.MaxBackoff = maxBackoff
+	}
+	if value := os.Getenv("AWS_ECR_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return RetryPolicy{}, fmt.Errorf("ecr: invalid AWS_ECR_TIMEOUT: %w", err)
+		}
+		policy.Timeout = timeout
+	}
+	if err := policy.Validate(); err != nil {
+		return RetryPolicy{}, err
+	}
+	return policy, nil
+}
+
+// ecrOptions applies the retry settings of p to an ECR client. The timeout
+// is applied by the client to each call instead.
+func (p RetryPolicy) ecrOptions(o *ecr.Options) {
+	if p.MaxAttempts != 0 {
+		o.RetryMaxAttempts = p.MaxAttempts
+	}
+	if p.MaxBackoff != 0 {
+		o.Retryer = retry.AddWithMaxBackoffDelay(o.Retryer, p.MaxBackoff)
+	}
+}
+
+// ecrPublicOptions is like ecrOptions, for ECR Public clients.
+func (p RetryPolicy) ecrPublicOptions(o *ecrpublic.Options) {
+	if p.MaxAttempts != 0 {
+		o.RetryMaxAttempts = p.MaxAttempts
+	}
+	if p.MaxBackoff != 0 {
+		o.Retryer = retry.AddWithMaxBackoffDelay(o.Retryer, p.MaxBackoff)
+	}
+}
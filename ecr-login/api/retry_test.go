@@ -0,0 +1,192 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscreds "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+)
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, RetryPolicy{}.Validate())
+	assert.NoError(t, RetryPolicy{MaxAttempts: 5, MaxBackoff: time.Second, Timeout: time.Minute}.Validate())
+	assert.Error(t, RetryPolicy{MaxAttempts: -1}.Validate())
+	assert.Error(t, RetryPolicy{MaxBackoff: -time.Second}.Validate())
+	assert.Error(t, RetryPolicy{Timeout: -time.Second}.Validate())
+}
+
+func TestRetryPolicyFromEnv(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxAttempts string
+		maxBackoff  string
+		timeout     string
+		expected    RetryPolicy
+		expectedErr bool
+	}{
+		{name: "unset"},
+		{name: "max attempts", maxAttempts: "5", expected: RetryPolicy{MaxAttempts: 5}},
+		{name: "max backoff", maxBackoff: "2s", expected: RetryPolicy{MaxBackoff: 2 * time.Second}},
+		{name: "timeout", timeout: "30s", expected: RetryPolicy{Timeout: 30 * time.Second}},
+		{name: "invalid max attempts", maxAttempts: "many", expectedErr: true},
+		{name: "negative max attempts", maxAttempts: "-1", expectedErr: true},
+		{name: "invalid max backoff", maxBackoff: "1 second", expectedErr: true},
+		{name: "invalid timeout", timeout: "soon", expectedErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ECR_MAX_ATTEMPTS", tc.maxAttempts)
+			t.Setenv("AWS_ECR_MAX_BACKOFF", tc.maxBackoff)
+			t.Setenv("AWS_ECR_TIMEOUT", tc.timeout)
+
+			policy, err := RetryPolicyFromEnv()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, policy)
+		})
+	}
+}
+
+func TestFactoryRetryPolicy(t *testing.T) {
+	t.Setenv("AWS_ECR_TIMEOUT", "1m")
+	opts := Options{RetryPolicy: RetryPolicy{Timeout: time.Second}}
+	factory := DefaultClientFactory{RetryPolicy: RetryPolicy{Timeout: time.Minute}}
+
+	assert.Equal(t, opts.RetryPolicy, factory.clientRetryPolicy(opts), "Options should take precedence")
+	assert.Equal(t, factory.RetryPolicy, factory.clientRetryPolicy(Options{}), "the factory should take precedence over the environment")
+	assert.Equal(t, RetryPolicy{Timeout: time.Minute}, DefaultClientFactory{}.clientRetryPolicy(Options{}))
+}
+
+// newRetryTestClient returns a client of a factory with the given retry policy
+// that sends its requests to server.
+func newRetryTestClient(t *testing.T, server *httptest.Server, policy RetryPolicy) Client {
+	t.Helper()
+	factory := DefaultClientFactory{Cache: cache.NewMemoryCredentialsCache()}
+	client, err := factory.NewClientWithOptions(context.Background(), Options{
+		Config: aws.Config{
+			Region:       "us-east-1",
+			Credentials:  awscreds.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+			BaseEndpoint: aws.String(server.URL),
+		},
+		RetryPolicy: policy,
+	})
+	assert.NoError(t, err)
+	return client
+}
+
+// throttlingServer throttles the first throttled requests it receives, then
+// returns an authorization token.
+func throttlingServer(throttled int32, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if requests.Add(1) <= throttled {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "ThrottlingException", "message": "Rate exceeded"}`)
+			return
+		}
+		writeAuthorizationData(w)
+	}))
+}
+
+// writeAuthorizationData writes the response of the ECR API to a successful
+// GetAuthorizationToken call for proxyEndpoint.
+func writeAuthorizationData(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+	fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": %q, "expiresAt": %d, "proxyEndpoint": "https://%s"}]}`,
+		token, time.Now().Add(12*time.Hour).Unix(), proxyEndpoint)
+}
+
+func TestRetryThrottling(t *testing.T) {
+	var requests atomic.Int32
+	server := throttlingServer(2, &requests)
+	defer server.Close()
+
+	client := newRetryTestClient(t, server, RetryPolicy{MaxAttempts: 3, MaxBackoff: time.Millisecond})
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.NoError(t, err)
+	if assert.NotNil(t, auth) {
+		assert.Equal(t, expectedPassword, auth.Password)
+	}
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var requests atomic.Int32
+	server := throttlingServer(5, &requests)
+	defer server.Close()
+
+	client := newRetryTestClient(t, server, RetryPolicy{MaxAttempts: 2, MaxBackoff: time.Millisecond})
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.Nil(t, auth)
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestRetryTimeout(t *testing.T) {
+	testDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-testDone:
+		}
+	}))
+	defer server.Close()
+	defer close(testDone)
+
+	client := newRetryTestClient(t, server, RetryPolicy{Timeout: 100 * time.Millisecond})
+	start := time.Now()
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.Nil(t, auth)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrServiceUnavailable)
+	assert.Less(t, time.Since(start), 10*time.Second, "the call should give up at its deadline")
+}
+
+func TestRetryTimeoutCoversCredentials(t *testing.T) {
+	var retrievals atomic.Int32
+	blocking := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		retrievals.Add(1)
+		<-ctx.Done()
+		return aws.Credentials{}, ctx.Err()
+	})
+	factory := DefaultClientFactory{Cache: cache.NewMemoryCredentialsCache()}
+	client, err := factory.NewClientWithOptions(context.Background(), Options{
+		Config:      aws.Config{Region: "us-east-1", Credentials: blocking},
+		RetryPolicy: RetryPolicy{Timeout: 100 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	auth, err := client.GetCredentials(context.Background(), proxyEndpoint)
+	assert.Nil(t, auth)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second, "retrieving credentials should give up at the deadline")
+	assert.NotZero(t, retrievals.Load())
+}
@@ -30,6 +30,14 @@ import (
 )
 
 func BuildCredentialsCache(ctx context.Context, config aws.Config, cacheDir string) CredentialsCache {
+	return BuildCredentialsCacheForIdentity(ctx, config, cacheDir, "")
+}
+
+// BuildCredentialsCacheForIdentity builds a credentials cache whose keys are
+// scoped to identity instead of the access key ID of the credentials. This is
+// used for temporary credentials, such as those of an assumed role, whose
+// access key changes between sessions.
+func BuildCredentialsCacheForIdentity(ctx context.Context, config aws.Config, cacheDir string, identity string) CredentialsCache {
 	if os.Getenv("AWS_ECR_DISABLE_CACHE") != "" {
 		logrus.Debug("Cache disabled due to AWS_ECR_DISABLE_CACHE")
 		return NewNullCredentialsCache()
@@ -46,29 +54,46 @@ func BuildCredentialsCache(ctx context.Context, config aws.Config, cacheDir stri
 		return NewNullCredentialsCache()
 	}
 
-	cacheFilename := "cache.json"
+	var fileCache CredentialsCache
+	if identity != "" {
+		// Entries scoped to an identity were never written with legacy keys,
+		// and the credentials are not needed, so a role is not assumed just
+		// to build the cache.
+		fileCache, err = newFileCache(
+			cacheDir,
+			identityCachePrefix(config.Region, identity),
+			identityPublicCacheKey(identity),
+			"",
+			"",
+		)
+	} else {
+		var credentials aws.Credentials
+		credentials, err = config.Credentials.Retrieve(ctx)
+		if err != nil {
+			logrus.WithError(err).Debug("Could not fetch credentials for cache prefix, disabling cache")
+			return NewNullCredentialsCache()
+		}
 
-	credentials, err := config.Credentials.Retrieve(ctx)
+		// In FIPS mode, skip legacy MD5-based cache keys
+		var legacyPrefix, legacyPublicKey string
+		if !isFipsMode() {
+			legacyPrefix = legacyCredentialsCachePrefix(config.Region, credentials)
+			legacyPublicKey = legacyCredentialsPublicCacheKey(credentials)
+		}
+
+		fileCache, err = newFileCache(
+			cacheDir,
+			credentialsCachePrefix(config.Region, credentials),
+			credentialsPublicCacheKey(credentials),
+			legacyPrefix,
+			legacyPublicKey,
+		)
+	}
 	if err != nil {
-		logrus.WithError(err).Debug("Could not fetch credentials for cache prefix, disabling cache")
+		logrus.WithError(err).Info("Could not set up cache encryption, disabling cache")
 		return NewNullCredentialsCache()
 	}
-
-	// In FIPS mode, skip legacy MD5-based cache keys
-	var legacyPrefix, legacyPublicKey string
-	if !isFipsMode() {
-		legacyPrefix = legacyCredentialsCachePrefix(config.Region, credentials)
-		legacyPublicKey = legacyCredentialsPublicCacheKey(credentials)
-	}
-
-	return NewFileCredentialsCache(
-		cacheDir,
-		cacheFilename,
-		credentialsCachePrefix(config.Region, credentials),
-		credentialsPublicCacheKey(credentials),
-		legacyPrefix,
-		legacyPublicKey,
-	)
+	return fileCache
 }
 
 // Determine a key prefix for a credentials cache. Because auth tokens are scoped to an account and region, rely on provided
@@ -81,6 +106,15 @@ func credentialsPublicCacheKey(credentials aws.Credentials) string {
 	return fmt.Sprintf("%s-%s", ServiceECRPublic, checksum(credentials.AccessKeyID))
 }
 
+// Determine a key prefix for a credentials cache scoped to an identity rather than an access key.
+func identityCachePrefix(region string, identity string) string {
+	return fmt.Sprintf("%s-%s-", region, checksum(identity))
+}
+
+func identityPublicCacheKey(identity string) string {
+	return fmt.Sprintf("%s-%s", ServiceECRPublic, checksum(identity))
+}
+
 // Legacy cache key functions for backward compatibility with MD5-based keys
 func legacyCredentialsCachePrefix(region string, credentials aws.Credentials) string {
 	return fmt.Sprintf("%s-%s-", region, md5Checksum(credentials.AccessKeyID))
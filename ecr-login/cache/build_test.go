@@ -15,6 +15,7 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -52,6 +53,40 @@ func TestFactoryBuildFileCache(t *testing.T) {
 	assert.Equal(t, fileCache.filename, testCacheFilename)
 }
 
+func TestFactoryBuildFileCacheForIdentity(t *testing.T) {
+	config := aws.Config{
+		Region:      testRegion,
+		Credentials: credentials.NewStaticCredentialsProvider(testAccessKey, testSecretKey, testToken),
+	}
+
+	cache := BuildCredentialsCacheForIdentity(context.Background(), config, "", "arn:aws:iam::123456789012:role/pull")
+	fileCache, ok := cache.(*fileCredentialCache)
+	assert.True(t, ok, "built cache is not a fileCredentialsCache")
+
+	identityHash := checksum("arn:aws:iam::123456789012:role/pull")
+	assert.Equal(t, fmt.Sprintf("%s-%s-", testRegion, identityHash), fileCache.cachePrefixKey)
+	assert.Equal(t, fmt.Sprintf("%s-%s", ServiceECRPublic, identityHash), fileCache.publicCacheKey)
+	assert.Empty(t, fileCache.legacyCachePrefixKey)
+	assert.Empty(t, fileCache.legacyPublicCacheKey)
+
+	other := BuildCredentialsCacheForIdentity(context.Background(), config, "", "arn:aws:iam::123456789012:role/push")
+	assert.NotEqual(t, fileCache.cachePrefixKey, other.(*fileCredentialCache).cachePrefixKey)
+}
+
+func TestFactoryBuildFileCacheForIdentityDoesNotRetrieveCredentials(t *testing.T) {
+	config := aws.Config{
+		Region: testRegion,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			t.Error("credentials should not be retrieved for a cache scoped to an identity")
+			return aws.Credentials{}, errors.New("not retrieved")
+		}),
+	}
+
+	cache := BuildCredentialsCacheForIdentity(context.Background(), config, "", "arn:aws:iam::123456789012:role/pull")
+	_, ok := cache.(*fileCredentialCache)
+	assert.True(t, ok, "built cache is not a fileCredentialsCache")
+}
+
 func TestFactoryBuildNullCacheWithoutCredentials(t *testing.T) {
 	config := aws.Config{
 		Region:      testRegion,
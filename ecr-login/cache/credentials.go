@@ -14,6 +14,7 @@
 package cache
 
 import (
+	"strings"
 	"time"
 )
 
@@ -21,6 +22,10 @@ type CredentialsCache interface {
 	Get(registry string) *AuthEntry
 	GetPublic() *AuthEntry
 	Set(registry string, entry *AuthEntry)
+	// Delete removes the entries of registry, given as a registry ID, or as
+	// PublicRegistry or a name returned by PublicRegistryName for ECR Public
+	// tokens.
+	Delete(registry string)
 	List() []*AuthEntry
 	Clear()
 }
@@ -32,6 +37,41 @@ const (
 	ServiceECRPublic Service = "ecr-public"
 )
 
+// PublicRegistry is the name that Get, Set and Delete use for the ECR Public
+// tokens of the default region and endpoint, which are also returned by
+// GetPublic.
+const PublicRegistry = string(ServiceECRPublic)
+
+// publicRegistryPrefix starts the names returned by PublicRegistryName.
+const publicRegistryPrefix = PublicRegistry + "@"
+
+// PublicRegistryName returns the name that Get and Set use for the ECR Public
+// tokens of the given region and endpoint, which are cached apart from the
+// tokens of the default region and endpoint returned by GetPublic. endpoint
+// is empty for the default endpoint of the region.
+func PublicRegistryName(region string, endpoint string) string {
+	name := publicRegistryPrefix + region
+	if endpoint != "" {
+		name += "@" + endpoint
+	}
+	return name
+}
+
+// publicKey returns the key of the ECR Public entry of registry, given the key
+// of the entry of the default region and endpoint.
+func publicKey(defaultKey string, registry string) string {
+	if scope, ok := strings.CutPrefix(registry, publicRegistryPrefix); ok {
+		return defaultKey + "@" + scope
+	}
+	return defaultKey
+}
+
+// isPublicRegistryName reports whether registry is PublicRegistry or was
+// returned by PublicRegistryName.
+func isPublicRegistryName(registry string) bool {
+	return registry == PublicRegistry || strings.HasPrefix(registry, publicRegistryPrefix)
+}
+
 type AuthEntry struct {
 	AuthorizationToken string
 	RequestedAt        time.Time
@@ -41,9 +81,7 @@ type AuthEntry struct {
 }
 
 // IsValid checks if AuthEntry is still valid at testTime. AuthEntries expire at 1/2 of their original
-// requested window.
+// requested window, see RefreshPolicy for other policies.
 func (authEntry *AuthEntry) IsValid(testTime time.Time) bool {
-	validWindow := authEntry.ExpiresAt.Sub(authEntry.RequestedAt)
-	refreshTime := authEntry.ExpiresAt.Add(-1 * validWindow / time.Duration(2))
-	return testTime.Before(refreshTime)
+	return RefreshPolicy{}.IsValid(authEntry, testTime)
 }
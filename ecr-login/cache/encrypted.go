@@ -0,0 +1,210 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const (
+	// EncryptionKeySize is the size in bytes of the AES-256 keys used to
+	// encrypt the file cache.
+	EncryptionKeySize = 32
+
+	sealedCacheVersion = "aes-gcm-1"
+	machineKeyInfo     = "amazon-ecr-credential-helper cache"
+)
+
+// Sources of the cache encryption key, selected with AWS_ECR_CACHE_ENCRYPTION.
+const (
+	EncryptionNone    = "none"
+	EncryptionEnv     = "env"
+	EncryptionFile    = "file"
+	EncryptionMachine = "machine"
+)
+
+// sealedRegistryCache is the on-disk format of an encrypted cache. Its
+// Version never matches registryCacheVersion, so switching between plaintext
+// and encrypted caches discards the existing file.
+type sealedRegistryCache struct {
+	Version    string
+	Ciphertext []byte
+}
+
+type cacheCipher struct {
+	aead cipher.AEAD
+	// keyID tells apart the caches encrypted with different keys
+	keyID string
+}
+
+func newCacheCipher(key []byte) (*cacheCipher, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("cache: encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheCipher{aead: aead, keyID: checksum(string(key))}, nil
+}
+
+// seal encrypts a serialized RegistryCache into a serialized sealedRegistryCache.
+func (c *cacheCipher) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(sealedRegistryCache{
+		Version:    sealedCacheVersion,
+		Ciphertext: c.aead.Seal(nonce, nonce, plaintext, []byte(sealedCacheVersion)),
+	}, "", "  ")
+}
+
+// open decrypts a serialized sealedRegistryCache written by seal.
+func (c *cacheCipher) open(data []byte) ([]byte, error) {
+	var sealed sealedRegistryCache
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, err
+	}
+	if sealed.Version != sealedCacheVersion {
+		return nil, fmt.Errorf("ecr: Encrypted registry cache version %#v is not compatible with %#v, ignoring existing cache",
+			sealed.Version,
+			sealedCacheVersion)
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(sealed.Ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ecr: Encrypted registry cache is truncated, ignoring existing cache")
+	}
+	nonce, ciphertext := sealed.Ciphertext[:nonceSize], sealed.Ciphertext[nonceSize:]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(sealedCacheVersion))
+	if err != nil {
+		return nil, fmt.Errorf("ecr: Could not decrypt registry cache, ignoring existing cache: %w", err)
+	}
+	return plaintext, nil
+}
+
+// NewEncryptedFileCredentialsCache returns a file credentials cache that is
+// encrypted at rest with AES-GCM using key, which must be EncryptionKeySize
+// bytes long. The arguments are otherwise the same as NewFileCredentialsCache.
+//
+// A cache file that cannot be decrypted, for example because it was written
+// with another key or in plaintext, is ignored and replaced on the next save.
+func NewEncryptedFileCredentialsCache(path string, filename string, cachePrefixKey string, publicCacheKey string, legacyCachePrefixKey string, legacyPublicCacheKey string, key []byte) (CredentialsCache, error) {
+	cacheCipher, err := newCacheCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	credentialsCache := NewFileCredentialsCache(path, filename, cachePrefixKey, publicCacheKey, legacyCachePrefixKey, legacyPublicCacheKey)
+	credentialsCache.(*fileCredentialCache).cipher = cacheCipher
+	return credentialsCache, nil
+}
+
+// EncryptionKey returns the cache encryption key selected by the
+// AWS_ECR_CACHE_ENCRYPTION environment variable, or nil if the cache is
+// stored in plaintext.
+//
+//   - "env" reads a base64 encoded key from AWS_ECR_CACHE_ENCRYPTION_KEY.
+//   - "file" reads a base64 encoded key from the file named by
+//     AWS_ECR_CACHE_ENCRYPTION_KEY_FILE.
+//   - "machine" derives a key from the machine ID and the home directory of
+//     the current user.
+func EncryptionKey() ([]byte, error) {
+	switch source := os.Getenv("AWS_ECR_CACHE_ENCRYPTION"); source {
+	case "", EncryptionNone:
+		return nil, nil
+	case EncryptionEnv:
+		return decodeEncryptionKey(os.Getenv("AWS_ECR_CACHE_ENCRYPTION_KEY"), "AWS_ECR_CACHE_ENCRYPTION_KEY")
+	case EncryptionFile:
+		keyFile := os.Getenv("AWS_ECR_CACHE_ENCRYPTION_KEY_FILE")
+		if keyFile == "" {
+			return nil, fmt.Errorf("cache: AWS_ECR_CACHE_ENCRYPTION_KEY_FILE is not set")
+		}
+		keyFile, err := homedir.Expand(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cache: could not read encryption key: %w", err)
+		}
+		return decodeEncryptionKey(string(data), keyFile)
+	case EncryptionMachine:
+		return machineEncryptionKey()
+	default:
+		return nil, fmt.Errorf("cache: unknown AWS_ECR_CACHE_ENCRYPTION %q", source)
+	}
+}
+
+func decodeEncryptionKey(encoded string, source string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, fmt.Errorf("cache: no encryption key in %s", source)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cache: encryption key in %s is not base64 encoded: %w", source, err)
+	}
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("cache: encryption key in %s must be %d bytes, got %d", source, EncryptionKeySize, len(key))
+	}
+	return key, nil
+}
+
+// machineEncryptionKey derives a key that is stable for a user on a machine.
+// It protects copies of the cache taken off the machine, not against other
+// processes running as the same user.
+func machineEncryptionKey() ([]byte, error) {
+	id, err := machineID()
+	if err != nil {
+		return nil, fmt.Errorf("cache: could not read machine ID: %w", err)
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return deriveEncryptionKey(id, home)
+}
+
+func deriveEncryptionKey(machineID string, home string) ([]byte, error) {
+	return hkdf.Key(sha256.New, []byte(machineID), []byte(home), machineKeyInfo, EncryptionKeySize)
+}
+
+// newFileCache returns a file cache that is encrypted if requested by
+// AWS_ECR_CACHE_ENCRYPTION.
+func newFileCache(cacheDir string, cachePrefixKey string, publicCacheKey string, legacyCachePrefixKey string, legacyPublicCacheKey string) (CredentialsCache, error) {
+	key, err := EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return NewFileCredentialsCache(cacheDir, CacheFilename, cachePrefixKey, publicCacheKey, legacyCachePrefixKey, legacyPublicCacheKey), nil
+	}
+	// Encrypted caches were never written with legacy keys
+	return NewEncryptedFileCredentialsCache(cacheDir, CacheFilename, cachePrefixKey, publicCacheKey, "", "", key)
+}
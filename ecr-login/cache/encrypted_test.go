@@ -0,0 +1,201 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testEncryptionKey      = bytes.Repeat([]byte{0x01}, EncryptionKeySize)
+	testOtherEncryptionKey = bytes.Repeat([]byte{0x02}, EncryptionKeySize)
+)
+
+func newTestEncryptedCache(t *testing.T, dir string, key []byte) CredentialsCache {
+	credentialCache, err := NewEncryptedFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "", key)
+	assert.NoError(t, err)
+	return credentialCache
+}
+
+func TestEncryptedCredentials(t *testing.T) {
+	dir := t.TempDir()
+	credentialCache := newTestEncryptedCache(t, dir, testEncryptionKey)
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set(testRegistryName, &testPublicAuthEntry)
+
+	entry := credentialCache.Get(testRegistryName)
+	assert.NotNil(t, entry)
+	assert.Equal(t, testAuthEntry.AuthorizationToken, entry.AuthorizationToken)
+	assert.Equal(t, testAuthEntry.ProxyEndpoint, entry.ProxyEndpoint)
+	assert.Equal(t, testAuthEntry.Service, entry.Service)
+
+	publicEntry := credentialCache.GetPublic()
+	assert.NotNil(t, publicEntry)
+	assert.Equal(t, testPublicAuthEntry.Service, publicEntry.Service)
+
+	data, err := os.ReadFile(filepath.Join(dir, testFilename))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), testAuthEntry.AuthorizationToken)
+	assert.NotContains(t, string(data), testAuthEntry.ProxyEndpoint)
+	assert.Contains(t, string(data), sealedCacheVersion)
+
+	credentialCache.Clear()
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+}
+
+func TestEncryptedCacheWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	newTestEncryptedCache(t, dir, testEncryptionKey).Set(testRegistryName, &testAuthEntry)
+
+	credentialCache := newTestEncryptedCache(t, dir, testOtherEncryptionKey)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	// the undecryptable file is replaced on the next save
+	credentialCache.Set("other", &testAuthEntry)
+	assert.NotNil(t, credentialCache.Get("other"))
+	assert.Nil(t, newTestEncryptedCache(t, dir, testEncryptionKey).Get("other"))
+}
+
+func TestEncryptedCacheCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	credentialCache := newTestEncryptedCache(t, dir, testEncryptionKey)
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+
+	path := filepath.Join(dir, testFilename)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	sealed := bytes.Replace(data, []byte(`"Ciphertext": "`), []byte(`"Ciphertext": "AAAA`), 1)
+	assert.NoError(t, os.WriteFile(path, sealed, 0600))
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	assert.NoError(t, os.WriteFile(path, []byte(testBadJson), 0600))
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+}
+
+func TestEncryptedCacheIgnoresPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	plaintextCache := NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+	plaintextCache.Set(testRegistryName, &testAuthEntry)
+
+	encryptedCache := newTestEncryptedCache(t, dir, testEncryptionKey)
+	assert.Nil(t, encryptedCache.Get(testRegistryName))
+
+	encryptedCache.Set(testRegistryName, &testAuthEntry)
+	assert.Nil(t, plaintextCache.Get(testRegistryName))
+}
+
+func TestNewEncryptedCacheInvalidKey(t *testing.T) {
+	_, err := NewEncryptedFileCredentialsCache(t.TempDir(), testFilename, "", "", "", "", []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestEncryptionKey(t *testing.T) {
+	encodedKey := base64.StdEncoding.EncodeToString(testEncryptionKey)
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(encodedKey+"\n"), 0600))
+
+	tests := []struct {
+		name        string
+		encryption  string
+		key         string
+		keyFile     string
+		expected    []byte
+		expectedErr bool
+	}{
+		{name: "unset"},
+		{name: "none", encryption: EncryptionNone},
+		{name: "env", encryption: EncryptionEnv, key: encodedKey, expected: testEncryptionKey},
+		{name: "env missing", encryption: EncryptionEnv, expectedErr: true},
+		{name: "env not base64", encryption: EncryptionEnv, key: "not base64!", expectedErr: true},
+		{name: "env wrong size", encryption: EncryptionEnv, key: base64.StdEncoding.EncodeToString([]byte("short")), expectedErr: true},
+		{name: "file", encryption: EncryptionFile, keyFile: keyFile, expected: testEncryptionKey},
+		{name: "file unset", encryption: EncryptionFile, expectedErr: true},
+		{name: "file missing", encryption: EncryptionFile, keyFile: keyFile + ".missing", expectedErr: true},
+		{name: "unknown", encryption: "rot13", expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_ECR_CACHE_ENCRYPTION", tt.encryption)
+			t.Setenv("AWS_ECR_CACHE_ENCRYPTION_KEY", tt.key)
+			t.Setenv("AWS_ECR_CACHE_ENCRYPTION_KEY_FILE", tt.keyFile)
+
+			key, err := EncryptionKey()
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, key)
+		})
+	}
+}
+
+func TestDeriveEncryptionKey(t *testing.T) {
+	key, err := deriveEncryptionKey("machine", "/home/user")
+	assert.NoError(t, err)
+	assert.Len(t, key, EncryptionKeySize)
+
+	same, err := deriveEncryptionKey("machine", "/home/user")
+	assert.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	otherUser, err := deriveEncryptionKey("machine", "/home/other")
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, otherUser)
+
+	otherMachine, err := deriveEncryptionKey("other", "/home/user")
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, otherMachine)
+}
+
+func TestFactoryBuildEncryptedCache(t *testing.T) {
+	t.Setenv("AWS_ECR_CACHE_ENCRYPTION", EncryptionEnv)
+	t.Setenv("AWS_ECR_CACHE_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(testEncryptionKey))
+
+	config := aws.Config{
+		Region:      testRegion,
+		Credentials: credentials.NewStaticCredentialsProvider(testAccessKey, testSecretKey, testToken),
+	}
+
+	cache := BuildCredentialsCache(context.Background(), config, t.TempDir())
+	fileCache, ok := cache.(*fileCredentialCache)
+	assert.True(t, ok, "built cache is not a fileCredentialsCache")
+	assert.NotNil(t, fileCache.cipher)
+	assert.Empty(t, fileCache.legacyCachePrefixKey)
+	assert.Empty(t, fileCache.legacyPublicCacheKey)
+}
+
+func TestFactoryBuildNullCacheWithInvalidEncryptionKey(t *testing.T) {
+	t.Setenv("AWS_ECR_CACHE_ENCRYPTION", EncryptionEnv)
+	t.Setenv("AWS_ECR_CACHE_ENCRYPTION_KEY", "")
+
+	config := aws.Config{
+		Region:      testRegion,
+		Credentials: credentials.NewStaticCredentialsProvider(testAccessKey, testSecretKey, testToken),
+	}
+
+	cache := BuildCredentialsCache(context.Background(), config, t.TempDir())
+	_, ok := cache.(*nullCredentialsCache)
+	assert.True(t, ok, "built cache is not a nullCredentialsCache")
+}
@@ -16,8 +16,10 @@ package cache
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -36,6 +38,25 @@ type fileCredentialCache struct {
 	publicCacheKey       string
 	legacyCachePrefixKey string
 	legacyPublicCacheKey string
+	// cipher encrypts the cache at rest when set, see NewEncryptedFileCredentialsCache
+	cipher *cacheCipher
+}
+
+// parsedCache is the contents of a cache file as last read or written by the
+// process, kept so that the file is only parsed again after it changes.
+type parsedCache struct {
+	info          os.FileInfo
+	registryCache *RegistryCache
+}
+
+// parsedCaches holds the parsedCache of each cache file by path and
+// encryption key, shared by the caches of the process.
+var parsedCaches sync.Map
+
+// matches reports whether info describes the file the cache was parsed from,
+// unchanged. Saving a cache always replaces the file.
+func (p *parsedCache) matches(info os.FileInfo) bool {
+	return os.SameFile(p.info, info) && p.info.ModTime().Equal(info.ModTime()) && p.info.Size() == info.Size()
 }
 
 func newRegistryCache() *RegistryCache {
@@ -45,6 +66,22 @@ func newRegistryCache() *RegistryCache {
 	}
 }
 
+// clone returns a copy of c, so that the parsed caches are not modified.
+func (c *RegistryCache) clone() *RegistryCache {
+	clone := &RegistryCache{
+		Registries: make(map[string]*AuthEntry, len(c.Registries)),
+		Version:    c.Version,
+	}
+	for key, entry := range c.Registries {
+		if entry != nil {
+			entryCopy := *entry
+			entry = &entryCopy
+		}
+		clone.Registries[key] = entry
+	}
+	return clone
+}
+
 // NewFileCredentialsCache returns a new file credentials cache.
 //
 // path is used for temporary files during save, and filename should be a relative filename
@@ -69,8 +106,11 @@ func NewFileCredentialsCache(path string, filename string, cachePrefixKey string
 
 func (f *fileCredentialCache) Get(registry string) *AuthEntry {
 	logrus.WithField("registry", registry).Debug("Checking file cache")
-	registryCache := f.init()
+	registryCache := f.read()
 
+	if isPublicRegistryName(registry) {
+		return registryCache.Registries[publicKey(f.publicCacheKey, registry)]
+	}
 	entry := registryCache.Registries[f.cachePrefixKey+registry]
 	if entry != nil {
 		return entry
@@ -93,7 +133,7 @@ func (f *fileCredentialCache) Get(registry string) *AuthEntry {
 
 func (f *fileCredentialCache) GetPublic() *AuthEntry {
 	logrus.Debug("Checking file cache for ECR Public")
-	registryCache := f.init()
+	registryCache := f.read()
 
 	entry := registryCache.Registries[f.publicCacheKey]
 	if entry != nil {
@@ -120,23 +160,42 @@ func (f *fileCredentialCache) Set(registry string, entry *AuthEntry) {
 		WithField("registry", registry).
 		WithField("service", entry.Service).
 		Debug("Saving credentials to file cache")
-	registryCache := f.init()
 
 	key := f.cachePrefixKey + registry
 	if entry.Service == ServiceECRPublic {
-		key = f.publicCacheKey
+		key = publicKey(f.publicCacheKey, registry)
 	}
-	registryCache.Registries[key] = entry
-
-	err := f.save(registryCache)
+	err := f.update(func(registryCache *RegistryCache) {
+		registryCache.Registries[key] = entry
+	})
 	if err != nil {
 		logrus.WithError(err).Info("Could not save cache")
 	}
 }
 
+func (f *fileCredentialCache) Delete(registry string) {
+	logrus.WithField("registry", registry).Debug("Deleting credentials from file cache")
+
+	var keys []string
+	if isPublicRegistryName(registry) {
+		keys = append(keys, publicKey(f.publicCacheKey, registry))
+		if registry == PublicRegistry && f.legacyPublicCacheKey != "" {
+			keys = append(keys, f.legacyPublicCacheKey)
+		}
+	} else {
+		keys = append(keys, f.cachePrefixKey+registry)
+		if f.legacyCachePrefixKey != "" {
+			keys = append(keys, f.legacyCachePrefixKey+registry)
+		}
+	}
+	if err := f.Remove(keys...); err != nil {
+		logrus.WithError(err).Info("Could not save cache")
+	}
+}
+
 // List returns all of the available AuthEntries (regardless of prefix)
 func (f *fileCredentialCache) List() []*AuthEntry {
-	registryCache := f.init()
+	registryCache := f.read()
 
 	// optimize allocation for copy
 	entries := make([]*AuthEntry, 0, len(registryCache.Registries))
@@ -148,8 +207,30 @@ func (f *fileCredentialCache) List() []*AuthEntry {
 	return entries
 }
 
+// Entries returns all of the stored AuthEntries by cache key
+func (f *fileCredentialCache) Entries() map[string]*AuthEntry {
+	return f.read().Registries
+}
+
+// Remove deletes the AuthEntries stored under the given cache keys
+func (f *fileCredentialCache) Remove(keys ...string) error {
+	return f.update(func(registryCache *RegistryCache) {
+		for _, key := range keys {
+			delete(registryCache.Registries, key)
+		}
+	})
+}
+
 func (f *fileCredentialCache) Clear() {
-	err := os.Remove(f.fullFilePath())
+	lock, err := acquireLock(f.lockFilePath(), true)
+	if err != nil {
+		logrus.WithError(err).Info("Could not lock cache, not clearing it")
+		return
+	}
+	defer lock.release()
+
+	parsedCaches.Delete(f.parsedCacheKey())
+	err = os.Remove(f.fullFilePath())
 	if err != nil {
 		logrus.WithError(err).Info("Could not clear cache")
 	}
@@ -159,9 +240,48 @@ func (f *fileCredentialCache) fullFilePath() string {
 	return filepath.Join(f.path, f.filename)
 }
 
+func (f *fileCredentialCache) lockFilePath() string {
+	return f.fullFilePath() + ".lock"
+}
+
+// parsedCacheKey is the key of the parsed contents of the cache file in
+// parsedCaches.
+func (f *fileCredentialCache) parsedCacheKey() string {
+	if f.cipher == nil {
+		return f.fullFilePath()
+	}
+	return f.fullFilePath() + "#" + f.cipher.keyID
+}
+
+// read loads the cache while holding a shared lock. If the lock cannot be acquired in time, the cache behaves as if
+// it was empty so that callers fall back to fetching fresh credentials.
+func (f *fileCredentialCache) read() *RegistryCache {
+	lock, err := acquireLock(f.lockFilePath(), false)
+	if err != nil {
+		logrus.WithError(err).Info("Could not lock cache, ignoring cached credentials")
+		return newRegistryCache()
+	}
+	defer lock.release()
+	return f.init()
+}
+
+// update applies modify to the cache and saves it while holding an exclusive lock, so that concurrent writers from
+// other processes do not drop each other's entries. If the lock cannot be acquired in time, nothing is saved.
+func (f *fileCredentialCache) update(modify func(*RegistryCache)) error {
+	lock, err := acquireLock(f.lockFilePath(), true)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	registryCache := f.init()
+	modify(registryCache)
+	return f.save(registryCache)
+}
+
 // Saves credential cache to disk. This writes to a temporary file first, then moves the file to the config location.
-// This eliminates from reading partially written credential files, and reduces (but does not eliminate) concurrent
-// file access. There is not guarantee here for handling multiple writes at once since there is no out of process locking.
+// This prevents readers from seeing partially written credential files. Callers are expected to hold the exclusive
+// cache lock, see update.
 func (f *fileCredentialCache) save(registryCache *RegistryCache) error {
 	file, err := os.CreateTemp(f.path, ".config.json.tmp")
 	if err != nil {
@@ -169,6 +289,9 @@ func (f *fileCredentialCache) save(registryCache *RegistryCache) error {
 	}
 
 	buff, err := json.MarshalIndent(registryCache, "", "  ")
+	if err == nil && f.cipher != nil {
+		buff, err = f.cipher.seal(buff)
+	}
 	if err != nil {
 		file.Close()
 		os.Remove(file.Name())
@@ -176,6 +299,10 @@ func (f *fileCredentialCache) save(registryCache *RegistryCache) error {
 	}
 
 	_, err = file.Write(buff)
+	var info os.FileInfo
+	if err == nil {
+		info, err = file.Stat()
+	}
 
 	if err != nil {
 		file.Close()
@@ -185,21 +312,27 @@ func (f *fileCredentialCache) save(registryCache *RegistryCache) error {
 
 	file.Close()
 	// note this is only atomic when relying on linux syscalls
-	os.Rename(file.Name(), f.fullFilePath())
-	return err
+	if err := os.Rename(file.Name(), f.fullFilePath()); err != nil {
+		return err
+	}
+	parsedCaches.Store(f.parsedCacheKey(), &parsedCache{info: info, registryCache: registryCache.clone()})
+	return nil
 }
 
+// init loads the cache, starting from an empty cache if the existing file is malformed or incompatible. Callers hold
+// the cache lock; the existing file is replaced by the next save rather than removed here, since a shared lock does
+// not allow it.
 func (f *fileCredentialCache) init() *RegistryCache {
 	registryCache, err := f.load()
 	if err != nil {
 		logrus.WithError(err).Info("Could not load existing cache")
-		f.Clear()
 		registryCache = newRegistryCache()
 	}
 	return registryCache
 }
 
-// Loading a cache from disk will return errors for malformed or incompatible cache files.
+// Loading a cache from disk will return errors for malformed, incompatible or undecryptable cache files. The file is
+// only parsed again when it changed since the process last read or wrote it.
 func (f *fileCredentialCache) load() (*RegistryCache, error) {
 	registryCache := newRegistryCache()
 
@@ -207,14 +340,31 @@ func (f *fileCredentialCache) load() (*RegistryCache, error) {
 	if os.IsNotExist(err) {
 		return registryCache, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if parsed, ok := parsedCaches.Load(f.parsedCacheKey()); ok && parsed.(*parsedCache).matches(info) {
+		return parsed.(*parsedCache).registryCache.clone(), nil
+	}
 
+	data, err := io.ReadAll(file)
 	if err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
+	if f.cipher != nil {
+		if data, err = f.cipher.open(data); err != nil {
+			return nil, err
+		}
+	}
 
-	if err = json.NewDecoder(file).Decode(&registryCache); err != nil {
+	if err = json.Unmarshal(data, &registryCache); err != nil {
 		return nil, err
 	}
 
@@ -231,5 +381,6 @@ func (f *fileCredentialCache) load() (*RegistryCache, error) {
 		}
 	}
 
+	parsedCaches.Store(f.parsedCacheKey(), &parsedCache{info: info, registryCache: registryCache.clone()})
 	return registryCache, nil
 }
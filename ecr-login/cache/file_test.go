@@ -14,8 +14,11 @@
 package cache
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -104,6 +107,48 @@ func TestCredentialsPublic(t *testing.T) {
 	assert.Nil(t, entry)
 }
 
+func TestCredentialsPublicRegistryName(t *testing.T) {
+	credentialCache := NewFileCredentialsCache(t.TempDir(), testFilename, testCachePrefixKey, testPublicCacheKey, testLegacyCachePrefixKey, testLegacyPublicCacheKey)
+	name := PublicRegistryName("us-west-2", "https://ecr-public.example.com")
+
+	credentialCache.Set(name, &testPublicAuthEntry)
+	assert.Nil(t, credentialCache.GetPublic(), "tokens of other regions and endpoints should not replace the default one")
+	assert.NotNil(t, credentialCache.Get(name))
+	assert.Nil(t, credentialCache.Get(PublicRegistryName("us-west-2", "")))
+
+	entries := credentialCache.(EntryManager).Entries()
+	assert.Contains(t, entries, testPublicCacheKey+"@us-west-2@https://ecr-public.example.com")
+	assert.False(t, IsLegacyKey(testPublicCacheKey+"@us-west-2@https://ecr-public.example.com"))
+}
+
+func TestDeleteCredentials(t *testing.T) {
+	credentialCache := NewFileCredentialsCache(t.TempDir(), testFilename, testCachePrefixKey, testPublicCacheKey, testLegacyCachePrefixKey, testLegacyPublicCacheKey)
+	const otherRegistryName = "otherRegistry"
+	publicName := PublicRegistryName("us-west-2", "")
+
+	registryCache := newRegistryCache()
+	registryCache.Registries[testLegacyCachePrefixKey+testRegistryName] = &testAuthEntry
+	registryCache.Registries[testLegacyPublicCacheKey] = &testPublicAuthEntry
+	credentialCache.(*fileCredentialCache).save(registryCache)
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set(otherRegistryName, &testAuthEntry)
+	credentialCache.Set(PublicRegistry, &testPublicAuthEntry)
+	credentialCache.Set(publicName, &testPublicAuthEntry)
+
+	credentialCache.Delete(testRegistryName)
+	assert.Nil(t, credentialCache.Get(testRegistryName), "legacy entries should be deleted too")
+	assert.NotNil(t, credentialCache.Get(otherRegistryName))
+	assert.NotNil(t, credentialCache.GetPublic())
+
+	credentialCache.Delete(publicName)
+	assert.Nil(t, credentialCache.Get(publicName))
+	assert.NotNil(t, credentialCache.GetPublic())
+
+	credentialCache.Delete(PublicRegistry)
+	assert.Nil(t, credentialCache.GetPublic(), "legacy entries should be deleted too")
+	assert.Len(t, credentialCache.List(), 1)
+}
+
 func TestPreviousVersionCache(t *testing.T) {
 	credentialCache := NewFileCredentialsCache(testPath, testFilename, testCachePrefixKey, testPublicCacheKey, testLegacyCachePrefixKey, testLegacyPublicCacheKey)
 
@@ -278,3 +323,66 @@ func TestFipsModeWithNewKey(t *testing.T) {
 	assert.NotNil(t, entry, "Should find credentials with SHA-256 key in FIPS mode")
 	assert.Equal(t, testAuthEntry.AuthorizationToken, entry.AuthorizationToken)
 }
+
+func TestParsedCacheReused(t *testing.T) {
+	dir := t.TempDir()
+	credentialCache := NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+
+	// overwrite the file in place, keeping its size and modification time
+	path := filepath.Join(dir, testFilename)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.Write(make([]byte, info.Size()))
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+
+	otherCache := NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+	assert.NotNil(t, otherCache.Get(testRegistryName), "the unchanged file should not be parsed again")
+
+	// replace the file, as another process saving the cache does
+	registryCache := newRegistryCache()
+	registryCache.Registries[testCachePrefixKey+"otherRegistry"] = &testAuthEntry
+	data, err := json.Marshal(registryCache)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path+".tmp", data, 0600))
+	assert.NoError(t, os.Rename(path+".tmp", path))
+
+	assert.Nil(t, credentialCache.Get(testRegistryName), "the replaced file should be parsed again")
+	assert.NotNil(t, credentialCache.Get("otherRegistry"))
+
+	entry := credentialCache.Get("otherRegistry")
+	entry.AuthorizationToken = "modified"
+	assert.Equal(t, testAuthEntry.AuthorizationToken, credentialCache.Get("otherRegistry").AuthorizationToken,
+		"entries of the parsed cache should not be shared")
+
+	credentialCache.Clear()
+	assert.Nil(t, credentialCache.Get("otherRegistry"))
+}
+
+func TestFileCacheConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each goroutine uses its own cache, as each client does
+			credentialCache := NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+			registry := fmt.Sprintf("registry-%d", i)
+			entry := testAuthEntry
+			credentialCache.Set(registry, &entry)
+			for j := 0; j < 10; j++ {
+				assert.NotNil(t, credentialCache.Get(registry))
+				credentialCache.List()
+			}
+		}()
+	}
+	wg.Wait()
+
+	credentialCache := NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+	assert.Len(t, credentialCache.List(), 8)
+}
@@ -0,0 +1,66 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// lockTimeout bounds how long the file cache waits for other processes to
+// release the cache lock before carrying on as if there was no cache.
+var lockTimeout = 5 * time.Second
+
+const lockRetryInterval = 10 * time.Millisecond
+
+var errLockTimeout = errors.New("timed out waiting for the cache lock")
+
+// fileLock is an advisory lock held on a lock file next to the cache file.
+// A separate file is used because the cache file itself is replaced on every
+// save.
+type fileLock struct {
+	file *os.File
+}
+
+// acquireLock takes a shared or exclusive lock on the file at path, creating
+// it if needed, and waits at most lockTimeout for it to become available.
+func acquireLock(path string, exclusive bool) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if locked {
+			return &fileLock{file: file}, nil
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, errLockTimeout
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *fileLock) release() {
+	unlockFile(l.file)
+	l.file.Close()
+}
@@ -0,0 +1,135 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	lockHelperDirEnv    = "ECR_CACHE_LOCK_HELPER_DIR"
+	lockHelperWriterEnv = "ECR_CACHE_LOCK_HELPER_WRITER"
+
+	stressWriters       = 8
+	stressProcesses     = 4
+	stressEntriesPerRun = 10
+)
+
+func newStressCache(dir string) CredentialsCache {
+	return NewFileCredentialsCache(dir, testFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+}
+
+func writeStressEntries(credentialCache CredentialsCache, writer string) {
+	for i := 0; i < stressEntriesPerRun; i++ {
+		entry := testAuthEntry
+		credentialCache.Set(fmt.Sprintf("%s-%d", writer, i), &entry)
+	}
+}
+
+// TestLockHelperProcess is not a real test; it is run as a subprocess by
+// TestFileCacheConcurrentWriters to write to the cache from another process.
+func TestLockHelperProcess(t *testing.T) {
+	dir := os.Getenv(lockHelperDirEnv)
+	if dir == "" {
+		t.Skip("only run as a subprocess")
+	}
+	writeStressEntries(newStressCache(dir), os.Getenv(lockHelperWriterEnv))
+}
+
+func TestFileCacheConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+
+	var processes []*exec.Cmd
+	for i := 0; i < stressProcesses; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+		cmd.Env = append(os.Environ(),
+			lockHelperDirEnv+"="+dir,
+			fmt.Sprintf("%s=process%d", lockHelperWriterEnv, i))
+		assert.NoError(t, cmd.Start())
+		processes = append(processes, cmd)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < stressWriters; i++ {
+		wg.Add(1)
+		go func(writer string) {
+			defer wg.Done()
+			// each writer has its own cache, like separate helper invocations
+			writeStressEntries(newStressCache(dir), writer)
+		}(fmt.Sprintf("goroutine%d", i))
+	}
+	wg.Wait()
+	for _, cmd := range processes {
+		assert.NoError(t, cmd.Wait())
+	}
+
+	entries := newStressCache(dir).(*fileCredentialCache).Entries()
+	assert.Len(t, entries, (stressWriters+stressProcesses)*stressEntriesPerRun)
+	for i := 0; i < stressProcesses; i++ {
+		for j := 0; j < stressEntriesPerRun; j++ {
+			assert.Contains(t, entries, fmt.Sprintf("%sprocess%d-%d", testCachePrefixKey, i, j))
+		}
+	}
+	for i := 0; i < stressWriters; i++ {
+		for j := 0; j < stressEntriesPerRun; j++ {
+			assert.Contains(t, entries, fmt.Sprintf("%sgoroutine%d-%d", testCachePrefixKey, i, j))
+		}
+	}
+}
+
+func TestFileCacheLockTimeout(t *testing.T) {
+	dir := t.TempDir()
+	credentialCache := newStressCache(dir)
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+
+	defaultTimeout := lockTimeout
+	lockTimeout = 50 * time.Millisecond
+	defer func() { lockTimeout = defaultTimeout }()
+
+	lock, err := acquireLock(filepath.Join(dir, testFilename+".lock"), true)
+	assert.NoError(t, err)
+
+	// the cache is ignored rather than blocking the helper
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+	credentialCache.Set("other", &testAuthEntry)
+
+	lock.release()
+
+	assert.NotNil(t, credentialCache.Get(testRegistryName))
+	assert.Nil(t, credentialCache.Get("other"))
+}
+
+func TestAcquireSharedLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	first, err := acquireLock(path, false)
+	assert.NoError(t, err)
+	second, err := acquireLock(path, false)
+	assert.NoError(t, err)
+
+	first.release()
+	second.release()
+
+	exclusive, err := acquireLock(path, true)
+	assert.NoError(t, err)
+	exclusive.release()
+}
@@ -0,0 +1,128 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// CacheFilename is the name of the file cache within the cache directory.
+const CacheFilename = "cache.json"
+
+// EntryManager is implemented by credentials caches whose entries can be
+// managed as a whole, regardless of the credentials they are scoped to.
+type EntryManager interface {
+	// Entries returns every cached entry by its cache key.
+	Entries() map[string]*AuthEntry
+	// Remove deletes the entries stored under the given cache keys.
+	Remove(keys ...string) error
+}
+
+// OpenFileCredentialsCache returns the file cache stored in cacheDir without
+// scoping it to any credentials. It is intended for tools that inspect or
+// manage the cache and can only be used through List, Clear and the
+// EntryManager interface.
+func OpenFileCredentialsCache(cacheDir string) (CredentialsCache, error) {
+	cacheDir, err := homedir.Expand(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("cache: could not expand cache path: %w", err)
+	}
+	return newFileCache(cacheDir, "", "", "", "")
+}
+
+// FileCacheVersion returns the format version of the file cache stored in
+// cacheDir, or an empty string if there is no cache file yet. It fails if the
+// file is corrupt or in a format this version of the helper cannot read.
+func FileCacheVersion(cacheDir string) (string, error) {
+	cacheDir, err := homedir.Expand(cacheDir)
+	if err != nil {
+		return "", fmt.Errorf("cache: could not expand cache path: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(cacheDir, CacheFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cache: %w", err)
+	}
+	var header struct{ Version string }
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", fmt.Errorf("cache: %s is corrupt: %w", CacheFilename, err)
+	}
+	switch header.Version {
+	case registryCacheVersion, sealedCacheVersion:
+		return header.Version, nil
+	}
+	return header.Version, fmt.Errorf("cache: %s has unsupported version %q", CacheFilename, header.Version)
+}
+
+// AccessKeyHash returns the hash of an access key ID that the file cache
+// scopes its entries to.
+func AccessKeyHash(accessKeyID string) string {
+	return checksum(accessKeyID)
+}
+
+// Prune removes expired entries and entries stored under legacy MD5-based
+// keys, and returns the keys of the removed entries in sorted order.
+func Prune(entries EntryManager, now time.Time) ([]string, error) {
+	var keys []string
+	for key, entry := range entries.Entries() {
+		if IsLegacyKey(key) || !now.Before(entry.ExpiresAt) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Strings(keys)
+	return keys, entries.Remove(keys...)
+}
+
+// IsLegacyKey reports whether a cache key was derived from the legacy MD5
+// checksum of an access key, as produced by md5Checksum.
+func IsLegacyKey(key string) bool {
+	var hash string
+	if rest, ok := strings.CutPrefix(key, string(ServiceECRPublic)+"-"); ok {
+		hash = rest
+	} else {
+		// Private registry keys are "<region>-<hash>-<registry ID>", and the
+		// base64 hash never contains a dash.
+		parts := strings.Split(key, "-")
+		if len(parts) < 3 {
+			return false
+		}
+		hash = parts[len(parts)-2]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return false
+	}
+	// md5Checksum appends the digest of an empty input to the access key
+	// rather than hashing it.
+	emptyDigest := md5.Sum(nil)
+	return len(decoded) > len(emptyDigest) && bytes.HasSuffix(decoded, emptyDigest[:])
+}
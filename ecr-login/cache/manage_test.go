@@ -0,0 +1,136 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLegacyKey(t *testing.T) {
+	credentials := aws.Credentials{AccessKeyID: testAccessKey}
+
+	testCases := []struct {
+		key      string
+		expected bool
+	}{
+		{legacyCredentialsCachePrefix(testRegion, credentials) + "123456789012", true},
+		{legacyCredentialsPublicCacheKey(credentials), true},
+		{credentialsCachePrefix(testRegion, credentials) + "123456789012", false},
+		{credentialsPublicCacheKey(credentials), false},
+		{identityCachePrefix(testRegion, "arn:aws:iam::123456789012:role/pull") + "123456789012", false},
+		{fmt.Sprintf("us-east-1-%s-123456789012", testLegacyCredentialHash), true},
+		{"testRegistry", false},
+		{"us-east-1-not*base64-123456789012", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsLegacyKey(tc.key))
+		})
+	}
+}
+
+func TestEntriesAndRemove(t *testing.T) {
+	credentialCache := NewFileCredentialsCache(t.TempDir(), testFilename, testCachePrefixKey, testPublicCacheKey, testLegacyCachePrefixKey, testLegacyPublicCacheKey)
+	credentialCache.Set("111111111111", &testAuthEntry)
+	credentialCache.Set("222222222222", &testAuthEntry)
+	credentialCache.Set("public", &testPublicAuthEntry)
+
+	manager := credentialCache.(EntryManager)
+	entries := manager.Entries()
+	assert.Len(t, entries, 3)
+	assert.Contains(t, entries, testCachePrefixKey+"111111111111")
+	assert.Contains(t, entries, testPublicCacheKey)
+
+	assert.NoError(t, manager.Remove(testCachePrefixKey+"111111111111", "missing"))
+	entries = manager.Entries()
+	assert.Len(t, entries, 2)
+	assert.NotContains(t, entries, testCachePrefixKey+"111111111111")
+	assert.Nil(t, credentialCache.Get("111111111111"))
+	assert.NotNil(t, credentialCache.Get("222222222222"))
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	credentials := aws.Credentials{AccessKeyID: testAccessKey}
+	currentPrefix := credentialsCachePrefix(testRegion, credentials)
+	legacyKey := legacyCredentialsCachePrefix(testRegion, credentials) + "333333333333"
+
+	credentialCache := NewFileCredentialsCache(t.TempDir(), testFilename, currentPrefix, credentialsPublicCacheKey(credentials), "", "")
+	fileCache := credentialCache.(*fileCredentialCache)
+
+	expired := testAuthEntry
+	expired.RequestedAt = now.Add(-13 * time.Hour)
+	expired.ExpiresAt = now.Add(-time.Hour)
+
+	registryCache := newRegistryCache()
+	registryCache.Registries[currentPrefix+"111111111111"] = &testAuthEntry
+	registryCache.Registries[currentPrefix+"222222222222"] = &expired
+	registryCache.Registries[legacyKey] = &testAuthEntry
+	assert.NoError(t, fileCache.save(registryCache))
+
+	removed, err := Prune(fileCache, now)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{currentPrefix + "222222222222", legacyKey}, removed)
+
+	entries := fileCache.Entries()
+	assert.Len(t, entries, 1)
+	assert.Contains(t, entries, currentPrefix+"111111111111")
+
+	removed, err = Prune(fileCache, now)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestOpenFileCredentialsCache(t *testing.T) {
+	dir := t.TempDir()
+	scoped := NewFileCredentialsCache(dir, CacheFilename, testCachePrefixKey, testPublicCacheKey, "", "")
+	scoped.Set(testRegistryName, &testAuthEntry)
+
+	credentialCache, err := OpenFileCredentialsCache(dir)
+	assert.NoError(t, err)
+	assert.Len(t, credentialCache.List(), 1)
+	assert.Contains(t, credentialCache.(EntryManager).Entries(), testCachePrefixKey+testRegistryName)
+}
+
+func TestFileCacheVersion(t *testing.T) {
+	dir := t.TempDir()
+	version, err := FileCacheVersion(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, version, "there is no cache file yet")
+
+	NewFileCredentialsCache(dir, CacheFilename, testCachePrefixKey, testPublicCacheKey, "", "").Set(testRegistryName, &testAuthEntry)
+	version, err = FileCacheVersion(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, registryCacheVersion, version)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, CacheFilename), []byte(`{"Version": "0.1"}`), 0600))
+	_, err = FileCacheVersion(dir)
+	assert.ErrorContains(t, err, "unsupported version")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, CacheFilename), []byte("{nope"), 0600))
+	_, err = FileCacheVersion(dir)
+	assert.ErrorContains(t, err, "corrupt")
+}
+
+func TestAccessKeyHash(t *testing.T) {
+	assert.Equal(t, testCredentialHash, AccessKeyHash(testAccessKey))
+}
@@ -0,0 +1,103 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"sync"
+)
+
+// memoryPublicCacheKey is the key of the ECR Public entry in a memory cache.
+const memoryPublicCacheKey = string(ServiceECRPublic)
+
+type memoryCredentialsCache struct {
+	mu      sync.RWMutex
+	entries map[string]*AuthEntry
+}
+
+// NewMemoryCredentialsCache returns a credentials cache that is held in
+// memory and is safe for concurrent use. Its entries are not scoped to any
+// credentials.
+func NewMemoryCredentialsCache() CredentialsCache {
+	return &memoryCredentialsCache{entries: make(map[string]*AuthEntry)}
+}
+
+func (m *memoryCredentialsCache) Get(registry string) *AuthEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if isPublicRegistryName(registry) {
+		return m.entries[publicKey(memoryPublicCacheKey, registry)]
+	}
+	return m.entries[registry]
+}
+
+func (m *memoryCredentialsCache) GetPublic() *AuthEntry {
+	return m.Get(memoryPublicCacheKey)
+}
+
+func (m *memoryCredentialsCache) Set(registry string, entry *AuthEntry) {
+	key := registry
+	if entry.Service == ServiceECRPublic {
+		key = publicKey(memoryPublicCacheKey, registry)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = entry
+}
+
+func (m *memoryCredentialsCache) Delete(registry string) {
+	key := registry
+	if isPublicRegistryName(registry) {
+		key = publicKey(memoryPublicCacheKey, registry)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *memoryCredentialsCache) List() []*AuthEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]*AuthEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (m *memoryCredentialsCache) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]*AuthEntry)
+}
+
+// Entries returns a copy of the stored AuthEntries by cache key
+func (m *memoryCredentialsCache) Entries() map[string]*AuthEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make(map[string]*AuthEntry, len(m.entries))
+	for key, entry := range m.entries {
+		entries[key] = entry
+	}
+	return entries
+}
+
+// Remove deletes the AuthEntries stored under the given cache keys
+func (m *memoryCredentialsCache) Remove(keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	credentialCache := NewMemoryCredentialsCache()
+
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+	assert.Nil(t, credentialCache.GetPublic())
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set("public.ecr.aws", &testPublicAuthEntry)
+
+	assert.Equal(t, &testAuthEntry, credentialCache.Get(testRegistryName))
+	assert.Equal(t, &testPublicAuthEntry, credentialCache.GetPublic())
+	assert.Nil(t, credentialCache.Get("public.ecr.aws"))
+	assert.Len(t, credentialCache.List(), 2)
+
+	publicName := PublicRegistryName("us-west-2", "")
+	assert.Nil(t, credentialCache.Get(publicName))
+	publicEntry := testPublicAuthEntry
+	credentialCache.Set(publicName, &publicEntry)
+	assert.Same(t, &publicEntry, credentialCache.Get(publicName))
+	assert.Equal(t, &testPublicAuthEntry, credentialCache.GetPublic())
+
+	manager := credentialCache.(EntryManager)
+	assert.NoError(t, manager.Remove(string(ServiceECRPublic)+"@us-west-2"))
+	entries := manager.Entries()
+	assert.Len(t, entries, 2)
+	delete(entries, testRegistryName)
+	assert.NotNil(t, credentialCache.Get(testRegistryName), "Entries should return a copy")
+
+	assert.NoError(t, manager.Remove(testRegistryName))
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+
+	credentialCache.Set(testRegistryName, &testAuthEntry)
+	credentialCache.Set(publicName, &publicEntry)
+	credentialCache.Delete(testRegistryName)
+	credentialCache.Delete(PublicRegistry)
+	assert.Nil(t, credentialCache.Get(testRegistryName))
+	assert.Nil(t, credentialCache.GetPublic())
+	assert.Same(t, &publicEntry, credentialCache.Get(publicName))
+	credentialCache.Delete(publicName)
+	assert.Nil(t, credentialCache.Get(publicName))
+
+	credentialCache.Clear()
+	assert.Empty(t, credentialCache.List())
+}
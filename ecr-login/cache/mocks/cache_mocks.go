@@ -21,6 +21,7 @@ type MockCredentialsCache struct {
 	GetFn       func(registry string) *cache.AuthEntry
 	GetPublicFn func() *cache.AuthEntry
 	SetFn       func(registry string, entry *cache.AuthEntry)
+	DeleteFn    func(registry string)
 	ListFn      func() []*cache.AuthEntry
 	ClearFn     func()
 }
@@ -39,6 +40,10 @@ func (m MockCredentialsCache) Set(registry string, entry *cache.AuthEntry) {
 	m.SetFn(registry, entry)
 }
 
+func (m MockCredentialsCache) Delete(registry string) {
+	m.DeleteFn(registry)
+}
+
 func (m MockCredentialsCache) List() []*cache.AuthEntry {
 	return m.ListFn()
 }
@@ -30,9 +30,20 @@ func (n *nullCredentialsCache) GetPublic() *AuthEntry {
 func (n *nullCredentialsCache) Set(_ string, _ *AuthEntry) {
 }
 
+func (n *nullCredentialsCache) Delete(_ string) {
+}
+
 func (n *nullCredentialsCache) List() []*AuthEntry {
 	return []*AuthEntry{}
 }
 
 func (n *nullCredentialsCache) Clear() {
 }
+
+func (n *nullCredentialsCache) Entries() map[string]*AuthEntry {
+	return map[string]*AuthEntry{}
+}
+
+func (n *nullCredentialsCache) Remove(_ ...string) error {
+	return nil
+}
@@ -30,8 +30,13 @@ func TestNullCache(t *testing.T) {
 	entry = credentialCache.Get(testRegistryName)
 	assert.Nil(t, entry)
 
+	credentialCache.Delete(testRegistryName)
 	credentialCache.Clear()
 
 	entries := credentialCache.List()
 	assert.Empty(t, entries)
+
+	manager := credentialCache.(EntryManager)
+	assert.Empty(t, manager.Entries())
+	assert.NoError(t, manager.Remove(testRegistryName))
 }
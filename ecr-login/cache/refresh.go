@@ -0,0 +1,112 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RefreshPolicy decides when a cached token is refreshed. The zero value
+// refreshes tokens after half of their validity window.
+type RefreshPolicy struct {
+	// Fraction is the fraction of a token's validity window, between 0 and 1,
+	// after which it is refreshed.
+	Fraction float64
+	// Margin refreshes tokens this long before they expire. It replaces the
+	// default Fraction, and cannot be combined with an explicit one.
+	Margin time.Duration
+	// MinRemaining additionally refreshes tokens with less than this much of
+	// their lifetime left, for callers that need tokens to outlast a long
+	// operation.
+	MinRemaining time.Duration
+}
+
+// IsZero reports whether p is the zero value, i.e. the default policy.
+func (p RefreshPolicy) IsZero() bool {
+	return p == RefreshPolicy{}
+}
+
+// Validate checks that the fields of p are consistent.
+func (p RefreshPolicy) Validate() error {
+	if p.Fraction < 0 || p.Fraction > 1 {
+		return fmt.Errorf("cache: refresh fraction %v is not between 0 and 1", p.Fraction)
+	}
+	if p.Margin < 0 || p.MinRemaining < 0 {
+		return fmt.Errorf("cache: refresh durations cannot be negative")
+	}
+	if p.Fraction != 0 && p.Margin != 0 {
+		return fmt.Errorf("cache: refresh fraction and margin cannot be combined")
+	}
+	return nil
+}
+
+// RefreshAt returns when entry should be refreshed.
+func (p RefreshPolicy) RefreshAt(entry *AuthEntry) time.Time {
+	var refreshAt time.Time
+	if p.Margin != 0 {
+		refreshAt = entry.ExpiresAt.Add(-p.Margin)
+	} else if p.Fraction != 0 {
+		validWindow := entry.ExpiresAt.Sub(entry.RequestedAt)
+		refreshAt = entry.RequestedAt.Add(time.Duration(float64(validWindow) * p.Fraction))
+	} else {
+		validWindow := entry.ExpiresAt.Sub(entry.RequestedAt)
+		refreshAt = entry.ExpiresAt.Add(-1 * validWindow / time.Duration(2))
+	}
+	if p.MinRemaining != 0 {
+		if minRefreshAt := entry.ExpiresAt.Add(-p.MinRemaining); minRefreshAt.Before(refreshAt) {
+			refreshAt = minRefreshAt
+		}
+	}
+	return refreshAt
+}
+
+// IsValid reports whether entry can still be used at testTime.
+func (p RefreshPolicy) IsValid(entry *AuthEntry, testTime time.Time) bool {
+	return testTime.Before(p.RefreshAt(entry))
+}
+
+// RefreshPolicyFromEnv returns the refresh policy set with the
+// AWS_ECR_TOKEN_REFRESH_FRACTION, AWS_ECR_TOKEN_REFRESH_MARGIN and
+// AWS_ECR_TOKEN_MIN_REMAINING environment variables.
+func RefreshPolicyFromEnv() (RefreshPolicy, error) {
+	var policy RefreshPolicy
+	if value := os.Getenv("AWS_ECR_TOKEN_REFRESH_FRACTION"); value != "" {
+		fraction, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return RefreshPolicy{}, fmt.Errorf("cache: invalid AWS_ECR_TOKEN_REFRESH_FRACTION: %w", err)
+		}
+		policy.Fraction = fraction
+	}
+	if value := os.Getenv("AWS_ECR_TOKEN_REFRESH_MARGIN"); value != "" {
+		margin, err := time.ParseDuration(value)
+		if err != nil {
+			return RefreshPolicy{}, fmt.Errorf("cache: invalid AWS_ECR_TOKEN_REFRESH_MARGIN: %w", err)
+		}
+		policy.Margin = margin
+	}
+	if value := os.Getenv("AWS_ECR_TOKEN_MIN_REMAINING"); value != "" {
+		minRemaining, err := time.ParseDuration(value)
+		if err != nil {
+			return RefreshPolicy{}, fmt.Errorf("cache: invalid AWS_ECR_TOKEN_MIN_REMAINING: %w", err)
+		}
+		policy.MinRemaining = minRemaining
+	}
+	if err := policy.Validate(); err != nil {
+		return RefreshPolicy{}, err
+	}
+	return policy, nil
+}
@@ -0,0 +1,95 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshPolicyRefreshAt(t *testing.T) {
+	requestedAt := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	entry := &AuthEntry{
+		RequestedAt: requestedAt,
+		ExpiresAt:   requestedAt.Add(12 * time.Hour),
+	}
+
+	testCases := []struct {
+		name     string
+		policy   RefreshPolicy
+		expected time.Duration
+	}{
+		{name: "default", expected: 6 * time.Hour},
+		{name: "fraction", policy: RefreshPolicy{Fraction: 0.75}, expected: 9 * time.Hour},
+		{name: "margin", policy: RefreshPolicy{Margin: 30 * time.Minute}, expected: 11*time.Hour + 30*time.Minute},
+		{name: "min remaining longer than half-life", policy: RefreshPolicy{MinRemaining: 8 * time.Hour}, expected: 4 * time.Hour},
+		{name: "min remaining shorter than half-life", policy: RefreshPolicy{MinRemaining: 2 * time.Hour}, expected: 6 * time.Hour},
+		{name: "fraction and min remaining", policy: RefreshPolicy{Fraction: 0.9, MinRemaining: 2 * time.Hour}, expected: 10 * time.Hour},
+		{name: "margin and min remaining", policy: RefreshPolicy{Margin: time.Hour, MinRemaining: 3 * time.Hour}, expected: 9 * time.Hour},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			refreshAt := requestedAt.Add(tc.expected)
+			assert.Equal(t, refreshAt, tc.policy.RefreshAt(entry))
+			assert.True(t, tc.policy.IsValid(entry, refreshAt.Add(-time.Second)))
+			assert.False(t, tc.policy.IsValid(entry, refreshAt))
+		})
+	}
+}
+
+func TestRefreshPolicyValidate(t *testing.T) {
+	assert.NoError(t, RefreshPolicy{}.Validate())
+	assert.NoError(t, RefreshPolicy{Fraction: 1, MinRemaining: time.Hour}.Validate())
+	assert.Error(t, RefreshPolicy{Fraction: 1.5}.Validate())
+	assert.Error(t, RefreshPolicy{Fraction: -0.5}.Validate())
+	assert.Error(t, RefreshPolicy{Margin: -time.Hour}.Validate())
+	assert.Error(t, RefreshPolicy{Fraction: 0.5, Margin: time.Hour}.Validate())
+}
+
+func TestRefreshPolicyFromEnv(t *testing.T) {
+	testCases := []struct {
+		name         string
+		fraction     string
+		margin       string
+		minRemaining string
+		expected     RefreshPolicy
+		expectedErr  bool
+	}{
+		{name: "unset"},
+		{name: "fraction", fraction: "0.8", expected: RefreshPolicy{Fraction: 0.8}},
+		{name: "margin", margin: "45m", expected: RefreshPolicy{Margin: 45 * time.Minute}},
+		{name: "min remaining", minRemaining: "3h", expected: RefreshPolicy{MinRemaining: 3 * time.Hour}},
+		{name: "invalid fraction", fraction: "half", expectedErr: true},
+		{name: "invalid margin", margin: "1 hour", expectedErr: true},
+		{name: "invalid min remaining", minRemaining: "soon", expectedErr: true},
+		{name: "fraction and margin", fraction: "0.8", margin: "1h", expectedErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AWS_ECR_TOKEN_REFRESH_FRACTION", tc.fraction)
+			t.Setenv("AWS_ECR_TOKEN_REFRESH_MARGIN", tc.margin)
+			t.Setenv("AWS_ECR_TOKEN_MIN_REMAINING", tc.minRemaining)
+
+			policy, err := RefreshPolicyFromEnv()
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, policy)
+		})
+	}
+}
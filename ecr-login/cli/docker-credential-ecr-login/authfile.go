@@ -0,0 +1,207 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// authFile is a registry auth file in the format shared by Docker
+// (config.json), containers/image (auth.json) and Helm
+// (registry/config.json). Only the entries under "auths" are decoded, and
+// everything else in the file is written back as it was read.
+type authFile struct {
+	path string
+	// data is the contents of the file when it was loaded
+	data   []byte
+	fields map[string]json.RawMessage
+	auths  map[string]json.RawMessage
+}
+
+// authFileEntry is the entry of a registry under "auths".
+type authFileEntry struct {
+	Auth string `json:"auth"`
+	// ExpiresAt records when the token in Auth expires, so that it can be
+	// refreshed before then. Tools reading the file ignore it.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func newAuthFileEntry(username, password string, expiresAt time.Time) *authFileEntry {
+	entry := &authFileEntry{Auth: base64.StdEncoding.EncodeToString([]byte(username + ":" + password))}
+	if !expiresAt.IsZero() {
+		expiresAt = expiresAt.UTC()
+		entry.ExpiresAt = &expiresAt
+	}
+	return entry
+}
+
+// loadAuthFile reads the auth file at path. A missing file is treated as an
+// empty one, but a file that cannot be parsed is an error so that it is never
+// overwritten.
+func loadAuthFile(path string) (*authFile, error) {
+	f := &authFile{
+		path:   path,
+		fields: make(map[string]json.RawMessage),
+		auths:  make(map[string]json.RawMessage),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.data = data
+	if strings.TrimSpace(string(data)) == "" {
+		return f, nil
+	}
+	if err := json.Unmarshal(data, &f.fields); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", path, err)
+	}
+	if f.fields == nil {
+		f.fields = make(map[string]json.RawMessage)
+	}
+	if auths, ok := f.fields["auths"]; ok {
+		if err := json.Unmarshal(auths, &f.auths); err != nil {
+			return nil, fmt.Errorf("%s has invalid auths: %w", path, err)
+		}
+		if f.auths == nil {
+			f.auths = make(map[string]json.RawMessage)
+		}
+	}
+	return f, nil
+}
+
+// entry returns the entry of host, or nil if there is none or it cannot be
+// parsed.
+func (f *authFile) entry(host string) *authFileEntry {
+	raw, ok := f.auths[host]
+	if !ok {
+		return nil
+	}
+	var entry authFileEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+func (f *authFile) setEntry(host string, entry *authFileEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.auths[host] = raw
+	return nil
+}
+
+func (f *authFile) removeAuth(host string) {
+	delete(f.auths, host)
+}
+
+// credHelpers returns the credential helpers configured per registry in a
+// Docker configuration file.
+func (f *authFile) credHelpers() (map[string]string, error) {
+	helpers := make(map[string]string)
+	if raw, ok := f.fields["credHelpers"]; ok {
+		if err := json.Unmarshal(raw, &helpers); err != nil {
+			return nil, fmt.Errorf("%s has invalid credHelpers: %w", f.path, err)
+		}
+	}
+	return helpers, nil
+}
+
+// stringField returns a top-level string field of the file, or an empty
+// string if it is missing or not a string.
+func (f *authFile) stringField(name string) string {
+	var value string
+	if raw, ok := f.fields[name]; ok {
+		json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+// setField sets a top-level field of the file.
+func (f *authFile) setField(name string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	f.fields[name] = raw
+	return nil
+}
+
+// marshal returns the contents of the file with its changes.
+func (f *authFile) marshal() ([]byte, error) {
+	if len(f.auths) == 0 {
+		delete(f.fields, "auths")
+	} else {
+		auths, err := json.Marshal(f.auths)
+		if err != nil {
+			return nil, err
+		}
+		f.fields["auths"] = auths
+	}
+	data, err := json.MarshalIndent(f.fields, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// save writes the file atomically, readable by the current user only.
+func (f *authFile) save() error {
+	data, err := f.marshal()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data, 0600)
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers see
+// either the old or the new contents but never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
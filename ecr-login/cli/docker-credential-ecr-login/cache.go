@@ -0,0 +1,268 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+const cacheUsage = `usage: docker-credential-ecr-login cache <command> [flags]
+
+Commands:
+  list                      list cached tokens
+  inspect <registry>        show the cached tokens of a registry
+  prune                     remove expired tokens and tokens stored under legacy keys
+  clear [--registry <id>]   remove all cached tokens, or those of a registry
+`
+
+// managedCache is a credentials cache whose entries can be managed
+// regardless of the AWS credentials they belong to.
+type managedCache interface {
+	cache.CredentialsCache
+	cache.EntryManager
+}
+
+// cacheEntryInfo describes a cached token without revealing it.
+type cacheEntryInfo struct {
+	Key           string    `json:"key"`
+	Registry      string    `json:"registry"`
+	Service       string    `json:"service"`
+	ProxyEndpoint string    `json:"proxyEndpoint"`
+	RequestedAt   time.Time `json:"requestedAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Valid         bool      `json:"valid"`
+	Legacy        bool      `json:"legacy"`
+}
+
+// runCache implements the cache management subcommands.
+func runCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing cache command\n%s", cacheUsage)
+	}
+
+	credentialsCache, err := cache.OpenFileCredentialsCache(config.GetCacheDir())
+	if err != nil {
+		return err
+	}
+	managed, ok := credentialsCache.(managedCache)
+	if !ok {
+		return fmt.Errorf("cache: %T cannot be managed", credentialsCache)
+	}
+	policy, err := cache.RefreshPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	return cacheCommand(managed, policy, args, os.Stdout, time.Now())
+}
+
+// cacheCommand runs a cache management subcommand. Tokens are reported as
+// valid according to policy, as they are when the helper looks them up.
+func cacheCommand(credentialsCache managedCache, policy cache.RefreshPolicy, args []string, out io.Writer, now time.Time) error {
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("cache "+command, flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "print JSON instead of a table")
+	var registry string
+	if command == "clear" {
+		flags.StringVar(&registry, "registry", "", "only remove the tokens of this registry")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch command {
+	case "list":
+		if flags.NArg() != 0 {
+			return fmt.Errorf("cache list: unexpected arguments %q", flags.Args())
+		}
+		return printCacheEntries(out, cacheEntries(credentialsCache, policy, now), *jsonOutput)
+	case "inspect":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("cache inspect: expected a single registry")
+		}
+		entries := filterCacheEntries(cacheEntries(credentialsCache, policy, now), flags.Arg(0))
+		if len(entries) == 0 {
+			return fmt.Errorf("cache inspect: no cached tokens for %s", flags.Arg(0))
+		}
+		if *jsonOutput {
+			return printJSON(out, entries)
+		}
+		return inspectCacheEntries(out, entries)
+	case "prune":
+		if flags.NArg() != 0 {
+			return fmt.Errorf("cache prune: unexpected arguments %q", flags.Args())
+		}
+		removed, err := cache.Prune(credentialsCache, now)
+		if err != nil {
+			return fmt.Errorf("cache prune: %w", err)
+		}
+		return printCacheResult(out, "pruned", removed, *jsonOutput)
+	case "clear":
+		if flags.NArg() != 0 {
+			return fmt.Errorf("cache clear: unexpected arguments %q", flags.Args())
+		}
+		return clearCache(out, credentialsCache, policy, registry, now, *jsonOutput)
+	}
+	return fmt.Errorf("unknown cache command %q\n%s", command, cacheUsage)
+}
+
+// cacheEntries describes every entry of the cache, sorted by registry.
+func cacheEntries(credentialsCache managedCache, policy cache.RefreshPolicy, now time.Time) []cacheEntryInfo {
+	var infos []cacheEntryInfo
+	for key, entry := range credentialsCache.Entries() {
+		infos = append(infos, cacheEntryInfo{
+			Key:           key,
+			Registry:      entryRegistry(entry),
+			Service:       string(entry.Service),
+			ProxyEndpoint: entry.ProxyEndpoint,
+			RequestedAt:   entry.RequestedAt,
+			ExpiresAt:     entry.ExpiresAt,
+			Valid:         policy.IsValid(entry, now),
+			Legacy:        cache.IsLegacyKey(key),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Registry != infos[j].Registry {
+			return infos[i].Registry < infos[j].Registry
+		}
+		return infos[i].Key < infos[j].Key
+	})
+	return infos
+}
+
+// entryRegistry returns the registry ID of a cached ECR token, or the
+// hostname of a cached ECR Public token.
+func entryRegistry(entry *cache.AuthEntry) string {
+	registry, err := api.ExtractRegistry(entry.ProxyEndpoint)
+	if err != nil {
+		return ""
+	}
+	if registry.Service == api.ServiceECRPublic {
+		return registry.Name
+	}
+	return registry.ID
+}
+
+// filterCacheEntries returns the entries of registry, given either as a
+// registry ID or as a registry hostname.
+func filterCacheEntries(entries []cacheEntryInfo, registry string) []cacheEntryInfo {
+	if parsed, err := api.ExtractRegistry(registry); err == nil {
+		if parsed.Service == api.ServiceECRPublic {
+			registry = parsed.Name
+		} else {
+			registry = parsed.ID
+		}
+	}
+	var filtered []cacheEntryInfo
+	for _, entry := range entries {
+		if entry.Registry == registry {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func clearCache(out io.Writer, credentialsCache managedCache, policy cache.RefreshPolicy, registry string, now time.Time, jsonOutput bool) error {
+	if registry == "" {
+		var keys []string
+		for _, entry := range cacheEntries(credentialsCache, policy, now) {
+			keys = append(keys, entry.Key)
+		}
+		credentialsCache.Clear()
+		return printCacheResult(out, "cleared", keys, jsonOutput)
+	}
+
+	var keys []string
+	for _, entry := range filterCacheEntries(cacheEntries(credentialsCache, policy, now), registry) {
+		keys = append(keys, entry.Key)
+	}
+	if len(keys) > 0 {
+		if err := credentialsCache.Remove(keys...); err != nil {
+			return fmt.Errorf("cache clear: %w", err)
+		}
+	}
+	return printCacheResult(out, "cleared", keys, jsonOutput)
+}
+
+func printCacheEntries(out io.Writer, entries []cacheEntryInfo, jsonOutput bool) error {
+	if jsonOutput {
+		if entries == nil {
+			entries = []cacheEntryInfo{}
+		}
+		return printJSON(out, entries)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGISTRY\tSERVICE\tPROXY ENDPOINT\tREQUESTED AT\tEXPIRES AT\tVALID")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n",
+			entry.Registry,
+			entry.Service,
+			entry.ProxyEndpoint,
+			formatTime(entry.RequestedAt),
+			formatTime(entry.ExpiresAt),
+			entry.Valid)
+	}
+	return w.Flush()
+}
+
+func inspectCacheEntries(out io.Writer, entries []cacheEntryInfo) error {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	for i, entry := range entries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Key:\t%s\n", entry.Key)
+		fmt.Fprintf(w, "Registry:\t%s\n", entry.Registry)
+		fmt.Fprintf(w, "Service:\t%s\n", entry.Service)
+		fmt.Fprintf(w, "Proxy endpoint:\t%s\n", entry.ProxyEndpoint)
+		fmt.Fprintf(w, "Requested at:\t%s\n", formatTime(entry.RequestedAt))
+		fmt.Fprintf(w, "Expires at:\t%s\n", formatTime(entry.ExpiresAt))
+		fmt.Fprintf(w, "Valid:\t%t\n", entry.Valid)
+		fmt.Fprintf(w, "Legacy key:\t%t\n", entry.Legacy)
+	}
+	return w.Flush()
+}
+
+// printCacheResult reports the keys removed from the cache.
+func printCacheResult(out io.Writer, action string, keys []string, jsonOutput bool) error {
+	if jsonOutput {
+		if keys == nil {
+			keys = []string{}
+		}
+		return printJSON(out, map[string][]string{action: keys})
+	}
+	_, err := fmt.Fprintf(out, "%s %d cached token(s)\n", action, len(keys))
+	return err
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,210 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCachePrefix = "us-west-2-c2hhMjU2-"
+	testPublicKey   = "ecr-public-c2hhMjU2"
+	// "AKID" followed by the MD5 digest of an empty input, as produced by the
+	// legacy cache key functions
+	testLegacyPrefix = "us-west-2-QUtJRNQdjNmPALIE6YAJmOz4Qn4=-"
+	testSecretToken  = "QVdTOnN1cGVyc2VjcmV0" // AWS:supersecret
+)
+
+// newTestCache returns a file cache holding a valid and an expired ECR
+// token, an ECR Public token and a token stored under a legacy key.
+func newTestCache(t *testing.T) managedCache {
+	t.Helper()
+	dir := t.TempDir()
+
+	scoped := cache.NewFileCredentialsCache(dir, cache.CacheFilename, testCachePrefix, testPublicKey, "", "")
+	scoped.Set("111111111111", &cache.AuthEntry{
+		AuthorizationToken: testSecretToken,
+		RequestedAt:        testNow.Add(-time.Hour),
+		ExpiresAt:          testNow.Add(11 * time.Hour),
+		ProxyEndpoint:      "https://111111111111.dkr.ecr.us-west-2.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+	scoped.Set("222222222222", &cache.AuthEntry{
+		AuthorizationToken: testSecretToken,
+		RequestedAt:        testNow.Add(-13 * time.Hour),
+		ExpiresAt:          testNow.Add(-time.Hour),
+		ProxyEndpoint:      "https://222222222222.dkr.ecr.us-west-2.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+	scoped.Set("public.ecr.aws", &cache.AuthEntry{
+		AuthorizationToken: testSecretToken,
+		RequestedAt:        testNow.Add(-time.Hour),
+		ExpiresAt:          testNow.Add(11 * time.Hour),
+		ProxyEndpoint:      "https://public.ecr.aws",
+		Service:            cache.ServiceECRPublic,
+	})
+	legacy := cache.NewFileCredentialsCache(dir, cache.CacheFilename, testLegacyPrefix, "", "", "")
+	legacy.Set("333333333333", &cache.AuthEntry{
+		AuthorizationToken: testSecretToken,
+		RequestedAt:        testNow.Add(-time.Hour),
+		ExpiresAt:          testNow.Add(11 * time.Hour),
+		ProxyEndpoint:      "https://333333333333.dkr.ecr.us-west-2.amazonaws.com",
+		Service:            cache.ServiceECR,
+	})
+
+	credentialsCache, err := cache.OpenFileCredentialsCache(dir)
+	assert.NoError(t, err)
+	return credentialsCache.(managedCache)
+}
+
+func TestCacheListTable(t *testing.T) {
+	var out bytes.Buffer
+	err := cacheCommand(newTestCache(t), cache.RefreshPolicy{}, []string{"list"}, &out, testNow)
+	assert.NoError(t, err)
+
+	expected := `REGISTRY        SERVICE     PROXY ENDPOINT                                        REQUESTED AT          EXPIRES AT            VALID
+111111111111    ecr         https://111111111111.dkr.ecr.us-west-2.amazonaws.com  2024-01-02T02:04:05Z  2024-01-02T14:04:05Z  true
+222222222222    ecr         https://222222222222.dkr.ecr.us-west-2.amazonaws.com  2024-01-01T14:04:05Z  2024-01-02T02:04:05Z  false
+333333333333    ecr         https://333333333333.dkr.ecr.us-west-2.amazonaws.com  2024-01-02T02:04:05Z  2024-01-02T14:04:05Z  true
+public.ecr.aws  ecr-public  https://public.ecr.aws                                2024-01-02T02:04:05Z  2024-01-02T14:04:05Z  true
+`
+	assert.Equal(t, expected, out.String())
+	assert.NotContains(t, out.String(), testSecretToken)
+}
+
+func TestCacheListJSON(t *testing.T) {
+	var out bytes.Buffer
+	err := cacheCommand(newTestCache(t), cache.RefreshPolicy{}, []string{"list", "--json"}, &out, testNow)
+	assert.NoError(t, err)
+	assert.NotContains(t, out.String(), testSecretToken)
+
+	var entries []cacheEntryInfo
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entries))
+	assert.Len(t, entries, 4)
+	assert.Equal(t, cacheEntryInfo{
+		Key:           testCachePrefix + "111111111111",
+		Registry:      "111111111111",
+		Service:       "ecr",
+		ProxyEndpoint: "https://111111111111.dkr.ecr.us-west-2.amazonaws.com",
+		RequestedAt:   testNow.Add(-time.Hour),
+		ExpiresAt:     testNow.Add(11 * time.Hour),
+		Valid:         true,
+	}, entries[0])
+	assert.True(t, entries[2].Legacy)
+}
+
+func TestCacheListRefreshPolicy(t *testing.T) {
+	var out bytes.Buffer
+	policy := cache.RefreshPolicy{MinRemaining: 12 * time.Hour}
+	err := cacheCommand(newTestCache(t), policy, []string{"inspect", "--json", "111111111111"}, &out, testNow)
+	assert.NoError(t, err)
+
+	var entries []cacheEntryInfo
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entries))
+	if assert.Len(t, entries, 1) {
+		assert.False(t, entries[0].Valid, "tokens the helper would refresh should not be reported as valid")
+	}
+}
+
+func TestCacheListEmptyJSON(t *testing.T) {
+	credentialsCache, err := cache.OpenFileCredentialsCache(t.TempDir())
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	err = cacheCommand(credentialsCache.(managedCache), cache.RefreshPolicy{}, []string{"list", "--json"}, &out, testNow)
+	assert.NoError(t, err)
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestCacheInspect(t *testing.T) {
+	credentialsCache := newTestCache(t)
+
+	for _, registry := range []string{"111111111111", "111111111111.dkr.ecr.us-west-2.amazonaws.com", "https://111111111111.dkr.ecr.us-west-2.amazonaws.com/repo"} {
+		var out bytes.Buffer
+		err := cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"inspect", registry}, &out, testNow)
+		assert.NoError(t, err)
+		assert.Equal(t, `Key:            us-west-2-c2hhMjU2-111111111111
+Registry:       111111111111
+Service:        ecr
+Proxy endpoint: https://111111111111.dkr.ecr.us-west-2.amazonaws.com
+Requested at:   2024-01-02T02:04:05Z
+Expires at:     2024-01-02T14:04:05Z
+Valid:          true
+Legacy key:     false
+`, out.String())
+	}
+
+	err := cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"inspect", "444444444444"}, &bytes.Buffer{}, testNow)
+	assert.Error(t, err)
+	err = cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"inspect"}, &bytes.Buffer{}, testNow)
+	assert.Error(t, err)
+}
+
+func TestCachePrune(t *testing.T) {
+	credentialsCache := newTestCache(t)
+
+	var out bytes.Buffer
+	err := cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"prune", "--json"}, &out, testNow)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"pruned": ["`+testLegacyPrefix+`333333333333", "`+testCachePrefix+`222222222222"]}`, out.String())
+
+	entries := credentialsCache.Entries()
+	assert.Len(t, entries, 2)
+	assert.Contains(t, entries, testCachePrefix+"111111111111")
+	assert.Contains(t, entries, testPublicKey)
+}
+
+func TestCacheClearRegistry(t *testing.T) {
+	credentialsCache := newTestCache(t)
+
+	var out bytes.Buffer
+	err := cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"clear", "--registry", "public.ecr.aws"}, &out, testNow)
+	assert.NoError(t, err)
+	assert.Equal(t, "cleared 1 cached token(s)\n", out.String())
+
+	entries := credentialsCache.Entries()
+	assert.Len(t, entries, 3)
+	assert.NotContains(t, entries, testPublicKey)
+}
+
+func TestCacheClearAll(t *testing.T) {
+	credentialsCache := newTestCache(t)
+
+	var out bytes.Buffer
+	err := cacheCommand(credentialsCache, cache.RefreshPolicy{}, []string{"clear"}, &out, testNow)
+	assert.NoError(t, err)
+	assert.Equal(t, "cleared 4 cached token(s)\n", out.String())
+	assert.Empty(t, credentialsCache.Entries())
+}
+
+func TestCacheUnknownCommand(t *testing.T) {
+	err := cacheCommand(newTestCache(t), cache.RefreshPolicy{}, []string{"explode"}, &bytes.Buffer{}, testNow)
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "usage"))
+}
+
+func TestLegacyTestPrefix(t *testing.T) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.Split(testLegacyPrefix, "-")[3])
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(decoded, []byte("AKID")))
+	assert.True(t, cache.IsLegacyKey(testLegacyPrefix+"333333333333"))
+}
@@ -0,0 +1,155 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mitchellh/go-homedir"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+)
+
+// ecrLoginHelper is the name Docker knows this credential helper by.
+const ecrLoginHelper = "ecr-login"
+
+// runConfigure sets up the Docker configuration file to use this credential
+// helper.
+func runConfigure(args []string) error {
+	return configureCommand(ecr.NewECRHelper(), args, os.Stdout)
+}
+
+func configureCommand(resolver api.RegistryResolver, args []string, out io.Writer) error {
+	defaultPath, err := defaultAuthFilePath(authFormatDocker)
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("configure", flag.ContinueOnError)
+	var registries stringList
+	flags.Var(&registries, "registry", "registry to use the helper for, comma separated or repeated")
+	allECR := flags.Bool("all-ecr", false, "use the helper for every registry by setting credsStore")
+	configPath := flags.String("config", defaultPath, "path of the Docker configuration file")
+	removeAuths := flags.Bool("remove-auths", false, "remove auths entries of the configured registries, which may shadow the helper")
+	dryRun := flags.Bool("dry-run", false, "print the changes as a diff instead of writing them")
+	force := flags.Bool("force", false, "replace the credsStore of another credential helper with --all-ecr")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("configure: unexpected arguments %q", flags.Args())
+	}
+	if len(registries) == 0 && !*allECR {
+		return fmt.Errorf("configure: no registries given, use --registry or --all-ecr")
+	}
+
+	hosts := make(map[string]bool)
+	for _, registry := range registries {
+		host := imageHost(registry)
+		if _, err := resolver.ResolveRegistry(host); err != nil {
+			return fmt.Errorf("configure: %w", err)
+		}
+		hosts[host] = true
+	}
+	// isConfigured tells whether the credentials of host come from the helper
+	// once the file is updated.
+	isConfigured := func(host string) bool {
+		if hosts[host] {
+			return true
+		}
+		if !*allECR {
+			return false
+		}
+		_, err := resolver.ResolveRegistry(host)
+		return err == nil
+	}
+
+	path, err := homedir.Expand(*configPath)
+	if err != nil {
+		return fmt.Errorf("configure: %w", err)
+	}
+	file, err := loadAuthFile(path)
+	if err != nil {
+		return fmt.Errorf("configure: %w", err)
+	}
+
+	if len(hosts) > 0 {
+		helpers, err := file.credHelpers()
+		if err != nil {
+			return fmt.Errorf("configure: %w", err)
+		}
+		for host := range hosts {
+			helpers[host] = ecrLoginHelper
+		}
+		if err := file.setField("credHelpers", helpers); err != nil {
+			return err
+		}
+	}
+	if *allECR {
+		if previous := file.stringField("credsStore"); previous != "" && previous != ecrLoginHelper {
+			if !*force {
+				return fmt.Errorf("configure: %s already uses the %q credential helper for all registries; "+
+					"set AWS_ECR_FALLBACK_HELPER=%s to keep its credentials, and pass --force to replace it", path, previous, previous)
+			}
+			fmt.Fprintf(out, "warning: replacing credsStore %q, set AWS_ECR_FALLBACK_HELPER=%s to keep its credentials\n", previous, previous)
+		}
+		if err := file.setField("credsStore", ecrLoginHelper); err != nil {
+			return err
+		}
+	}
+	var conflicts []string
+	for key := range file.auths {
+		if isConfigured(imageHost(key)) {
+			conflicts = append(conflicts, key)
+		}
+	}
+	sort.Strings(conflicts)
+	for _, key := range conflicts {
+		if *removeAuths {
+			file.removeAuth(key)
+		} else {
+			fmt.Fprintf(out, "warning: auths has an entry for %s, which may shadow the credential helper; remove it with --remove-auths\n", key)
+		}
+	}
+
+	data, err := file.marshal()
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, file.data) {
+		fmt.Fprintf(out, "%s is already configured\n", path)
+		return nil
+	}
+	if *dryRun {
+		return writeUnifiedDiff(out, path, string(file.data), string(data))
+	}
+
+	if file.data != nil {
+		backup := path + ".bak"
+		if err := writeFileAtomic(backup, file.data, 0600); err != nil {
+			return fmt.Errorf("configure: could not back up %s: %w", path, err)
+		}
+		fmt.Fprintf(out, "Saved a backup of %s to %s\n", path, backup)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("configure: could not write %s: %w", path, err)
+	}
+	fmt.Fprintf(out, "Configured %s\n", path)
+	return nil
+}
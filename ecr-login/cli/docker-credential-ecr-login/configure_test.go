@@ -0,0 +1,181 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDockerConfig = `{
+	"auths": {
+		"ghcr.io": {"auth": "Z2hjcjp0b2tlbg=="},
+		"https://123456789012.dkr.ecr.us-west-2.amazonaws.com": {"auth": "QVdTOnN0YWxl"},
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com": {"auth": "QVdTOnN0YWxl"}
+	},
+	"credHelpers": {"gcr.io": "gcloud"},
+	"psFormat": "table {{.ID}}"
+}
+`
+
+func writeDockerConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestConfigureNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".docker", "config.json")
+	var out bytes.Buffer
+	err := configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--registry", testRegistryHost + ",public.ecr.aws"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "Configured "+path+"\n", out.String())
+	assert.Equal(t, `{
+	"credHelpers": {
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com": "ecr-login",
+		"public.ecr.aws": "ecr-login"
+	}
+}
+`, readFile(t, path))
+	_, err = os.Stat(path + ".bak")
+	assert.True(t, os.IsNotExist(err), "there is nothing to back up")
+}
+
+func TestConfigureRegistry(t *testing.T) {
+	path := writeDockerConfig(t, testDockerConfig)
+	var out bytes.Buffer
+	err := configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--registry", testRegistryHost}, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "warning: auths has an entry for https://"+testRegistryHost)
+	assert.NotContains(t, out.String(), "210987654321")
+	assert.Equal(t, testDockerConfig, readFile(t, path+".bak"))
+	assert.JSONEq(t, `{
+	"auths": {
+		"ghcr.io": {"auth": "Z2hjcjp0b2tlbg=="},
+		"https://123456789012.dkr.ecr.us-west-2.amazonaws.com": {"auth": "QVdTOnN0YWxl"},
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com": {"auth": "QVdTOnN0YWxl"}
+	},
+	"credHelpers": {"gcr.io": "gcloud", "123456789012.dkr.ecr.us-west-2.amazonaws.com": "ecr-login"},
+	"psFormat": "table {{.ID}}"
+}`, readFile(t, path))
+
+	// conflicting entries are only removed on request
+	out.Reset()
+	err = configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--registry", testRegistryHost, "--remove-auths"}, &out)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+	"auths": {
+		"ghcr.io": {"auth": "Z2hjcjp0b2tlbg=="},
+		"210987654321.dkr.ecr.eu-west-1.amazonaws.com": {"auth": "QVdTOnN0YWxl"}
+	},
+	"credHelpers": {"gcr.io": "gcloud", "123456789012.dkr.ecr.us-west-2.amazonaws.com": "ecr-login"},
+	"psFormat": "table {{.ID}}"
+}`, readFile(t, path))
+
+	out.Reset()
+	err = configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--registry", testRegistryHost}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, path+" is already configured\n", out.String())
+}
+
+func TestConfigureAllECR(t *testing.T) {
+	path := writeDockerConfig(t, testDockerConfig)
+	var out bytes.Buffer
+	err := configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--all-ecr", "--remove-auths"}, &out)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+	"auths": {"ghcr.io": {"auth": "Z2hjcjp0b2tlbg=="}},
+	"credHelpers": {"gcr.io": "gcloud"},
+	"credsStore": "ecr-login",
+	"psFormat": "table {{.ID}}"
+}`, readFile(t, path))
+}
+
+func TestConfigureAllECRReplacesCredsStore(t *testing.T) {
+	config := `{"credsStore": "desktop"}`
+	path := writeDockerConfig(t, config)
+
+	err := configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--all-ecr"}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, `"desktop"`)
+	assert.ErrorContains(t, err, "--force")
+	assert.Equal(t, config, readFile(t, path), "the file should be left as it is without --force")
+
+	var out bytes.Buffer
+	err = configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--all-ecr", "--force"}, &out)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), `warning: replacing credsStore "desktop", set AWS_ECR_FALLBACK_HELPER=desktop`)
+	assert.JSONEq(t, `{"credsStore": "ecr-login"}`, readFile(t, path))
+}
+
+func TestConfigureDryRun(t *testing.T) {
+	config := `{
+	"auths": {
+		"https://123456789012.dkr.ecr.us-west-2.amazonaws.com": {
+			"auth": "QVdTOnN0YWxl"
+		}
+	}
+}
+`
+	path := writeDockerConfig(t, config)
+	var out bytes.Buffer
+	err := configureCommand(api.DefaultRegistryResolver, []string{"--config", path, "--registry", testRegistryHost, "--remove-auths", "--dry-run"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, `--- `+path+`
++++ `+path+`
+@@ -1,7 +1,5 @@
+ {
+-	"auths": {
+-		"https://123456789012.dkr.ecr.us-west-2.amazonaws.com": {
+-			"auth": "QVdTOnN0YWxl"
+-		}
++	"credHelpers": {
++		"123456789012.dkr.ecr.us-west-2.amazonaws.com": "ecr-login"
+ 	}
+ }
+`, out.String())
+	assert.Equal(t, config, readFile(t, path))
+	_, err = os.Stat(path + ".bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConfigureErrors(t *testing.T) {
+	invalid := writeDockerConfig(t, "{nope")
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "no registries", args: []string{"--config", invalid}},
+		{name: "not ECR", args: []string{"--config", invalid, "--registry", "registry.example.com"}},
+		{name: "invalid file", args: []string{"--config", invalid, "--registry", testRegistryHost}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, configureCommand(api.DefaultRegistryResolver, tc.args, &bytes.Buffer{}))
+		})
+	}
+	assert.Equal(t, "{nope", readFile(t, invalid))
+}
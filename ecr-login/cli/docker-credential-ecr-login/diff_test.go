@@ -0,0 +1,65 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	lines := func(from, to int) string {
+		var b strings.Builder
+		for i := from; i <= to; i++ {
+			b.WriteString(strings.Repeat("x", i) + "\n")
+		}
+		return b.String()
+	}
+
+	testCases := []struct {
+		name     string
+		before   string
+		after    string
+		expected string
+	}{{
+		name:   "same",
+		before: "a\nb\n",
+		after:  "a\nb\n",
+	}, {
+		name:     "new file",
+		after:    "a\nb\n",
+		expected: "--- f\n+++ f\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+	}, {
+		name:     "removed file",
+		before:   "a\n",
+		expected: "--- f\n+++ f\n@@ -1,1 +0,0 @@\n-a\n",
+	}, {
+		name:   "separate hunks",
+		before: lines(1, 20),
+		after:  "changed\n" + lines(2, 19) + "changed\n",
+		expected: "--- f\n+++ f\n" +
+			"@@ -1,4 +1,4 @@\n-x\n+changed\n xx\n xxx\n xxxx\n" +
+			"@@ -17,4 +17,4 @@\n " + strings.Repeat("x", 17) + "\n " + strings.Repeat("x", 18) + "\n " + strings.Repeat("x", 19) + "\n-" + strings.Repeat("x", 20) + "\n+changed\n",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.NoError(t, writeUnifiedDiff(&out, "f", tc.before, tc.after))
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/mitchellh/go-homedir"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/version"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+// doctorCheck is the outcome of one stage of getting credentials.
+type doctorCheck struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Hint   string      `json:"hint,omitempty"`
+}
+
+type doctorReport struct {
+	Registry string        `json:"registry,omitempty"`
+	Checks   []doctorCheck `json:"checks"`
+}
+
+func (r *doctorReport) add(name string, status checkStatus, detail string, hint string) {
+	r.Checks = append(r.Checks, doctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+}
+
+func (r *doctorReport) failures() int {
+	failures := 0
+	for _, check := range r.Checks {
+		if check.Status == checkFail {
+			failures++
+		}
+	}
+	return failures
+}
+
+// doctor walks through each stage of getting credentials for a registry. It
+// never reveals credentials: AWS identities are shown by the hash of their
+// access key ID, which is also how the file cache refers to them.
+type doctor struct {
+	ctx              context.Context
+	configFile       string
+	cacheDir         string
+	cacheDisabled    bool
+	dockerConfigFile string
+	clientFactory    api.ClientFactory
+	// loadAWSConfig loads the AWS configuration used for registry, which is
+	// nil when no registry is being diagnosed.
+	loadAWSConfig func(ctx context.Context, registry *api.Registry, registryConfig *config.RegistryConfig) (aws.Config, error)
+}
+
+// runDoctor diagnoses why credentials cannot be found for a registry.
+func runDoctor(args []string) error {
+	dockerConfigFile, err := defaultAuthFilePath(authFormatDocker)
+	if err != nil {
+		return err
+	}
+	d := &doctor{
+		ctx:              context.Background(),
+		configFile:       config.GetConfigFile(),
+		cacheDir:         config.GetCacheDir(),
+		cacheDisabled:    os.Getenv("AWS_ECR_DISABLE_CACHE") != "",
+		dockerConfigFile: dockerConfigFile,
+		// API calls are made without the cache to test reachability
+		clientFactory: api.DefaultClientFactory{Cache: cache.NewNullCredentialsCache()},
+		loadAWSConfig: loadDoctorAWSConfig,
+	}
+	return d.command(args, os.Stdout)
+}
+
+func loadDoctorAWSConfig(ctx context.Context, registry *api.Registry, registryConfig *config.RegistryConfig) (aws.Config, error) {
+	if registry != nil && registryConfig != nil {
+		return api.LoadConfigForRegistry(ctx, registry, registryConfig)
+	}
+	var loadOptions []func(*awsconfig.LoadOptions) error
+	if registry != nil && registry.Region != "" {
+		loadOptions = append(loadOptions, awsconfig.WithRegion(registry.Region))
+	}
+	if registry != nil && registry.FIPS {
+		loadOptions = append(loadOptions, awsconfig.WithEndpointDiscovery(aws.EndpointDiscoveryEnabled))
+	}
+	return awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+}
+
+func (d *doctor) command(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "print JSON instead of a report")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return fmt.Errorf("doctor: expected at most one registry")
+	}
+
+	report := d.run(flags.Arg(0))
+	if *jsonOutput {
+		if err := printJSON(out, report); err != nil {
+			return err
+		}
+	} else if err := printDoctorReport(out, report); err != nil {
+		return err
+	}
+	if failures := report.failures(); failures > 0 {
+		return fmt.Errorf("doctor: %d of %d checks failed", failures, len(report.Checks))
+	}
+	return nil
+}
+
+func (d *doctor) run(registryArg string) *doctorReport {
+	report := &doctorReport{}
+	report.add("version", checkPass, fmt.Sprintf("%s (%s), %s/%s", version.Version, version.GitCommitSHA, runtime.GOOS, runtime.GOARCH), "")
+
+	helperConfig, configErr := config.LoadFile(d.configFile)
+	if configErr != nil {
+		report.add("config file", checkFail, configErr.Error(), "fix or remove "+d.configFile)
+	} else {
+		report.add("config file", checkPass, fmt.Sprintf("%s, %d registries, %d aliases", d.configFile, len(helperConfig.Registries), len(helperConfig.Aliases)), "")
+	}
+
+	host := imageHost(registryArg)
+	if registryArg != "" {
+		report.Registry = host
+	}
+	var registry *api.Registry
+	var registryConfig *config.RegistryConfig
+	switch {
+	case registryArg == "":
+		report.add("registry", checkSkip, "no registry given", "")
+	case configErr != nil:
+		report.add("registry", checkSkip, "needs a valid config file", "")
+	default:
+		var err error
+		registry, err = ecr.NewECRHelper(ecr.WithConfig(helperConfig)).ResolveRegistry(host)
+		if err != nil {
+			report.add("registry", checkFail, err.Error(),
+				"ECR registries look like <account>.dkr.ecr.<region>.amazonaws.com; other hostnames need an alias in the config file or AWS_ECR_REGISTRY_ALIASES")
+			break
+		}
+		registryConfig = helperConfig.RegistryConfigFor(host, registry.ID, registry.Region)
+		if registry.Service == api.ServiceECRPublic {
+			// the ECR Public API is called in the region of its endpoint
+			registry.Region = api.ECRPublicRegion(doctorEndpoints(helperConfig))
+		}
+		report.add("registry", checkPass, describeRegistry(registry), "")
+	}
+
+	awsConfig := d.checkAWS(report, registry, registryConfig)
+	d.checkCache(report)
+
+	switch {
+	case registry == nil:
+		report.add("ecr api", checkSkip, "needs a registry", "")
+	case awsConfig == nil:
+		report.add("ecr api", checkSkip, "needs AWS credentials", "")
+	default:
+		d.checkAPI(report, host, registry, *awsConfig, doctorEndpoints(helperConfig))
+	}
+	d.checkDockerConfig(report, host)
+	return report
+}
+
+// checkAWS checks that the AWS configuration and credentials can be loaded,
+// and returns the configuration if they can.
+func (d *doctor) checkAWS(report *doctorReport, registry *api.Registry, registryConfig *config.RegistryConfig) *aws.Config {
+	awsConfig, err := d.loadAWSConfig(d.ctx, registry, registryConfig)
+	if err != nil {
+		report.add("aws config", checkFail, err.Error(), "check ~/.aws/config and the AWS_PROFILE and AWS_REGION environment variables")
+		report.add("aws credentials", checkSkip, "needs the AWS config", "")
+		return nil
+	}
+	detail := "region " + awsConfig.Region
+	if registryConfig != nil {
+		if registryConfig.Profile != "" {
+			detail += ", profile " + registryConfig.Profile + " from the config file"
+		}
+		if registryConfig.RoleARN != "" {
+			detail += ", role " + registryConfig.RoleARN
+		}
+	} else if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		detail += ", profile " + profile
+	}
+	if awsConfig.Region == "" {
+		report.add("aws config", checkWarn, "no region", "set AWS_REGION or a region in ~/.aws/config")
+	} else {
+		report.add("aws config", checkPass, detail, "")
+	}
+
+	if awsConfig.Credentials == nil {
+		report.add("aws credentials", checkFail, "no credentials provider", "configure AWS credentials, see https://docs.aws.amazon.com/sdkref/latest/guide/standardized-credentials.html")
+		return nil
+	}
+	creds, err := awsConfig.Credentials.Retrieve(d.ctx)
+	if err != nil {
+		report.add("aws credentials", checkFail, err.Error(), "configure AWS credentials, see https://docs.aws.amazon.com/sdkref/latest/guide/standardized-credentials.html")
+		return nil
+	}
+	detail = "access key hash " + cache.AccessKeyHash(creds.AccessKeyID)
+	if creds.Source != "" {
+		detail += ", source " + creds.Source
+	}
+	if creds.CanExpire {
+		detail += ", expires " + formatTime(creds.Expires)
+	}
+	report.add("aws credentials", checkPass, detail, "")
+	return &awsConfig
+}
+
+func (d *doctor) checkCache(report *doctorReport) {
+	if d.cacheDisabled {
+		report.add("cache", checkSkip, "disabled with AWS_ECR_DISABLE_CACHE", "")
+		return
+	}
+	cacheDir, err := homedir.Expand(d.cacheDir)
+	if err != nil {
+		report.add("cache", checkFail, err.Error(), "set AWS_ECR_CACHE_DIR to a valid directory")
+		return
+	}
+	info, err := os.Stat(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		report.add("cache", checkPass, cacheDir+" will be created when needed", "")
+		return
+	}
+	if err != nil {
+		report.add("cache", checkFail, err.Error(), "check the permissions of "+cacheDir)
+		return
+	}
+	if !info.IsDir() {
+		report.add("cache", checkFail, cacheDir+" is not a directory", "remove it or set AWS_ECR_CACHE_DIR")
+		return
+	}
+	probe, err := os.CreateTemp(cacheDir, ".doctor-*")
+	if err != nil {
+		report.add("cache", checkFail, cacheDir+" is not writable: "+err.Error(), "check the permissions of "+cacheDir)
+		return
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	cacheVersion, err := cache.FileCacheVersion(cacheDir)
+	if err != nil {
+		report.add("cache", checkFail, err.Error(), "remove the cached tokens with `docker-credential-ecr-login cache clear`")
+		return
+	}
+	if cacheVersion == "" {
+		cacheVersion = "empty"
+	}
+	detail := fmt.Sprintf("%s, version %s", filepath.Join(cacheDir, cache.CacheFilename), cacheVersion)
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0022 != 0 {
+		report.add("cache", checkWarn, detail+", writable by other users", "run `chmod go-w "+cacheDir+"`")
+		return
+	}
+	report.add("cache", checkPass, detail, "")
+}
+
+// checkAPI gets a token for registry with a client set up like those of the
+// helper, using the same endpoints and CA bundle.
+func (d *doctor) checkAPI(report *doctorReport, host string, registry *api.Registry, awsConfig aws.Config, endpoints config.Endpoints) {
+	client, err := d.clientFactory.NewClientWithOptions(d.ctx, api.Options{Config: awsConfig, Endpoints: endpoints})
+	if err != nil {
+		report.add("ecr api", checkFail, err.Error(), "")
+		return
+	}
+	var auth *api.Auth
+	if registry.Service == api.ServiceECRPublic {
+		auth, err = client.GetCredentials(d.ctx, host)
+	} else {
+		auth, err = client.GetCredentialsByRegistryID(d.ctx, registry.ID)
+	}
+	if err != nil {
+		report.add("ecr api", checkFail, err.Error(), apiErrorHint(err))
+		return
+	}
+	report.add("ecr api", checkPass, "GetAuthorizationToken succeeded, token expires "+formatTime(auth.ExpiresAt), "")
+}
+
+func apiErrorHint(err error) string {
+	switch {
+	case errors.Is(err, api.ErrAccessDenied):
+		return "allow ecr:GetAuthorizationToken (and ecr-public:GetAuthorizationToken and sts:GetServiceBearerToken for ECR Public) in the IAM policy of the identity"
+	case errors.Is(err, api.ErrAWSCredentials):
+		return "the AWS credentials are invalid or expired, refresh them"
+	case errors.Is(err, api.ErrAWSConfig):
+		return "fix the AWS configuration: the shared config file, the profile and the CA bundle"
+	case errors.Is(err, api.ErrThrottled):
+		return "requests are being throttled, retry later or use the token cache"
+	case errors.Is(err, api.ErrServiceUnavailable):
+		return "check network access to the ECR endpoint of the region, including proxies and VPC endpoints"
+	}
+	return ""
+}
+
+func (d *doctor) checkDockerConfig(report *doctorReport, host string) {
+	path, err := homedir.Expand(d.dockerConfigFile)
+	if err != nil {
+		report.add("docker config", checkFail, err.Error(), "")
+		return
+	}
+	file, err := loadAuthFile(path)
+	if err != nil {
+		report.add("docker config", checkFail, err.Error(), "fix "+path+" or set it up with `docker-credential-ecr-login configure`")
+		return
+	}
+	if file.data == nil {
+		report.add("docker config", checkWarn, path+" does not exist", "set it up with `docker-credential-ecr-login configure`")
+		return
+	}
+	helpers, err := file.credHelpers()
+	if err != nil {
+		report.add("docker config", checkFail, err.Error(), "")
+		return
+	}
+	credsStore := file.stringField("credsStore")
+	if host == "" {
+		if credsStore == ecrLoginHelper {
+			report.add("docker config", checkPass, path+" uses the helper for all registries", "")
+			return
+		}
+		for _, helper := range helpers {
+			if helper == ecrLoginHelper {
+				report.add("docker config", checkPass, path+" uses the helper for some registries", "")
+				return
+			}
+		}
+		report.add("docker config", checkWarn, path+" does not use the helper", "set it up with `docker-credential-ecr-login configure`")
+		return
+	}
+
+	for key := range file.auths {
+		if imageHost(key) == host {
+			report.add("docker config", checkWarn, path+" has an auths entry for "+host+" that may shadow the helper",
+				"run `docker-credential-ecr-login configure --registry "+host+" --remove-auths`")
+			return
+		}
+	}
+	switch helper, ok := helpers[host]; {
+	case ok && helper == ecrLoginHelper:
+		report.add("docker config", checkPass, path+" uses the helper for "+host, "")
+	case ok:
+		report.add("docker config", checkWarn, path+" uses docker-credential-"+helper+" for "+host,
+			"run `docker-credential-ecr-login configure --registry "+host+"`")
+	case credsStore == ecrLoginHelper:
+		report.add("docker config", checkPass, path+" uses the helper for all registries", "")
+	default:
+		report.add("docker config", checkWarn, path+" does not use the helper for "+host,
+			"run `docker-credential-ecr-login configure --registry "+host+"`")
+	}
+}
+
+// doctorEndpoints returns the endpoints the helper uses with helperConfig,
+// which are those of the environment unless the file sets some.
+func doctorEndpoints(helperConfig *config.File) config.Endpoints {
+	if !helperConfig.Endpoints.IsZero() {
+		return helperConfig.Endpoints
+	}
+	endpoints, _ := config.EndpointsFromEnv()
+	return endpoints
+}
+
+func describeRegistry(registry *api.Registry) string {
+	if registry.Service == api.ServiceECRPublic {
+		return fmt.Sprintf("ECR Public %s, region %s", registry.Name, registry.Region)
+	}
+	detail := fmt.Sprintf("account %s, region %s", registry.ID, registry.Region)
+	if registry.FIPS {
+		detail += ", FIPS endpoint"
+	}
+	if registry.Alias != "" {
+		detail += ", alias " + registry.Alias
+	}
+	return detail
+}
+
+func printDoctorReport(out io.Writer, report *doctorReport) error {
+	for _, check := range report.Checks {
+		if _, err := fmt.Fprintf(out, "[%-4s] %s: %s\n", check.Status, check.Name, check.Detail); err != nil {
+			return err
+		}
+		if check.Hint != "" {
+			if _, err := fmt.Fprintf(out, "       hint: %s\n", check.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
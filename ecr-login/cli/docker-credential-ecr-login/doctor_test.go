@@ -0,0 +1,297 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+)
+
+const (
+	testAccessKeyID     = "AKIDDOCTOR"
+	testSecretAccessKey = "doctor-secret"
+)
+
+// newTestDoctor returns a doctor whose checks all pass for testRegistryHost.
+func newTestDoctor(t *testing.T) (*doctor, *mock_api.MockClient) {
+	t.Setenv("AWS_ECR_REGISTRY_ALIASES", "")
+	t.Setenv("AWS_PROFILE", "")
+	dir := t.TempDir()
+	dockerConfigFile := filepath.Join(dir, "docker", "config.json")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(dockerConfigFile), 0700))
+	assert.NoError(t, os.WriteFile(dockerConfigFile, []byte(`{"credHelpers": {"`+testRegistryHost+`": "ecr-login"}}`), 0600))
+	cacheDir := filepath.Join(dir, "ecr")
+	assert.NoError(t, os.MkdirAll(cacheDir, 0700))
+
+	client := &mock_api.MockClient{
+		GetCredentialsByRegistryIDFn: func(_ context.Context, registryID string) (*api.Auth, error) {
+			assert.Equal(t, "123456789012", registryID)
+			return &api.Auth{Username: testUsername, Password: testPassword, ExpiresAt: testNow.Add(12 * time.Hour)}, nil
+		},
+	}
+	return &doctor{
+		ctx:              context.Background(),
+		configFile:       filepath.Join(dir, "config.yaml"),
+		cacheDir:         cacheDir,
+		dockerConfigFile: dockerConfigFile,
+		clientFactory: &mock_api.MockClientFactory{
+			NewClientWithOptionsFn: func(_ context.Context, opts api.Options) (api.Client, error) {
+				assert.Equal(t, "us-west-2", opts.Config.Region)
+				return client, nil
+			},
+		},
+		loadAWSConfig: func(_ context.Context, _ *api.Registry, _ *config.RegistryConfig) (aws.Config, error) {
+			return aws.Config{
+				Region:      "us-west-2",
+				Credentials: credentials.NewStaticCredentialsProvider(testAccessKeyID, testSecretAccessKey, ""),
+			}, nil
+		},
+	}, client
+}
+
+func checkStatuses(report *doctorReport) map[string]checkStatus {
+	statuses := make(map[string]checkStatus)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestDoctorPass(t *testing.T) {
+	d, _ := newTestDoctor(t)
+	var out bytes.Buffer
+	assert.NoError(t, d.command([]string{testRegistryHost}, &out))
+
+	report := out.String()
+	for _, name := range []string{"version", "config file", "registry", "aws config", "aws credentials", "cache", "ecr api", "docker config"} {
+		assert.Contains(t, report, "[pass] "+name+": ")
+	}
+	assert.Contains(t, report, "access key hash "+cache.AccessKeyHash(testAccessKeyID))
+	assert.Contains(t, report, "account 123456789012, region us-west-2")
+	assert.Contains(t, report, "token expires 2024-01-02T15:04:05Z")
+	assert.NotContains(t, report, testAccessKeyID)
+	assert.NotContains(t, report, testSecretAccessKey)
+	assert.NotContains(t, report, testPassword)
+	assert.NotContains(t, report, "hint:")
+}
+
+func TestDoctorJSON(t *testing.T) {
+	d, _ := newTestDoctor(t)
+	var out bytes.Buffer
+	assert.NoError(t, d.command([]string{"--json", "https://" + testRegistryHost + "/v2/"}, &out))
+
+	var report doctorReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, testRegistryHost, report.Registry)
+	assert.Len(t, report.Checks, 8)
+	for _, check := range report.Checks {
+		assert.Equal(t, checkPass, check.Status, check.Name)
+	}
+}
+
+func TestDoctorECRPublicRegion(t *testing.T) {
+	d, client := newTestDoctor(t)
+	t.Setenv("AWS_ECR_PUBLIC_REGION", "")
+	assert.NoError(t, os.WriteFile(d.configFile, []byte("endpoints:\n  ecrPublicRegion: us-west-2\n"), 0600))
+	d.loadAWSConfig = func(_ context.Context, registry *api.Registry, _ *config.RegistryConfig) (aws.Config, error) {
+		assert.Equal(t, "us-west-2", registry.Region, "the region of the ECR Public endpoint should be used")
+		return aws.Config{Region: registry.Region, Credentials: credentials.NewStaticCredentialsProvider(testAccessKeyID, testSecretAccessKey, "")}, nil
+	}
+	client.GetCredentialsFn = func(_ context.Context, serverURL string) (*api.Auth, error) {
+		return &api.Auth{Username: testUsername, Password: testPassword, ExpiresAt: testNow.Add(12 * time.Hour)}, nil
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, d.command([]string{"public.ecr.aws"}, &out))
+	assert.Contains(t, out.String(), "[pass] registry: ECR Public public.ecr.aws, region us-west-2")
+}
+
+func TestDoctorUsesConfiguredEndpoints(t *testing.T) {
+	d, client := newTestDoctor(t)
+	assert.NoError(t, os.WriteFile(d.configFile, []byte("endpoints:\n  ecr: https://vpce.example.com\n  caBundle: /etc/ssl/vpce.pem\n"), 0600))
+	d.clientFactory = &mock_api.MockClientFactory{
+		NewClientWithOptionsFn: func(_ context.Context, opts api.Options) (api.Client, error) {
+			assert.Equal(t, config.Endpoints{ECR: "https://vpce.example.com", CABundle: "/etc/ssl/vpce.pem"}, opts.Endpoints)
+			return client, nil
+		},
+	}
+
+	report := d.run(testRegistryHost)
+	assert.Equal(t, checkPass, checkStatuses(report)["ecr api"])
+}
+
+func TestDoctorWithoutRegistry(t *testing.T) {
+	d, _ := newTestDoctor(t)
+	d.loadAWSConfig = func(_ context.Context, registry *api.Registry, _ *config.RegistryConfig) (aws.Config, error) {
+		assert.Nil(t, registry)
+		return aws.Config{Region: "eu-west-1", Credentials: credentials.NewStaticCredentialsProvider(testAccessKeyID, testSecretAccessKey, "")}, nil
+	}
+	report := d.run("")
+	assert.Equal(t, map[string]checkStatus{
+		"version":         checkPass,
+		"config file":     checkPass,
+		"registry":        checkSkip,
+		"aws config":      checkPass,
+		"aws credentials": checkPass,
+		"cache":           checkPass,
+		"ecr api":         checkSkip,
+		"docker config":   checkPass,
+	}, checkStatuses(report))
+}
+
+func TestDoctorFailures(t *testing.T) {
+	testCases := []struct {
+		name     string
+		registry string
+		setup    func(t *testing.T, d *doctor, client *mock_api.MockClient)
+		check    string
+		status   checkStatus
+		hint     string
+	}{{
+		name:     "not ECR",
+		registry: "registry.example.com",
+		check:    "registry",
+		status:   checkFail,
+		hint:     "alias",
+	}, {
+		name:     "invalid config file",
+		registry: testRegistryHost,
+		setup: func(t *testing.T, d *doctor, _ *mock_api.MockClient) {
+			assert.NoError(t, os.WriteFile(d.configFile, []byte("registries: {nope"), 0600))
+		},
+		check:  "config file",
+		status: checkFail,
+		hint:   "fix or remove",
+	}, {
+		name:     "aws config",
+		registry: testRegistryHost,
+		setup: func(_ *testing.T, d *doctor, _ *mock_api.MockClient) {
+			d.loadAWSConfig = func(context.Context, *api.Registry, *config.RegistryConfig) (aws.Config, error) {
+				return aws.Config{}, errors.New("failed to get shared config profile, missing")
+			}
+		},
+		check:  "aws config",
+		status: checkFail,
+		hint:   "AWS_PROFILE",
+	}, {
+		name:     "aws credentials",
+		registry: testRegistryHost,
+		setup: func(_ *testing.T, d *doctor, _ *mock_api.MockClient) {
+			d.loadAWSConfig = func(context.Context, *api.Registry, *config.RegistryConfig) (aws.Config, error) {
+				return aws.Config{
+					Region: "us-west-2",
+					Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+						return aws.Credentials{}, errors.New("no EC2 IMDS role found")
+					}),
+				}, nil
+			}
+		},
+		check:  "aws credentials",
+		status: checkFail,
+		hint:   "configure AWS credentials",
+	}, {
+		name:     "access denied",
+		registry: testRegistryHost,
+		setup: func(_ *testing.T, _ *doctor, client *mock_api.MockClient) {
+			client.GetCredentialsByRegistryIDFn = func(context.Context, string) (*api.Auth, error) {
+				return nil, fmt.Errorf("%w: %w", api.ErrAccessDenied, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"})
+			}
+		},
+		check:  "ecr api",
+		status: checkFail,
+		hint:   "ecr:GetAuthorizationToken",
+	}, {
+		name:     "unreachable",
+		registry: testRegistryHost,
+		setup: func(_ *testing.T, _ *doctor, client *mock_api.MockClient) {
+			client.GetCredentialsByRegistryIDFn = func(context.Context, string) (*api.Auth, error) {
+				return nil, fmt.Errorf("%w: dial tcp: i/o timeout", api.ErrServiceUnavailable)
+			}
+		},
+		check:  "ecr api",
+		status: checkFail,
+		hint:   "network access",
+	}, {
+		name:     "corrupt cache",
+		registry: testRegistryHost,
+		setup: func(t *testing.T, d *doctor, _ *mock_api.MockClient) {
+			assert.NoError(t, os.WriteFile(filepath.Join(d.cacheDir, cache.CacheFilename), []byte("{nope"), 0600))
+		},
+		check:  "cache",
+		status: checkFail,
+		hint:   "cache clear",
+	}, {
+		name:     "shadowed by auths",
+		registry: testRegistryHost,
+		setup: func(t *testing.T, d *doctor, _ *mock_api.MockClient) {
+			assert.NoError(t, os.WriteFile(d.dockerConfigFile, []byte(`{"auths": {"https://`+testRegistryHost+`": {"auth": "QVdTOnN0YWxl"}}, "credsStore": "ecr-login"}`), 0600))
+		},
+		check:  "docker config",
+		status: checkWarn,
+		hint:   "--remove-auths",
+	}, {
+		name:     "other helper",
+		registry: testRegistryHost,
+		setup: func(t *testing.T, d *doctor, _ *mock_api.MockClient) {
+			assert.NoError(t, os.WriteFile(d.dockerConfigFile, []byte(`{"credsStore": "desktop"}`), 0600))
+		},
+		check:  "docker config",
+		status: checkWarn,
+		hint:   "configure --registry",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, client := newTestDoctor(t)
+			if tc.setup != nil {
+				tc.setup(t, d, client)
+			}
+			var out bytes.Buffer
+			err := d.command([]string{"--json", tc.registry}, &out)
+			if tc.status == checkFail {
+				assert.ErrorContains(t, err, "checks failed")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var report doctorReport
+			assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+			var found bool
+			for _, check := range report.Checks {
+				if check.Name == tc.check {
+					found = true
+					assert.Equal(t, tc.status, check.Status)
+					assert.Contains(t, check.Hint, tc.hint)
+				}
+			}
+			assert.True(t, found, "missing check %s", tc.check)
+		})
+	}
+}
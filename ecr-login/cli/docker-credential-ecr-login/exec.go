@@ -0,0 +1,83 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+)
+
+const execUsage = "usage: docker-credential-ecr-login exec [flags] <registry> -- <command> [args...]"
+
+// exitError reports the exit code of a child process, which the helper exits
+// with in turn.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// runExec runs a command with the credentials of a registry in its
+// environment.
+func runExec(args []string) error {
+	return execCommand(ecr.NewECRHelper(ecr.WithDescriptiveErrors(true)), args, os.Environ(), os.Stdout)
+}
+
+func execCommand(helper authGetter, args []string, environ []string, out io.Writer) error {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	usernameEnv := flags.String("username-env", "REGISTRY_USERNAME", "environment variable holding the username")
+	passwordEnv := flags.String("password-env", "REGISTRY_PASSWORD", "environment variable holding the password")
+	serverEnv := flags.String("server-env", "REGISTRY_SERVER", "environment variable holding the registry hostname")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// flag parsing stops at the registry, so the separator follows it
+	rest := flags.Args()
+	if len(rest) < 3 || rest[1] != "--" {
+		return fmt.Errorf("exec: expected a registry and a command\n%s", execUsage)
+	}
+	host, command := imageHost(rest[0]), rest[2:]
+
+	auth, err := registryAuth(helper, host)
+	if err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(slices.Clone(environ),
+		*usernameEnv+"="+auth.Username,
+		*passwordEnv+"="+auth.Password,
+		*serverEnv+"="+host,
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var childErr *exec.ExitError
+		if errors.As(err, &childErr) && childErr.ExitCode() >= 0 {
+			return &exitError{code: childErr.ExitCode()}
+		}
+		return fmt.Errorf("exec: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const execHelperEnv = "ECR_EXEC_HELPER_EXIT"
+
+// TestExecHelperProcess is the child process run by the exec tests. It
+// prints the registry variables of its environment and exits with the code
+// in ECR_EXEC_HELPER_EXIT.
+func TestExecHelperProcess(t *testing.T) {
+	code, ok := os.LookupEnv(execHelperEnv)
+	if !ok {
+		return
+	}
+	for _, name := range []string{"REGISTRY_USERNAME", "REGISTRY_PASSWORD", "REGISTRY_SERVER", "USER_VAR", "PASS_VAR"} {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Printf("%s=%s\n", name, value)
+		}
+	}
+	exitCode, _ := strconv.Atoi(code)
+	os.Exit(exitCode)
+}
+
+func execHelperArgs(flags ...string) []string {
+	return append(flags, testRegistryHost, "--", os.Args[0], "-test.run=^TestExecHelperProcess$")
+}
+
+func TestExecCommand(t *testing.T) {
+	var out bytes.Buffer
+	err := execCommand(testAuthGetter(), execHelperArgs(), []string{execHelperEnv + "=0"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "REGISTRY_USERNAME=AWS\nREGISTRY_PASSWORD=password\nREGISTRY_SERVER="+testRegistryHost+"\n", out.String())
+}
+
+func TestExecCommandCustomEnv(t *testing.T) {
+	var out bytes.Buffer
+	args := execHelperArgs("--username-env", "USER_VAR", "--password-env", "PASS_VAR")
+	err := execCommand(testAuthGetter(), args, []string{execHelperEnv + "=0"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "REGISTRY_SERVER="+testRegistryHost+"\nUSER_VAR=AWS\nPASS_VAR=password\n", out.String())
+}
+
+func TestExecCommandExitCode(t *testing.T) {
+	var out bytes.Buffer
+	err := execCommand(testAuthGetter(), execHelperArgs(), []string{execHelperEnv + "=3"}, &out)
+	var exitErr *exitError
+	if assert.True(t, errors.As(err, &exitErr)) {
+		assert.Equal(t, 3, exitErr.code)
+	}
+}
+
+func TestExecCommandErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		helper *fakeAuthGetter
+		args   []string
+	}{
+		{name: "no command", helper: testAuthGetter(), args: []string{testRegistryHost}},
+		{name: "no separator", helper: testAuthGetter(), args: []string{testRegistryHost, "true"}},
+		{name: "get auth", helper: &fakeAuthGetter{err: errors.New("denied")}, args: []string{testRegistryHost, "--", "true"}},
+		{name: "missing command", helper: testAuthGetter(), args: []string{testRegistryHost, "--", "ecr-command-that-does-not-exist"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := execCommand(tc.helper, tc.args, nil, &out)
+			assert.Error(t, err)
+			assert.NotContains(t, err.Error(), testPassword)
+			assert.Empty(t, out.String())
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+)
+
+const (
+	kubeletAPIGroup             = "credentialprovider.kubelet.k8s.io"
+	kubeletRequestKind          = "CredentialProviderRequest"
+	kubeletResponseKind         = "CredentialProviderResponse"
+	kubeletCacheKeyTypeRegistry = "Registry"
+)
+
+// kubeletAPIVersions lists the versions of the kubelet credential provider
+// API understood by this helper. Both share the same request and response
+// schema.
+var kubeletAPIVersions = map[string]bool{
+	kubeletAPIGroup + "/v1":      true,
+	kubeletAPIGroup + "/v1beta1": true,
+}
+
+type credentialProviderRequest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Image      string `json:"image"`
+}
+
+type credentialProviderResponse struct {
+	APIVersion    string                       `json:"apiVersion"`
+	Kind          string                       `json:"kind"`
+	CacheKeyType  string                       `json:"cacheKeyType"`
+	CacheDuration string                       `json:"cacheDuration,omitempty"`
+	Auth          map[string]kubeletAuthConfig `json:"auth"`
+}
+
+type kubeletAuthConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// authGetter retrieves credentials for a registry, as implemented by
+// ecr.ECRHelper.
+type authGetter interface {
+	ResolveRegistry(serverURL string) (*api.Registry, error)
+	GetAuth(serverURL string) (*api.Auth, error)
+}
+
+// runKubelet implements the kubelet credential provider plugin protocol,
+// reading a CredentialProviderRequest from stdin and writing a
+// CredentialProviderResponse to stdout.
+func runKubelet(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("kubelet: unexpected arguments %q", args)
+	}
+	policy, err := cache.RefreshPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	return kubeletCredentialProvider(ecr.NewECRHelper(ecr.WithDescriptiveErrors(true)), policy, os.Stdin, os.Stdout, time.Now())
+}
+
+func kubeletCredentialProvider(helper authGetter, policy cache.RefreshPolicy, in io.Reader, out io.Writer, now time.Time) error {
+	var request credentialProviderRequest
+	if err := json.NewDecoder(in).Decode(&request); err != nil {
+		return fmt.Errorf("kubelet: could not decode request: %w", err)
+	}
+	if !kubeletAPIVersions[request.APIVersion] {
+		return fmt.Errorf("kubelet: unsupported apiVersion %q", request.APIVersion)
+	}
+	if request.Kind != kubeletRequestKind {
+		return fmt.Errorf("kubelet: unsupported kind %q", request.Kind)
+	}
+
+	host := imageHost(request.Image)
+	if _, err := helper.ResolveRegistry(host); err != nil {
+		return fmt.Errorf("kubelet: image %q: %w", request.Image, err)
+	}
+	auth, err := helper.GetAuth(host)
+	if err != nil {
+		return fmt.Errorf("kubelet: could not get credentials for %s: %w", host, err)
+	}
+
+	response := credentialProviderResponse{
+		APIVersion:    request.APIVersion,
+		Kind:          kubeletResponseKind,
+		CacheKeyType:  kubeletCacheKeyTypeRegistry,
+		CacheDuration: kubeletCacheDuration(policy, auth.ExpiresAt, now).String(),
+		Auth: map[string]kubeletAuthConfig{
+			host: {
+				Username: auth.Username,
+				Password: auth.Password,
+			},
+		},
+	}
+	return json.NewEncoder(out).Encode(response)
+}
+
+// imageHost returns the registry host of an image reference such as
+// 123456789012.dkr.ecr.us-west-2.amazonaws.com/repository:tag.
+func imageHost(image string) string {
+	image = strings.TrimPrefix(image, "https://")
+	host, _, _ := strings.Cut(image, "/")
+	return host
+}
+
+// kubeletCacheDuration asks the kubelet to cache credentials until policy
+// would refresh them, counting their validity window from now, so that the
+// kubelet refreshes them like the helper refreshes its cached tokens and
+// never holds on to a token close to its expiry.
+func kubeletCacheDuration(policy cache.RefreshPolicy, expiresAt time.Time, now time.Time) time.Duration {
+	refreshAt := policy.RefreshAt(&cache.AuthEntry{RequestedAt: now, ExpiresAt: expiresAt})
+	duration := refreshAt.Sub(now)
+	if duration <= 0 {
+		return 0
+	}
+	return duration.Truncate(time.Second)
+}
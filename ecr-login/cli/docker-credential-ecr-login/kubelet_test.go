@@ -0,0 +1,128 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRegistryHost = "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	testUsername     = "AWS"
+	testPassword     = "password"
+)
+
+var testNow = time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+type fakeAuthGetter struct {
+	auth *api.Auth
+	err  error
+	got  []string
+}
+
+func (f *fakeAuthGetter) ResolveRegistry(serverURL string) (*api.Registry, error) {
+	return api.ExtractRegistry(serverURL)
+}
+
+func (f *fakeAuthGetter) GetAuth(serverURL string) (*api.Auth, error) {
+	f.got = append(f.got, serverURL)
+	return f.auth, f.err
+}
+
+func TestKubeletCredentialProviderGolden(t *testing.T) {
+	for _, version := range []string{"v1", "v1beta1"} {
+		t.Run(version, func(t *testing.T) {
+			request, err := os.ReadFile(filepath.Join("testdata", "kubelet", version+"-request.json"))
+			assert.NoError(t, err)
+			expected, err := os.ReadFile(filepath.Join("testdata", "kubelet", version+"-response.json"))
+			assert.NoError(t, err)
+
+			helper := &fakeAuthGetter{auth: &api.Auth{
+				ProxyEndpoint: "https://" + testRegistryHost,
+				Username:      testUsername,
+				Password:      testPassword,
+				ExpiresAt:     testNow.Add(12 * time.Hour),
+			}}
+			var out bytes.Buffer
+			err = kubeletCredentialProvider(helper, cache.RefreshPolicy{}, bytes.NewReader(request), &out, testNow)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expected), out.String())
+			assert.Equal(t, []string{testRegistryHost}, helper.got)
+		})
+	}
+}
+
+func TestKubeletCredentialProviderErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		request string
+		err     error
+	}{{
+		name:    "malformed request",
+		request: "{not json",
+	}, {
+		name:    "unsupported api version",
+		request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","kind":"CredentialProviderRequest","image":"` + testRegistryHost + `/repo"}`,
+	}, {
+		name:    "unsupported kind",
+		request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"Pod","image":"` + testRegistryHost + `/repo"}`,
+	}, {
+		name:    "non-ECR image",
+		request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"docker.io/library/busybox"}`,
+	}, {
+		name:    "credential error",
+		request: `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"` + testRegistryHost + `/repo"}`,
+		err:     errors.New("nope"),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			helper := &fakeAuthGetter{err: tc.err}
+			var out bytes.Buffer
+			err := kubeletCredentialProvider(helper, cache.RefreshPolicy{}, strings.NewReader(tc.request), &out, testNow)
+			assert.Error(t, err)
+			assert.Empty(t, out.String())
+		})
+	}
+}
+
+func TestImageHost(t *testing.T) {
+	assert.Equal(t, testRegistryHost, imageHost(testRegistryHost+"/repo:tag"))
+	assert.Equal(t, testRegistryHost, imageHost(testRegistryHost+"/nested/repo@sha256:abcd"))
+	assert.Equal(t, "public.ecr.aws", imageHost("public.ecr.aws/amazonlinux/amazonlinux:latest"))
+	assert.Equal(t, testRegistryHost, imageHost(testRegistryHost))
+}
+
+func TestKubeletCacheDuration(t *testing.T) {
+	var policy cache.RefreshPolicy
+	assert.Equal(t, 6*time.Hour, kubeletCacheDuration(policy, testNow.Add(12*time.Hour), testNow))
+	assert.Equal(t, 90*time.Minute, kubeletCacheDuration(policy, testNow.Add(3*time.Hour+time.Millisecond), testNow))
+	assert.Equal(t, time.Duration(0), kubeletCacheDuration(policy, testNow.Add(-time.Hour), testNow))
+
+	policy = cache.RefreshPolicy{Margin: 30 * time.Minute}
+	assert.Equal(t, 11*time.Hour+30*time.Minute, kubeletCacheDuration(policy, testNow.Add(12*time.Hour), testNow))
+	assert.Equal(t, time.Duration(0), kubeletCacheDuration(policy, testNow.Add(10*time.Minute), testNow))
+	policy = cache.RefreshPolicy{Fraction: 0.75, MinRemaining: 4 * time.Hour}
+	assert.Equal(t, 8*time.Hour, kubeletCacheDuration(policy, testNow.Add(12*time.Hour), testNow))
+}
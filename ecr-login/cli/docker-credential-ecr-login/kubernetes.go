@@ -0,0 +1,164 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+)
+
+const (
+	secretTypeDockerConfigJSON = "kubernetes.io/dockerconfigjson"
+	secretDockerConfigJSONKey  = ".dockerconfigjson"
+
+	// secretExpiresAtAnnotation holds when the earliest token in the Secret
+	// expires, in RFC 3339 format.
+	secretExpiresAtAnnotation = "amazon-ecr-credential-helper/expires-at"
+	// secretExpiresLabel holds the same time in seconds since the Unix epoch,
+	// so that Secrets can be selected by expiry.
+	secretExpiresLabel = "amazon-ecr-credential-helper/expires"
+	managedByLabel     = "app.kubernetes.io/managed-by"
+)
+
+type kubernetesObjectMeta struct {
+	Name        string            `json:"name" yaml:"name"`
+	Namespace   string            `json:"namespace" yaml:"namespace"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+type kubernetesSecret struct {
+	APIVersion string               `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string               `json:"kind" yaml:"kind"`
+	Metadata   kubernetesObjectMeta `json:"metadata" yaml:"metadata"`
+	Type       string               `json:"type" yaml:"type"`
+	Data       map[string]string    `json:"data" yaml:"data"`
+}
+
+type kubernetesList struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Items      []kubernetesSecret `json:"items"`
+}
+
+// dockerConfigJSON is the contents of a kubernetes.io/dockerconfigjson Secret.
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// runKubernetesSecret prints image pull Secrets holding the credentials of
+// registries, to be applied with kubectl.
+func runKubernetesSecret(args []string) error {
+	return kubernetesSecretCommand(ecr.NewECRHelper(ecr.WithDescriptiveErrors(true)), args, os.Stdout)
+}
+
+func kubernetesSecretCommand(helper authGetter, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("kubernetes-secret", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the Secret")
+	format := flags.String("format", "yaml", "output format: yaml or json")
+	var registries, namespaces stringList
+	flags.Var(&registries, "registries", "registries to include in the Secret, comma separated or repeated")
+	flags.Var(&namespaces, "namespaces", "namespaces to create the Secret in, comma separated or repeated (default \"default\")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("kubernetes-secret: unexpected arguments %q", flags.Args())
+	}
+	if *name == "" {
+		return fmt.Errorf("kubernetes-secret: missing --name")
+	}
+	if len(registries) == 0 {
+		return fmt.Errorf("kubernetes-secret: no registries given")
+	}
+	if *format != "yaml" && *format != "json" {
+		return fmt.Errorf("kubernetes-secret: unknown format %q", *format)
+	}
+	if len(namespaces) == 0 {
+		namespaces = stringList{"default"}
+	}
+
+	config := dockerConfigJSON{Auths: make(map[string]dockerConfigAuth)}
+	var expiresAt time.Time
+	for _, registry := range registries {
+		host := imageHost(registry)
+		auth, err := registryAuth(helper, host)
+		if err != nil {
+			return fmt.Errorf("kubernetes-secret: %w", err)
+		}
+		config.Auths[host] = dockerConfigAuth{
+			Username: auth.Username,
+			Password: auth.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+		}
+		if expiresAt.IsZero() || auth.ExpiresAt.Before(expiresAt) {
+			expiresAt = auth.ExpiresAt
+		}
+	}
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	secrets := make([]kubernetesSecret, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		secret := kubernetesSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: kubernetesObjectMeta{
+				Name:      *name,
+				Namespace: namespace,
+				Labels:    map[string]string{managedByLabel: "docker-credential-ecr-login"},
+			},
+			Type: secretTypeDockerConfigJSON,
+			Data: map[string]string{secretDockerConfigJSONKey: base64.StdEncoding.EncodeToString(configJSON)},
+		}
+		if !expiresAt.IsZero() {
+			secret.Metadata.Labels[secretExpiresLabel] = strconv.FormatInt(expiresAt.Unix(), 10)
+			secret.Metadata.Annotations = map[string]string{secretExpiresAtAnnotation: formatTime(expiresAt)}
+		}
+		secrets = append(secrets, secret)
+	}
+
+	if *format == "json" {
+		if len(secrets) == 1 {
+			return printJSON(out, secrets[0])
+		}
+		return printJSON(out, kubernetesList{APIVersion: "v1", Kind: "List", Items: secrets})
+	}
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	for _, secret := range secrets {
+		if err := encoder.Encode(secret); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// registryAuthGetter returns the credentials of several registries.
+type registryAuthGetter map[string]*api.Auth
+
+func (r registryAuthGetter) ResolveRegistry(serverURL string) (*api.Registry, error) {
+	return api.ExtractRegistry(serverURL)
+}
+
+func (r registryAuthGetter) GetAuth(serverURL string) (*api.Auth, error) {
+	return r[serverURL], nil
+}
+
+func TestKubernetesSecretGolden(t *testing.T) {
+	otherRegistry := "210987654321.dkr.ecr.eu-west-1.amazonaws.com"
+	helper := registryAuthGetter{
+		testRegistryHost: {
+			ProxyEndpoint: "https://" + testRegistryHost,
+			Username:      testUsername,
+			Password:      testPassword,
+			ExpiresAt:     testNow.Add(12 * time.Hour),
+		},
+		otherRegistry: {
+			ProxyEndpoint: "https://" + otherRegistry,
+			Username:      testUsername,
+			Password:      "other-password",
+			ExpiresAt:     testNow.Add(11 * time.Hour),
+		},
+	}
+
+	testCases := []struct {
+		golden string
+		args   []string
+	}{{
+		golden: "secret.yaml",
+		args:   []string{"--name", "ecr-pull", "--registries", testRegistryHost},
+	}, {
+		golden: "secrets.yaml",
+		args:   []string{"--name", "ecr-pull", "--namespaces", "build,deploy", "--registries", testRegistryHost + "," + otherRegistry},
+	}, {
+		golden: "secret.json",
+		args:   []string{"--name", "ecr-pull", "--format", "json", "--namespaces", "build", "--registries", testRegistryHost},
+	}, {
+		golden: "secrets.json",
+		args:   []string{"--name", "ecr-pull", "--format", "json", "--namespaces", "build,deploy", "--registries", testRegistryHost + "," + otherRegistry},
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			expected, err := os.ReadFile(filepath.Join("testdata", "kubernetes", tc.golden))
+			assert.NoError(t, err)
+			var out bytes.Buffer
+			assert.NoError(t, kubernetesSecretCommand(helper, tc.args, &out))
+			assert.Equal(t, string(expected), out.String())
+		})
+	}
+}
+
+func TestKubernetesSecretErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "no name", args: []string{"--registries", testRegistryHost}},
+		{name: "no registries", args: []string{"--name", "ecr-pull"}},
+		{name: "unknown format", args: []string{"--name", "ecr-pull", "--format", "xml", "--registries", testRegistryHost}},
+		{name: "not ECR", args: []string{"--name", "ecr-pull", "--registries", "registry.example.com"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Error(t, kubernetesSecretCommand(testAuthGetter(), tc.args, &out))
+			assert.Empty(t, out.String())
+		})
+	}
+}
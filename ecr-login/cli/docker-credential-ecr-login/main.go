@@ -14,12 +14,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
 	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/daemon"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/version"
 	"github.com/docker/docker-credential-helpers/credentials"
 )
@@ -37,6 +39,21 @@ func init() {
 	credentials.Revision = version.GitCommitSHA
 }
 
+// commands are the subcommands handled by this binary in addition to the
+// get, store, erase, list and version actions served by credentials.Serve.
+var commands = map[string]func(args []string) error{
+	"cache":             runCache,
+	"configure":         runConfigure,
+	"doctor":            runDoctor,
+	"exec":              runExec,
+	"kubelet":           runKubelet,
+	"kubernetes-secret": runKubernetesSecret,
+	"serve":             runServe,
+	"sync-auth-file":    runSyncAuthFile,
+	"token":             runToken,
+	"warm":              runWarm,
+}
+
 func main() {
 	var versionFlag bool
 	flag.BoolVar(&versionFlag, "v", false, "print version and exit")
@@ -49,5 +66,17 @@ func main() {
 	}
 
 	config.SetupLogger()
-	credentials.Serve(ecr.NewECRHelper())
+	if command, ok := commands[flag.Arg(0)]; ok {
+		if err := command(flag.Args()[1:]); err != nil {
+			var exitErr *exitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.code)
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", credentials.Name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// Credentials are served by the daemon when it is running
+	credentials.Serve(daemon.NewHelper(config.GetDaemonSocket(), ecr.NewECRHelper()))
 }
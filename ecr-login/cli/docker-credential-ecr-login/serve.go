@@ -0,0 +1,60 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/daemon"
+)
+
+// runServe runs the credential daemon until it is interrupted.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	socket := flags.String("socket", config.GetDaemonSocket(), "path of the Unix socket to listen on")
+	refreshAhead := flags.Duration("refresh-ahead", daemon.DefaultRefreshAhead, "refresh tokens this long before they stop being valid")
+	refreshInterval := flags.Duration("refresh-interval", daemon.DefaultRefreshInterval, "how often to look for tokens to refresh")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("serve: unexpected arguments %q", flags.Args())
+	}
+
+	listener, err := daemon.Listen(*socket)
+	if err != nil {
+		return err
+	}
+	logrus.WithField("socket", listener.Addr().String()).Info("Serving credentials")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tokens are cached in memory by the daemon, not in the file cache
+	clientFactory := api.DefaultClientFactory{Cache: cache.NewNullCredentialsCache()}
+	server := daemon.NewServer(clientFactory,
+		daemon.WithRefreshAhead(*refreshAhead),
+		daemon.WithRefreshInterval(*refreshInterval))
+	return server.Serve(ctx, listener)
+}
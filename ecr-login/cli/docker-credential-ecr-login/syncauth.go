@@ -0,0 +1,197 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+)
+
+const (
+	authFormatContainers = "containers"
+	authFormatHelm       = "helm"
+	authFormatDocker     = "docker"
+
+	// ecrTokenValidity is how long the tokens issued by ECR are valid.
+	ecrTokenValidity = 12 * time.Hour
+)
+
+// registryClientGetter creates ECR clients for registries, as implemented by
+// ecr.ECRHelper.
+type registryClientGetter interface {
+	RegistryClient(serverURL string) (api.Client, *api.Registry, error)
+}
+
+// stringList is a flag that can be repeated, and whose values can also be
+// comma separated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// runSyncAuthFile writes the credentials of registries to the auth file of
+// Podman and Buildah, Helm or Docker.
+func runSyncAuthFile(args []string) error {
+	policy, err := cache.RefreshPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	return syncAuthFileCommand(context.Background(), ecr.NewECRHelper(), policy, args, os.Stdout, time.Now())
+}
+
+// syncAuthFileCommand writes the auth file. With --if-needed, entries are
+// rewritten once policy would refresh their token, unless --refresh-before
+// is given.
+func syncAuthFileCommand(ctx context.Context, helper registryClientGetter, policy cache.RefreshPolicy, args []string, out io.Writer, now time.Time) error {
+	flags := flag.NewFlagSet("sync-auth-file", flag.ContinueOnError)
+	format := flags.String("format", authFormatContainers, "auth file format: containers, helm or docker")
+	output := flags.String("output", "", "path of the auth file (defaults to the usual location of the format)")
+	var registries stringList
+	flags.Var(&registries, "registries", "registries to write credentials for, comma separated or repeated")
+	ifNeeded := flags.Bool("if-needed", false, "only rewrite entries that expire within --refresh-before")
+	refreshBefore := flags.Duration("refresh-before", 0, "with --if-needed, how long before their expiry entries are rewritten (defaults to when the helper refreshes cached tokens)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("sync-auth-file: unexpected arguments %q", flags.Args())
+	}
+	if len(registries) == 0 {
+		return fmt.Errorf("sync-auth-file: no registries given")
+	}
+
+	path, err := defaultAuthFilePath(*format)
+	if err != nil {
+		return fmt.Errorf("sync-auth-file: %w", err)
+	}
+	if *output != "" {
+		path = *output
+	}
+	path, err = homedir.Expand(path)
+	if err != nil {
+		return fmt.Errorf("sync-auth-file: %w", err)
+	}
+
+	file, err := loadAuthFile(path)
+	if err != nil {
+		return fmt.Errorf("sync-auth-file: %w", err)
+	}
+	updated := false
+	for _, registry := range registries {
+		host := imageHost(registry)
+		if *ifNeeded {
+			if entry := file.entry(host); entry != nil && entry.ExpiresAt != nil && isUpToDate(policy, *refreshBefore, *entry.ExpiresAt, now) {
+				fmt.Fprintf(out, "%s: up to date, expires %s\n", host, formatTime(*entry.ExpiresAt))
+				continue
+			}
+		}
+		auth, err := registryCredentials(ctx, helper, host)
+		if err != nil {
+			return fmt.Errorf("sync-auth-file: %w", err)
+		}
+		if err := file.setEntry(host, newAuthFileEntry(auth.Username, auth.Password, auth.ExpiresAt)); err != nil {
+			return fmt.Errorf("sync-auth-file: %w", err)
+		}
+		updated = true
+		fmt.Fprintf(out, "%s: updated, expires %s\n", host, formatTime(auth.ExpiresAt))
+	}
+	if !updated {
+		return nil
+	}
+	if err := file.save(); err != nil {
+		return fmt.Errorf("sync-auth-file: could not write %s: %w", path, err)
+	}
+	return nil
+}
+
+// isUpToDate reports whether an entry whose token expires at expiresAt can
+// be kept at now. Unless refreshBefore is set, entries are kept until policy
+// would refresh their token, which was issued ecrTokenValidity before it
+// expires, so that the helper has a new token to write.
+func isUpToDate(policy cache.RefreshPolicy, refreshBefore time.Duration, expiresAt time.Time, now time.Time) bool {
+	if refreshBefore != 0 {
+		return expiresAt.Sub(now) > refreshBefore
+	}
+	return policy.IsValid(&cache.AuthEntry{RequestedAt: expiresAt.Add(-ecrTokenValidity), ExpiresAt: expiresAt}, now)
+}
+
+// registryCredentials fetches the credentials of the registry at host by its
+// registry ID.
+func registryCredentials(ctx context.Context, helper registryClientGetter, host string) (*api.Auth, error) {
+	client, registry, err := helper.RegistryClient(host)
+	if err != nil {
+		return nil, err
+	}
+	var auth *api.Auth
+	if registry.Service == api.ServiceECRPublic {
+		auth, err = client.GetCredentials(ctx, host)
+	} else {
+		auth, err = client.GetCredentialsByRegistryID(ctx, registry.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get credentials for %s: %w", host, err)
+	}
+	return auth, nil
+}
+
+// defaultAuthFilePath returns where the tools reading format look for their
+// auth file by default.
+func defaultAuthFilePath(format string) (string, error) {
+	switch format {
+	case authFormatContainers:
+		if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+			return path, nil
+		}
+		if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+			return filepath.Join(runtimeDir, "containers", "auth.json"), nil
+		}
+		return filepath.Join("~", ".config", "containers", "auth.json"), nil
+	case authFormatHelm:
+		if path := os.Getenv("HELM_REGISTRY_CONFIG"); path != "" {
+			return path, nil
+		}
+		if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+			return filepath.Join(configHome, "helm", "registry", "config.json"), nil
+		}
+		return filepath.Join("~", ".config", "helm", "registry", "config.json"), nil
+	case authFormatDocker:
+		if configDir := os.Getenv("DOCKER_CONFIG"); configDir != "" {
+			return filepath.Join(configDir, "config.json"), nil
+		}
+		return filepath.Join("~", ".docker", "config.json"), nil
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,203 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistryClients hands out clients that issue tokens valid for 12 hours,
+// recording the registry IDs they were requested for.
+type fakeRegistryClients struct {
+	fetched []string
+}
+
+func (f *fakeRegistryClients) RegistryClient(serverURL string) (api.Client, *api.Registry, error) {
+	registry, err := api.ExtractRegistry(serverURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := func(id string) (*api.Auth, error) {
+		f.fetched = append(f.fetched, id)
+		return &api.Auth{
+			ProxyEndpoint: "https://" + serverURL,
+			Username:      testUsername,
+			Password:      testPassword,
+			ExpiresAt:     testNow.Add(12 * time.Hour),
+		}, nil
+	}
+	return &mock_api.MockClient{
+		GetCredentialsByRegistryIDFn: func(_ context.Context, registryID string) (*api.Auth, error) {
+			return auth(registryID)
+		},
+		GetCredentialsFn: func(_ context.Context, serverURL string) (*api.Auth, error) {
+			return auth(serverURL)
+		},
+	}, registry, nil
+}
+
+var testAuth = base64.StdEncoding.EncodeToString([]byte(testUsername + ":" + testPassword))
+
+func TestSyncAuthFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "containers", "auth.json")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+	"auths": {"quay.io": {"auth": "b3RoZXI6c2VjcmV0"}},
+	"credHelpers": {"gcr.io": "gcloud"}
+}`), 0644))
+
+	helper := &fakeRegistryClients{}
+	var out bytes.Buffer
+	args := []string{"--format", "containers", "--output", path, "--registries", testRegistryHost + ",public.ecr.aws"}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, cache.RefreshPolicy{}, args, &out, testNow))
+	assert.Equal(t, []string{"123456789012", "public.ecr.aws"}, helper.fetched)
+	assert.Equal(t, testRegistryHost+": updated, expires 2024-01-02T15:04:05Z\n"+
+		"public.ecr.aws: updated, expires 2024-01-02T15:04:05Z\n", out.String())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+	"auths": {
+		"quay.io": {"auth": "b3RoZXI6c2VjcmV0"},
+		"`+testRegistryHost+`": {"auth": "`+testAuth+`", "expiresAt": "2024-01-02T15:04:05Z"},
+		"public.ecr.aws": {"auth": "`+testAuth+`", "expiresAt": "2024-01-02T15:04:05Z"}
+	},
+	"credHelpers": {"gcr.io": "gcloud"}
+}`, string(data))
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestSyncAuthFileIfNeeded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	otherRegistry := "210987654321.dkr.ecr.us-west-2.amazonaws.com"
+	args := []string{"--output", path, "--registries", testRegistryHost, "--registries", otherRegistry}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), &fakeRegistryClients{}, cache.RefreshPolicy{}, args, &bytes.Buffer{}, testNow))
+	before, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// nothing is close to expiry yet
+	helper := &fakeRegistryClients{}
+	var out bytes.Buffer
+	args = append([]string{"--if-needed"}, args...)
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, cache.RefreshPolicy{}, args, &out, testNow.Add(time.Hour)))
+	assert.Empty(t, helper.fetched)
+	assert.Contains(t, out.String(), testRegistryHost+": up to date")
+	after, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// entries are rewritten within the refresh window, or without an expiry
+	file, err := loadAuthFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, file.setEntry(otherRegistry, &authFileEntry{Auth: testAuth}))
+	assert.NoError(t, file.save())
+	helper = &fakeRegistryClients{}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, cache.RefreshPolicy{}, args, &bytes.Buffer{}, testNow.Add(time.Hour)))
+	assert.Equal(t, []string{"210987654321"}, helper.fetched)
+
+	helper = &fakeRegistryClients{}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, cache.RefreshPolicy{}, args, &bytes.Buffer{}, testNow.Add(7*time.Hour)))
+	assert.Equal(t, []string{"123456789012", "210987654321"}, helper.fetched)
+}
+
+func TestSyncAuthFileIfNeededRefreshPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	args := []string{"--if-needed", "--output", path, "--registries", testRegistryHost}
+	policy := cache.RefreshPolicy{Margin: time.Hour}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), &fakeRegistryClients{}, policy, args, &bytes.Buffer{}, testNow))
+
+	// the helper would still return the same token
+	helper := &fakeRegistryClients{}
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, policy, args, &bytes.Buffer{}, testNow.Add(7*time.Hour)))
+	assert.Empty(t, helper.fetched)
+
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, policy, args, &bytes.Buffer{}, testNow.Add(11*time.Hour+time.Minute)))
+	assert.Equal(t, []string{"123456789012"}, helper.fetched)
+
+	// --refresh-before overrides the policy
+	helper = &fakeRegistryClients{}
+	args = append(args, "--refresh-before", "6h")
+	assert.NoError(t, syncAuthFileCommand(context.Background(), helper, policy, args, &bytes.Buffer{}, testNow.Add(7*time.Hour)))
+	assert.Equal(t, []string{"123456789012"}, helper.fetched)
+}
+
+func TestSyncAuthFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NoError(t, os.WriteFile(invalid, []byte("{nope"), 0600))
+
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{name: "no registries", args: []string{"--output", filepath.Join(dir, "auth.json")}},
+		{name: "unknown format", args: []string{"--format", "other", "--registries", testRegistryHost}},
+		{name: "not ECR", args: []string{"--output", filepath.Join(dir, "auth.json"), "--registries", "registry.example.com"}},
+		{name: "invalid file", args: []string{"--output", invalid, "--registries", testRegistryHost}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, syncAuthFileCommand(context.Background(), &fakeRegistryClients{}, cache.RefreshPolicy{}, tc.args, &bytes.Buffer{}, testNow))
+		})
+	}
+	_, err := os.Stat(filepath.Join(dir, "auth.json"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := os.ReadFile(invalid)
+	assert.NoError(t, err)
+	assert.Equal(t, "{nope", string(data))
+}
+
+func TestDefaultAuthFilePath(t *testing.T) {
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	t.Setenv("HELM_REGISTRY_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("DOCKER_CONFIG", "/etc/docker")
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{authFormatContainers, filepath.Join("/run/user/1000", "containers", "auth.json")},
+		{authFormatHelm, filepath.Join("~", ".config", "helm", "registry", "config.json")},
+		{authFormatDocker, filepath.Join("/etc/docker", "config.json")},
+	}
+	for _, tc := range testCases {
+		path, err := defaultAuthFilePath(tc.format)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, path, tc.format)
+	}
+
+	t.Setenv("REGISTRY_AUTH_FILE", "/tmp/auth.json")
+	path, err := defaultAuthFilePath(authFormatContainers)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/auth.json", path)
+}
@@ -0,0 +1,97 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+)
+
+const (
+	tokenFormatPassword = "password"
+	tokenFormatUserPass = "userpass"
+	tokenFormatJSON     = "json"
+)
+
+// tokenOutput is the JSON document printed by the token command.
+type tokenOutput struct {
+	Registry      string    `json:"registry"`
+	ProxyEndpoint string    `json:"proxyEndpoint"`
+	Username      string    `json:"username"`
+	Password      string    `json:"password"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// runToken prints the credentials of a registry, for tools that do not speak
+// the docker credential helper protocol.
+func runToken(args []string) error {
+	return tokenCommand(ecr.NewECRHelper(ecr.WithDescriptiveErrors(true)), args, os.Stdout)
+}
+
+func tokenCommand(helper authGetter, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	format := flags.String("format", tokenFormatPassword, "output format: password, userpass (username:password) or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("token: expected a single registry")
+	}
+	switch *format {
+	case tokenFormatPassword, tokenFormatUserPass, tokenFormatJSON:
+	default:
+		return fmt.Errorf("token: unknown format %q", *format)
+	}
+
+	host := imageHost(flags.Arg(0))
+	auth, err := registryAuth(helper, host)
+	if err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+
+	switch *format {
+	case tokenFormatUserPass:
+		_, err = fmt.Fprintf(out, "%s:%s\n", auth.Username, auth.Password)
+	case tokenFormatJSON:
+		err = printJSON(out, tokenOutput{
+			Registry:      host,
+			ProxyEndpoint: auth.ProxyEndpoint,
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ExpiresAt:     auth.ExpiresAt,
+		})
+	default:
+		_, err = fmt.Fprintln(out, auth.Password)
+	}
+	return err
+}
+
+// registryAuth returns the credentials of the registry at host, checking
+// first that the helper knows about it.
+func registryAuth(helper authGetter, host string) (*api.Auth, error) {
+	if _, err := helper.ResolveRegistry(host); err != nil {
+		return nil, err
+	}
+	auth, err := helper.GetAuth(host)
+	if err != nil {
+		return nil, fmt.Errorf("could not get credentials for %s: %w", host, err)
+	}
+	return auth, nil
+}
@@ -0,0 +1,89 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAuthGetter() *fakeAuthGetter {
+	return &fakeAuthGetter{auth: &api.Auth{
+		ProxyEndpoint: "https://" + testRegistryHost,
+		Username:      testUsername,
+		Password:      testPassword,
+		ExpiresAt:     testNow.Add(12 * time.Hour),
+	}}
+}
+
+func TestTokenCommand(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{{
+		name:     "password",
+		args:     []string{testRegistryHost},
+		expected: testPassword + "\n",
+	}, {
+		name:     "userpass",
+		args:     []string{"--format", "userpass", "https://" + testRegistryHost},
+		expected: testUsername + ":" + testPassword + "\n",
+	}, {
+		name: "json",
+		args: []string{"--format", "json", testRegistryHost + "/repository:tag"},
+		expected: `{
+  "registry": "` + testRegistryHost + `",
+  "proxyEndpoint": "https://` + testRegistryHost + `",
+  "username": "AWS",
+  "password": "password",
+  "expiresAt": "2024-01-02T15:04:05Z"
+}
+`,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			helper := testAuthGetter()
+			var out bytes.Buffer
+			assert.NoError(t, tokenCommand(helper, tc.args, &out))
+			assert.Equal(t, tc.expected, out.String())
+			assert.Equal(t, []string{testRegistryHost}, helper.got)
+		})
+	}
+}
+
+func TestTokenCommandErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		helper *fakeAuthGetter
+		args   []string
+	}{
+		{name: "no registry", helper: testAuthGetter()},
+		{name: "unknown format", helper: testAuthGetter(), args: []string{"--format", "yaml", testRegistryHost}},
+		{name: "not ECR", helper: testAuthGetter(), args: []string{"registry.example.com"}},
+		{name: "get auth", helper: &fakeAuthGetter{err: errors.New("denied")}, args: []string{testRegistryHost}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Error(t, tokenCommand(tc.helper, tc.args, &out))
+			assert.Empty(t, out.String())
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// registryWarmer gets the credentials of registries ahead of time, as
+// implemented by ecr.ECRHelper.
+type registryWarmer interface {
+	Warm(list config.List) ([]ecr.WarmResult, error)
+}
+
+// runWarm caches the credentials of registries before they are needed, for
+// example from a systemd timer or a container init script.
+func runWarm(args []string) error {
+	return warmCommand(ecr.NewECRHelper(ecr.WithDescriptiveErrors(true)), args, os.Stdout)
+}
+
+func warmCommand(helper registryWarmer, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("warm", flag.ContinueOnError)
+	var registries, regions stringList
+	flags.Var(&registries, "registries", "IDs of the registries to cache credentials for, comma separated or repeated (defaults to the default registry of each region)")
+	flags.Var(&regions, "regions", "regions of the registries, comma separated or repeated (defaults to the regions listed in the configuration)")
+	concurrency := flags.Int("concurrency", 0, fmt.Sprintf("how many regions to get credentials for at once (default %d)", config.DefaultListConcurrency))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("warm: unexpected arguments %q", flags.Args())
+	}
+
+	results, err := helper.Warm(config.List{
+		Regions:     regions,
+		RegistryIDs: registries,
+		Concurrency: *concurrency,
+	})
+	for _, result := range results {
+		if result.Err == nil {
+			fmt.Fprintf(out, "%s: cached, expires %s\n", imageHost(result.Auth.ProxyEndpoint), formatTime(result.Auth.ExpiresAt))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("warm: %w", err)
+	}
+	return nil
+}
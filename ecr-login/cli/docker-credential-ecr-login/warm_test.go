@@ -0,0 +1,86 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRegistryWarmer struct {
+	results []ecr.WarmResult
+	err     error
+	got     []config.List
+}
+
+func (f *fakeRegistryWarmer) Warm(list config.List) ([]ecr.WarmResult, error) {
+	f.got = append(f.got, list)
+	return f.results, f.err
+}
+
+func TestWarmCommand(t *testing.T) {
+	helper := &fakeRegistryWarmer{results: []ecr.WarmResult{{
+		Region:     "us-west-2",
+		RegistryID: "123456789012",
+		Auth: &api.Auth{
+			ProxyEndpoint: "https://" + testRegistryHost,
+			ExpiresAt:     testNow.Add(12 * time.Hour),
+		},
+	}}}
+	var out bytes.Buffer
+
+	err := warmCommand(helper, []string{"--registries", "123456789012", "--regions", "us-west-2,us-east-1", "--concurrency", "8"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, testRegistryHost+": cached, expires 2024-01-02T15:04:05Z\n", out.String())
+	assert.Equal(t, []config.List{{
+		Regions:     []string{"us-west-2", "us-east-1"},
+		RegistryIDs: []string{"123456789012"},
+		Concurrency: 8,
+	}}, helper.got)
+}
+
+func TestWarmCommandFailure(t *testing.T) {
+	helper := &fakeRegistryWarmer{
+		results: []ecr.WarmResult{{
+			Region: "us-west-2",
+			Auth:   &api.Auth{ProxyEndpoint: "https://" + testRegistryHost, ExpiresAt: testNow},
+		}, {
+			Region: "us-east-1",
+			Err:    errors.New("access denied"),
+		}},
+		err: errors.New("ecr: could not get credentials for 1 of 2 registries"),
+	}
+	var out bytes.Buffer
+
+	err := warmCommand(helper, []string{"--regions", "us-west-2,us-east-1"}, &out)
+	assert.ErrorContains(t, err, "warm: ecr: could not get credentials for 1 of 2 registries")
+	assert.Equal(t, testRegistryHost+": cached, expires 2024-01-02T03:04:05Z\n", out.String(), "registries that were cached should still be reported")
+}
+
+func TestWarmCommandErrors(t *testing.T) {
+	helper := &fakeRegistryWarmer{}
+	var out bytes.Buffer
+
+	assert.Error(t, warmCommand(helper, []string{"unexpected"}, &out))
+	assert.Error(t, warmCommand(helper, []string{"--concurrency", "many"}, &out))
+	assert.Empty(t, helper.got)
+	assert.Empty(t, out.String())
+}
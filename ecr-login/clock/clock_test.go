@@ -0,0 +1,47 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystem(t *testing.T) {
+	before := time.Now()
+	now := System().Now()
+	assert.False(t, now.Before(before))
+	assert.WithinDuration(t, time.Now(), now, time.Second)
+}
+
+func TestOrSystem(t *testing.T) {
+	assert.Equal(t, System(), OrSystem(nil))
+
+	fake := NewFake(time.Time{})
+	assert.Same(t, fake, OrSystem(fake))
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake := NewFake(start)
+	assert.Equal(t, start, fake.Now())
+
+	fake.Advance(6 * time.Hour)
+	assert.Equal(t, start.Add(6*time.Hour), fake.Now())
+
+	fake.Set(start)
+	assert.Equal(t, start, fake.Now())
+}
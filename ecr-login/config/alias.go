@@ -0,0 +1,107 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var registryIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// RegistryAlias maps a custom hostname, such as an internal DNS name or a
+// pull-through proxy in front of ECR, to the ECR registry behind it.
+type RegistryAlias struct {
+	// Host is the custom hostname, without scheme or port.
+	Host string `yaml:"host"`
+	// RegistryID is the AWS account ID of the registry.
+	RegistryID string `yaml:"registryId"`
+	// Region is the region of the registry.
+	Region string `yaml:"region"`
+	// FIPS selects the FIPS endpoint of the region.
+	FIPS bool `yaml:"fips"`
+}
+
+func (a *RegistryAlias) validate() error {
+	if a.Host == "" {
+		return fmt.Errorf("config: alias is missing a host")
+	}
+	if !registryIDPattern.MatchString(a.RegistryID) {
+		return fmt.Errorf("config: alias %s has invalid registry ID %q", a.Host, a.RegistryID)
+	}
+	if a.Region == "" {
+		return fmt.Errorf("config: alias %s is missing a region", a.Host)
+	}
+	return nil
+}
+
+// AliasFor returns the alias of host from the configuration file, or from the
+// AWS_ECR_REGISTRY_ALIASES environment variable, or nil if host is not an
+// alias.
+func (f *File) AliasFor(host string) *RegistryAlias {
+	if f != nil {
+		for i := range f.Aliases {
+			if strings.EqualFold(f.Aliases[i].Host, host) {
+				return &f.Aliases[i]
+			}
+		}
+	}
+	aliases, err := ParseAliases(os.Getenv("AWS_ECR_REGISTRY_ALIASES"))
+	if err != nil {
+		logrus.WithError(err).Warning("Ignoring invalid AWS_ECR_REGISTRY_ALIASES")
+		return nil
+	}
+	for i := range aliases {
+		if strings.EqualFold(aliases[i].Host, host) {
+			return &aliases[i]
+		}
+	}
+	return nil
+}
+
+// ParseAliases parses a comma separated list of aliases, each written as
+// host=registryId:region, or host=registryId:region:fips for the FIPS
+// endpoint.
+func ParseAliases(value string) ([]RegistryAlias, error) {
+	var aliases []RegistryAlias
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("config: alias %q is not of the form host=registryId:region", entry)
+		}
+		parts := strings.Split(target, ":")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "fips") {
+			return nil, fmt.Errorf("config: alias %q is not of the form host=registryId:region[:fips]", entry)
+		}
+		alias := RegistryAlias{
+			Host:       host,
+			RegistryID: parts[0],
+			Region:     parts[1],
+			FIPS:       len(parts) == 3,
+		}
+		if err := alias.validate(); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, nil
+}
@@ -0,0 +1,107 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAliases(t *testing.T) {
+	aliases, err := ParseAliases("registry.example.com=123456789012:us-west-2, gov.example.com=210987654321:us-gov-west-1:fips,")
+	assert.NoError(t, err)
+	assert.Equal(t, []RegistryAlias{{
+		Host:       "registry.example.com",
+		RegistryID: "123456789012",
+		Region:     "us-west-2",
+	}, {
+		Host:       "gov.example.com",
+		RegistryID: "210987654321",
+		Region:     "us-gov-west-1",
+		FIPS:       true,
+	}}, aliases)
+
+	aliases, err = ParseAliases("")
+	assert.NoError(t, err)
+	assert.Empty(t, aliases)
+}
+
+func TestParseAliasesInvalid(t *testing.T) {
+	for _, value := range []string{
+		"registry.example.com",
+		"registry.example.com=123456789012",
+		"registry.example.com=123456789012:us-west-2:other",
+		"registry.example.com=1234:us-west-2",
+		"registry.example.com=123456789012:",
+		"=123456789012:us-west-2",
+	} {
+		t.Run(value, func(t *testing.T) {
+			_, err := ParseAliases(value)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAliasFor(t *testing.T) {
+	t.Setenv("AWS_ECR_REGISTRY_ALIASES", "env.example.com=210987654321:eu-west-1")
+	file := &File{Aliases: []RegistryAlias{{
+		Host:       "Registry.Example.com",
+		RegistryID: "123456789012",
+		Region:     "us-west-2",
+	}}}
+
+	alias := file.AliasFor("registry.example.com")
+	if assert.NotNil(t, alias) {
+		assert.Equal(t, "123456789012", alias.RegistryID)
+	}
+
+	alias = file.AliasFor("env.example.com")
+	if assert.NotNil(t, alias) {
+		assert.Equal(t, "eu-west-1", alias.Region)
+	}
+
+	var nilFile *File
+	assert.NotNil(t, nilFile.AliasFor("env.example.com"))
+	assert.Nil(t, file.AliasFor("other.example.com"))
+}
+
+func TestAliasForInvalidEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_REGISTRY_ALIASES", "env.example.com=nope")
+	assert.Nil(t, (&File{}).AliasFor("env.example.com"))
+}
+
+func TestLoadFileAliases(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, `
+aliases:
+  - host: registry.example.com
+    registryId: "123456789012"
+    region: us-west-2
+    fips: true
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []RegistryAlias{{
+		Host:       "registry.example.com",
+		RegistryID: "123456789012",
+		Region:     "us-west-2",
+		FIPS:       true,
+	}}, file.Aliases)
+
+	_, err = LoadFile(writeConfigFile(t, `
+aliases:
+  - host: registry.example.com
+    region: us-west-2
+`))
+	assert.Error(t, err)
+}
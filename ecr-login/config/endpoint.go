@@ -0,0 +1,74 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Endpoints overrides the endpoints of the ECR and ECR Public APIs, for
+// example to reach them through interface VPC endpoints, or to use a local
+// stand-in in tests.
+type Endpoints struct {
+	// ECR is the URL of the ECR API, used for registries of every region.
+	ECR string `yaml:"ecr"`
+	// ECRPublic is the URL of the ECR Public API.
+	ECRPublic string `yaml:"ecrPublic"`
+	// ECRPublicRegion is the region of the ECR Public API, which is also
+	// used to sign requests to ECRPublic. It defaults to us-east-1.
+	ECRPublicRegion string `yaml:"ecrPublicRegion"`
+	// CABundle is the path of a PEM file of certificate authorities trusted
+	// by the endpoints, in addition to those of the system.
+	CABundle string `yaml:"caBundle"`
+}
+
+// IsZero reports whether e overrides nothing.
+func (e Endpoints) IsZero() bool {
+	return e == Endpoints{}
+}
+
+// Validate checks that the endpoints of e are absolute HTTP or HTTPS URLs.
+func (e Endpoints) Validate() error {
+	for name, endpoint := range map[string]string{"ecr": e.ECR, "ecrPublic": e.ECRPublic} {
+		if endpoint == "" {
+			continue
+		}
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("config: invalid %s endpoint: %w", name, err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("config: %s endpoint %q is not an http or https URL", name, endpoint)
+		}
+	}
+	return nil
+}
+
+// EndpointsFromEnv returns the endpoints set with the AWS_ECR_ENDPOINT_URL,
+// AWS_ECR_PUBLIC_ENDPOINT_URL, AWS_ECR_PUBLIC_REGION and AWS_ECR_CA_BUNDLE
+// environment variables.
+func EndpointsFromEnv() (Endpoints, error) {
+	endpoints := Endpoints{
+		ECR:             os.Getenv("AWS_ECR_ENDPOINT_URL"),
+		ECRPublic:       os.Getenv("AWS_ECR_PUBLIC_ENDPOINT_URL"),
+		ECRPublicRegion: os.Getenv("AWS_ECR_PUBLIC_REGION"),
+		CABundle:        os.Getenv("AWS_ECR_CA_BUNDLE"),
+	}
+	if err := endpoints.Validate(); err != nil {
+		return Endpoints{}, err
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,65 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointsValidate(t *testing.T) {
+	assert.NoError(t, Endpoints{}.Validate())
+	assert.NoError(t, Endpoints{ECR: "http://localhost:8080", ECRPublic: "https://vpce-1234.api.ecr-public.us-east-1.vpce.amazonaws.com"}.Validate())
+	assert.Error(t, Endpoints{ECR: "localhost:8080"}.Validate())
+	assert.Error(t, Endpoints{ECRPublic: "ftp://example.com"}.Validate())
+	assert.Error(t, Endpoints{ECR: "https://"}.Validate())
+}
+
+func TestEndpointsFromEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_ENDPOINT_URL", "http://localhost:8080")
+	t.Setenv("AWS_ECR_PUBLIC_ENDPOINT_URL", "")
+	t.Setenv("AWS_ECR_PUBLIC_REGION", "us-west-2")
+	t.Setenv("AWS_ECR_CA_BUNDLE", "/etc/ecr/ca.pem")
+	endpoints, err := EndpointsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoints{ECR: "http://localhost:8080", ECRPublicRegion: "us-west-2", CABundle: "/etc/ecr/ca.pem"}, endpoints)
+
+	t.Setenv("AWS_ECR_ENDPOINT_URL", "localhost:8080")
+	_, err = EndpointsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestLoadFileEndpoints(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, `
+endpoints:
+  ecr: https://vpce-1234.api.ecr.us-west-2.vpce.amazonaws.com
+  ecrPublic: http://localhost:8081
+  ecrPublicRegion: us-west-2
+  caBundle: /etc/ecr/ca.pem
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, Endpoints{
+		ECR:             "https://vpce-1234.api.ecr.us-west-2.vpce.amazonaws.com",
+		ECRPublic:       "http://localhost:8081",
+		ECRPublicRegion: "us-west-2",
+		CABundle:        "/etc/ecr/ca.pem",
+	}, file.Endpoints)
+
+	_, err = LoadFile(writeConfigFile(t, `
+endpoints:
+  ecr: vpce-1234.api.ecr.us-west-2.vpce.amazonaws.com
+`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// GetConfigFile returns the location of the helper configuration file, which
+// can be overridden with the AWS_ECR_CONFIG_FILE environment variable.
+func GetConfigFile() string {
+	if configFile := os.Getenv("AWS_ECR_CONFIG_FILE"); configFile != "" {
+		return configFile
+	}
+	return "~/.ecr/config.yaml"
+}
+
+// File is the helper configuration file. All of its sections are optional.
+type File struct {
+	// Registries selects the AWS identity used for matching registries. The
+	// first matching entry wins.
+	Registries []RegistryConfig `yaml:"registries"`
+	// Aliases maps custom hostnames to the ECR registries behind them.
+	Aliases []RegistryAlias `yaml:"aliases"`
+	// Endpoints overrides the endpoints of the ECR APIs. It takes precedence
+	// over the endpoints set in the environment.
+	Endpoints Endpoints `yaml:"endpoints"`
+	// List selects the registries whose credentials are listed. It takes
+	// precedence over the registries set in the environment.
+	List List `yaml:"list"`
+}
+
+// RegistryConfig describes the AWS identity used for a set of registries.
+//
+// An entry applies to a registry when every non-empty selector (RegistryIDs,
+// Regions and Hosts) has at least one match. An entry without selectors
+// applies to every registry.
+type RegistryConfig struct {
+	// RegistryIDs are the AWS account IDs of the registries.
+	RegistryIDs []string `yaml:"registryIds"`
+	// Regions are the regions of the registries.
+	Regions []string `yaml:"regions"`
+	// Hosts are glob patterns, as understood by path.Match, matched against
+	// the registry hostname.
+	Hosts []string `yaml:"hosts"`
+
+	// Profile is the named profile from the shared AWS configuration used to
+	// resolve credentials.
+	Profile string `yaml:"profile"`
+	// STSRegion overrides the region of the STS endpoint used to assume
+	// RoleARN. It defaults to the registry region, which is always the region
+	// of the ECR API, as tokens are only valid in the region they are issued
+	// for.
+	STSRegion string `yaml:"stsRegion"`
+	// RoleARN is the ARN of a role to assume with the resolved credentials.
+	RoleARN string `yaml:"roleArn"`
+	// ExternalID is passed when assuming RoleARN.
+	ExternalID string `yaml:"externalId"`
+	// SessionName is the role session name used when assuming RoleARN.
+	SessionName string `yaml:"sessionName"`
+	// SessionTags are the session tags passed when assuming RoleARN.
+	SessionTags map[string]string `yaml:"sessionTags"`
+}
+
+// LoadFile reads the helper configuration file at configFile. A missing file
+// is not an error and results in an empty configuration.
+func LoadFile(configFile string) (*File, error) {
+	configFile, err := homedir.Expand(configFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(configFile)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &File{}
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("config: could not parse %s: %w", configFile, err)
+	}
+	if err := config.Endpoints.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.List.Validate(); err != nil {
+		return nil, err
+	}
+	for i := range config.Aliases {
+		if err := config.Aliases[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// RegistryConfigFor returns the first registry entry matching the given
+// registry, or nil if there is none.
+func (f *File) RegistryConfigFor(host string, registryID string, region string) *RegistryConfig {
+	if f == nil {
+		return nil
+	}
+	for i := range f.Registries {
+		if f.Registries[i].matches(host, registryID, region) {
+			return &f.Registries[i]
+		}
+	}
+	return nil
+}
+
+func (r *RegistryConfig) matches(host string, registryID string, region string) bool {
+	if len(r.RegistryIDs) > 0 && !slices.Contains(r.RegistryIDs, registryID) {
+		return false
+	}
+	if len(r.Regions) > 0 && !slices.Contains(r.Regions, region) {
+		return false
+	}
+	if len(r.Hosts) > 0 && !matchesAny(r.Hosts, host) {
+		return false
+	}
+	return true
+}
+
+// Identity returns a stable description of the role assumed by this entry,
+// or an empty string if no role is assumed. Temporary credentials obtained by
+// assuming a role change with every session, so the identity is used in their
+// place to scope cached tokens.
+func (r *RegistryConfig) Identity() string {
+	if r == nil || r.RoleARN == "" {
+		return ""
+	}
+	parts := []string{r.RoleARN, r.ExternalID, r.SessionName}
+	keys := make([]string, 0, len(r.SessionTags))
+	for key := range r.SessionTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, key+"="+r.SessionTags[key])
+	}
+	return strings.Join(parts, "|")
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
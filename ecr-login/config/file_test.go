@@ -0,0 +1,159 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfigFile = `
+registries:
+  - registryIds: ["111111111111"]
+    profile: build
+  - regions: [eu-west-1]
+    hosts: ["*.dkr.ecr.eu-west-1.amazonaws.com"]
+    roleArn: arn:aws:iam::222222222222:role/pull
+    externalId: external
+    sessionName: ci
+    sessionTags:
+      team: platform
+      env: prod
+    stsRegion: us-east-1
+  - hosts: ["*.amazonaws.com.cn"]
+    profile: china
+`
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(contents), 0600))
+	return configFile
+}
+
+func TestGetConfigFile(t *testing.T) {
+	t.Setenv("AWS_ECR_CONFIG_FILE", "")
+	assert.Equal(t, "~/.ecr/config.yaml", GetConfigFile())
+
+	t.Setenv("AWS_ECR_CONFIG_FILE", "/etc/ecr/config.yaml")
+	assert.Equal(t, "/etc/ecr/config.yaml", GetConfigFile())
+}
+
+func TestLoadFile(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, testConfigFile))
+	assert.NoError(t, err)
+	assert.Len(t, file.Registries, 3)
+
+	role := file.Registries[1]
+	assert.Equal(t, []string{"eu-west-1"}, role.Regions)
+	assert.Equal(t, "arn:aws:iam::222222222222:role/pull", role.RoleARN)
+	assert.Equal(t, "external", role.ExternalID)
+	assert.Equal(t, "ci", role.SessionName)
+	assert.Equal(t, map[string]string{"team": "platform", "env": "prod"}, role.SessionTags)
+	assert.Equal(t, "us-east-1", role.STSRegion)
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	file, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NoError(t, err)
+	assert.Empty(t, file.Registries)
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, ""))
+	assert.NoError(t, err)
+	assert.Empty(t, file.Registries)
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	_, err := LoadFile(writeConfigFile(t, "registries: {not: [a list"))
+	assert.Error(t, err)
+
+	_, err = LoadFile(writeConfigFile(t, "registries:\n  - rolearn: typo\n"))
+	assert.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestRegistryConfigFor(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, testConfigFile))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		host       string
+		registryID string
+		region     string
+		expected   *RegistryConfig
+	}{{
+		name:       "registry ID",
+		host:       "111111111111.dkr.ecr.us-west-2.amazonaws.com",
+		registryID: "111111111111",
+		region:     "us-west-2",
+		expected:   &file.Registries[0],
+	}, {
+		name:       "region and host",
+		host:       "333333333333.dkr.ecr.eu-west-1.amazonaws.com",
+		registryID: "333333333333",
+		region:     "eu-west-1",
+		expected:   &file.Registries[1],
+	}, {
+		name:       "region without matching host",
+		host:       "333333333333.dkr-ecr.eu-west-1.on.aws",
+		registryID: "333333333333",
+		region:     "eu-west-1",
+	}, {
+		name:       "host glob",
+		host:       "333333333333.dkr.ecr.cn-north-1.amazonaws.com.cn",
+		registryID: "333333333333",
+		region:     "cn-north-1",
+		expected:   &file.Registries[2],
+	}, {
+		name:       "no match",
+		host:       "333333333333.dkr.ecr.us-west-2.amazonaws.com",
+		registryID: "333333333333",
+		region:     "us-west-2",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, file.RegistryConfigFor(tc.host, tc.registryID, tc.region))
+		})
+	}
+
+	var nilFile *File
+	assert.Nil(t, nilFile.RegistryConfigFor("host", "111111111111", "us-west-2"))
+}
+
+func TestRegistryConfigForCatchAll(t *testing.T) {
+	file := &File{Registries: []RegistryConfig{{Profile: "default"}}}
+	assert.Equal(t, &file.Registries[0], file.RegistryConfigFor("public.ecr.aws", "", ""))
+}
+
+func TestRegistryConfigIdentity(t *testing.T) {
+	assert.Empty(t, (&RegistryConfig{Profile: "build"}).Identity())
+
+	role := &RegistryConfig{
+		RoleARN:     "arn:aws:iam::222222222222:role/pull",
+		ExternalID:  "external",
+		SessionName: "ci",
+		SessionTags: map[string]string{"team": "platform", "env": "prod"},
+	}
+	assert.Equal(t, "arn:aws:iam::222222222222:role/pull|external|ci|env=prod|team=platform", role.Identity())
+
+	otherTags := *role
+	otherTags.SessionTags = map[string]string{"team": "security"}
+	assert.NotEqual(t, role.Identity(), otherTags.Identity())
+}
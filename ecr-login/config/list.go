@@ -0,0 +1,99 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultListConcurrency is the number of regions listed at once, unless
+// overridden with List.Concurrency.
+const DefaultListConcurrency = 4
+
+// List selects the registries whose credentials are listed by the helper.
+type List struct {
+	// Regions are the regions of the listed registries.
+	Regions []string `yaml:"regions"`
+	// RegistryIDs are the AWS account IDs of the registries listed in each
+	// of Regions. The default registry of each region is listed if empty.
+	RegistryIDs []string `yaml:"registryIds"`
+	// Concurrency is the maximum number of regions listed at once. It
+	// defaults to DefaultListConcurrency.
+	Concurrency int `yaml:"concurrency"`
+}
+
+// IsZero reports whether l selects no registries, in which case only the
+// default registry of the default region is listed.
+func (l List) IsZero() bool {
+	return len(l.Regions) == 0 && len(l.RegistryIDs) == 0 && l.Concurrency == 0
+}
+
+// Validate checks that l selects registries by region.
+func (l List) Validate() error {
+	if len(l.RegistryIDs) > 0 && len(l.Regions) == 0 {
+		return fmt.Errorf("config: list registryIds require regions")
+	}
+	for _, registryID := range l.RegistryIDs {
+		if !registryIDPattern.MatchString(registryID) {
+			return fmt.Errorf("config: list has invalid registry ID %q", registryID)
+		}
+	}
+	if l.Concurrency < 0 {
+		return fmt.Errorf("config: list concurrency cannot be negative")
+	}
+	return nil
+}
+
+// ListFor returns the registries to list from the configuration file, or from
+// the AWS_ECR_LIST_REGIONS, AWS_ECR_LIST_REGISTRY_IDS and
+// AWS_ECR_LIST_CONCURRENCY environment variables if the file selects none.
+func (f *File) ListFor() (List, error) {
+	if f != nil && !f.List.IsZero() {
+		return f.List, nil
+	}
+	return ListFromEnv()
+}
+
+// ListFromEnv returns the registries to list set in the environment.
+func ListFromEnv() (List, error) {
+	list := List{
+		Regions:     splitList(os.Getenv("AWS_ECR_LIST_REGIONS")),
+		RegistryIDs: splitList(os.Getenv("AWS_ECR_LIST_REGISTRY_IDS")),
+	}
+	if value := os.Getenv("AWS_ECR_LIST_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil {
+			return List{}, fmt.Errorf("config: invalid AWS_ECR_LIST_CONCURRENCY: %w", err)
+		}
+		list.Concurrency = concurrency
+	}
+	if err := list.Validate(); err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// splitList splits a comma separated list, ignoring empty elements.
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
@@ -0,0 +1,87 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListValidate(t *testing.T) {
+	assert.NoError(t, List{}.Validate())
+	assert.NoError(t, List{Regions: []string{"us-west-2"}, RegistryIDs: []string{"123456789012"}, Concurrency: 8}.Validate())
+	assert.Error(t, List{RegistryIDs: []string{"123456789012"}}.Validate())
+	assert.Error(t, List{Regions: []string{"us-west-2"}, RegistryIDs: []string{"1234"}}.Validate())
+	assert.Error(t, List{Regions: []string{"us-west-2"}, Concurrency: -1}.Validate())
+}
+
+func TestListFromEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_LIST_REGIONS", "us-east-1, us-west-2,")
+	t.Setenv("AWS_ECR_LIST_REGISTRY_IDS", "111111111111,222222222222")
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "8")
+	list, err := ListFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, List{
+		Regions:     []string{"us-east-1", "us-west-2"},
+		RegistryIDs: []string{"111111111111", "222222222222"},
+		Concurrency: 8,
+	}, list)
+
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "many")
+	_, err = ListFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("AWS_ECR_LIST_REGIONS", "")
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "")
+	_, err = ListFromEnv()
+	assert.Error(t, err, "registry IDs require regions")
+}
+
+func TestListFor(t *testing.T) {
+	t.Setenv("AWS_ECR_LIST_REGIONS", "eu-west-1")
+	t.Setenv("AWS_ECR_LIST_REGISTRY_IDS", "")
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "")
+
+	file := &File{List: List{Regions: []string{"us-west-2"}}}
+	list, err := file.ListFor()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"us-west-2"}, list.Regions, "the file should take precedence")
+
+	var nilFile *File
+	list, err = nilFile.ListFor()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu-west-1"}, list.Regions)
+}
+
+func TestLoadFileList(t *testing.T) {
+	file, err := LoadFile(writeConfigFile(t, `
+list:
+  regions: [us-east-1, us-west-2]
+  registryIds: ["111111111111"]
+  concurrency: 2
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, List{
+		Regions:     []string{"us-east-1", "us-west-2"},
+		RegistryIDs: []string{"111111111111"},
+		Concurrency: 2,
+	}, file.List)
+
+	_, err = LoadFile(writeConfigFile(t, `
+list:
+  registryIds: ["111111111111"]
+`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+)
+
+const (
+	dialTimeout = 200 * time.Millisecond
+	// clientTimeout leaves the daemon time to fetch a token on a cache miss.
+	clientTimeout = 30 * time.Second
+)
+
+// ErrUnavailable is returned by Client when the daemon cannot be reached,
+// does not answer, or does not serve the environment of the caller, as
+// opposed to the errors reported by the daemon.
+var ErrUnavailable = errors.New("daemon: unavailable")
+
+// Client requests credentials from a daemon listening on a Unix socket.
+type Client struct {
+	socket string
+}
+
+// NewClient returns a Client for the daemon listening on socket.
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// GetAuth requests the credentials of serverURL from the daemon. It returns
+// credentials.NewErrCredentialsNotFound() if the daemon has no credentials
+// for serverURL, an error wrapping ErrUnavailable if the daemon could not be
+// reached, and the other errors reported by the daemon as they are.
+func (c *Client) GetAuth(serverURL string) (*api.Auth, error) {
+	response, err := c.do(Request{Action: ActionGet, ServerURL: serverURL})
+	if err != nil {
+		return nil, err
+	}
+	return &api.Auth{
+		ProxyEndpoint: response.ProxyEndpoint,
+		Username:      response.Username,
+		Password:      response.Secret,
+		ExpiresAt:     response.ExpiresAt,
+	}, nil
+}
+
+// Delete asks the daemon to remove the cached credentials of serverURL.
+func (c *Client) Delete(serverURL string) error {
+	_, err := c.do(Request{Action: ActionDelete, ServerURL: serverURL})
+	return err
+}
+
+// do sends request to the daemon and returns its response, or the error it
+// reported.
+func (c *Client) do(request Request) (*Response, error) {
+	socket, err := homedir.Expand(c.socket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	conn, err := net.DialTimeout("unix", socket, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clientTimeout))
+
+	request.Environment = environmentFingerprint()
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, fmt.Errorf("%w: could not send request: %w", ErrUnavailable, err)
+	}
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, fmt.Errorf("%w: could not read response: %w", ErrUnavailable, err)
+	}
+	if response.EnvironmentMismatch {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, response.Error)
+	}
+	if response.Error != "" {
+		if credentials.IsCredentialsMissingServerURLMessage(response.Error) {
+			return nil, credentials.NewErrCredentialsMissingServerURL()
+		}
+		if credentials.IsErrCredentialsNotFoundMessage(response.Error) {
+			return nil, credentials.NewErrCredentialsNotFound()
+		}
+		return nil, fmt.Errorf("daemon: %s", response.Error)
+	}
+	return &response, nil
+}
+
+// fallbackForwarder is implemented by helpers that forward the requests for
+// some hosts to another credential helper, such as ecr.ECRHelper. The daemon
+// does not know about those hosts.
+type fallbackForwarder interface {
+	ForwardsToFallback(serverURL string) bool
+}
+
+// Helper is a credentials.Helper that gets credentials from the daemon, and
+// falls back to fallback when the daemon cannot be reached. The hosts that
+// fallback forwards to another credential helper are always served by
+// fallback.
+type Helper struct {
+	client   *Client
+	fallback credentials.Helper
+}
+
+var _ credentials.Helper = (*Helper)(nil)
+
+// NewHelper returns a Helper for the daemon listening on socket.
+func NewHelper(socket string, fallback credentials.Helper) *Helper {
+	return &Helper{
+		client:   NewClient(socket),
+		fallback: fallback,
+	}
+}
+
+func (h *Helper) Add(creds *credentials.Credentials) error {
+	return h.fallback.Add(creds)
+}
+
+// Delete removes the credentials of serverURL from the daemon's cache as well
+// as from the caches of fallback.
+func (h *Helper) Delete(serverURL string) error {
+	if err := h.fallback.Delete(serverURL); err != nil {
+		return err
+	}
+	if forwarder, ok := h.fallback.(fallbackForwarder); ok && forwarder.ForwardsToFallback(serverURL) {
+		return nil
+	}
+	err := h.client.Delete(serverURL)
+	if errors.Is(err, ErrUnavailable) {
+		logrus.WithError(err).Debug("Credential daemon unavailable, only removed the credentials cached in process")
+		return nil
+	}
+	return err
+}
+
+func (h *Helper) List() (map[string]string, error) {
+	return h.fallback.List()
+}
+
+func (h *Helper) Get(serverURL string) (string, string, error) {
+	if forwarder, ok := h.fallback.(fallbackForwarder); ok && forwarder.ForwardsToFallback(serverURL) {
+		return h.fallback.Get(serverURL)
+	}
+	auth, err := h.client.GetAuth(serverURL)
+	if errors.Is(err, ErrUnavailable) {
+		logrus.WithError(err).Debug("Credential daemon unavailable, getting credentials in process")
+		return h.fallback.Get(serverURL)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return auth.Username, auth.Password, nil
+}
@@ -0,0 +1,204 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/stretchr/testify/assert"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// fakeHelperScript is a docker-credential-fake helper that has credentials
+// for every host.
+const fakeHelperScript = `#!/bin/sh
+read serverURL
+echo "{\"ServerURL\":\"$serverURL\",\"Username\":\"hubuser\",\"Secret\":\"hubsecret\"}"
+`
+
+// fallbackHelper records the calls made by Helper when the daemon is not
+// used.
+type fallbackHelper struct {
+	gets    []string
+	deletes []string
+}
+
+func (f *fallbackHelper) Add(*credentials.Credentials) error { return nil }
+
+func (f *fallbackHelper) Delete(serverURL string) error {
+	f.deletes = append(f.deletes, serverURL)
+	return nil
+}
+
+func (f *fallbackHelper) List() (map[string]string, error) { return nil, nil }
+
+func (f *fallbackHelper) Get(serverURL string) (string, string, error) {
+	f.gets = append(f.gets, serverURL)
+	return "fallback", "fallback-password", nil
+}
+
+func TestHelperFallsBackWithoutDaemon(t *testing.T) {
+	fallback := &fallbackHelper{}
+	helper := NewHelper(testSocket(t), fallback)
+
+	username, password, err := helper.Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", username)
+	assert.Equal(t, "fallback-password", password)
+	assert.Equal(t, []string{testRegistry}, fallback.gets)
+}
+
+func TestHelperUsesDaemon(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, fakeClock), socket)
+
+	fallback := &fallbackHelper{}
+	helper := NewHelper(socket, fallback)
+
+	username, password, err := helper.Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, testUsername, username)
+	assert.Equal(t, testPassword, password)
+
+	// credentials the daemon cannot find are not looked up again in process
+	_, _, err = helper.Get("registry.example.com")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+	assert.Empty(t, fallback.gets)
+}
+
+func TestHelperReturnsDaemonErrors(t *testing.T) {
+	fake := newFakeECR()
+	fake.err = errors.New("access denied")
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, clock.NewFake(testNow), WithHelperOptions(ecr.WithDescriptiveErrors(true))), socket)
+
+	fallback := &fallbackHelper{}
+	_, _, err := NewHelper(socket, fallback).Get(testRegistry)
+	assert.ErrorContains(t, err, "access denied")
+	assert.NotErrorIs(t, err, ErrUnavailable)
+	assert.Empty(t, fallback.gets, "errors reported by the daemon should not be retried in process")
+}
+
+func TestHelperFallsBackOnOtherEnvironment(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "build")
+	fake := newFakeECR()
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, clock.NewFake(testNow)), socket)
+
+	// a shell with another profile must not get the tokens of the daemon's
+	t.Setenv("AWS_PROFILE", "deploy")
+	_, err := NewClient(socket).GetAuth(testRegistry)
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	fallback := &fallbackHelper{}
+	username, _, err := NewHelper(socket, fallback).Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", username)
+	assert.Equal(t, []string{testRegistry}, fallback.gets)
+	_, fetches := fake.counts(testRegistry)
+	assert.Zero(t, fetches)
+
+	t.Setenv("AWS_PROFILE", "build")
+	username, _, err = NewHelper(socket, fallback).Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, testUsername, username, "callers with the daemon's environment should be served")
+}
+
+func TestHelperDeleteEvictsDaemonCache(t *testing.T) {
+	fake := newFakeECR()
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, clock.NewFake(testNow)), socket)
+
+	fallback := &fallbackHelper{}
+	helper := NewHelper(socket, fallback)
+
+	_, _, err := helper.Get(testRegistry)
+	assert.NoError(t, err)
+	assert.NoError(t, helper.Delete(testRegistry))
+	assert.Equal(t, []string{testRegistry}, fallback.deletes, "the credentials cached in process should be removed too")
+
+	_, _, err = helper.Get(testRegistry)
+	assert.NoError(t, err)
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches, "the daemon should fetch deleted credentials again")
+}
+
+func TestHelperDeleteWithoutDaemon(t *testing.T) {
+	fallback := &fallbackHelper{}
+	assert.NoError(t, NewHelper(testSocket(t), fallback).Delete(testRegistry))
+	assert.Equal(t, []string{testRegistry}, fallback.deletes)
+}
+
+func TestHelperFallsBackOnUnresponsiveDaemon(t *testing.T) {
+	socket := testSocket(t)
+	listener, err := Listen(socket)
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		// accept and hang up without answering
+		conn, err := listener.Accept()
+		if err == nil {
+			time.Sleep(10 * time.Millisecond)
+			conn.Close()
+		}
+	}()
+
+	fallback := &fallbackHelper{}
+	username, _, err := NewHelper(socket, fallback).Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, "fallback", username)
+	assert.Equal(t, []string{testRegistry}, fallback.gets)
+}
+
+func TestHelperForwardsToFallbackHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helper is a shell script")
+	}
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(fakeHelperScript), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, fakeClock), socket)
+
+	inProcess := ecr.NewECRHelper(
+		ecr.WithClientFactory(newFakeECR().factory()),
+		ecr.WithConfig(&config.File{}),
+		ecr.WithFallbackHelper("fake"))
+	helper := NewHelper(socket, inProcess)
+
+	username, password, err := helper.Get("https://index.docker.io/v1/")
+	assert.NoError(t, err, "hosts that are not ECR registries should be forwarded to the fallback helper")
+	assert.Equal(t, "hubuser", username)
+	assert.Equal(t, "hubsecret", password)
+
+	username, _, err = helper.Get(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, testUsername, username)
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 1, fetches, "ECR registries should still be served by the daemon")
+}
@@ -0,0 +1,58 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+)
+
+// callerEnvironment is the AWS environment variables that are only read by
+// the caller of the daemon, and so may differ between the daemon and the
+// processes it serves.
+var callerEnvironment = map[string]bool{
+	"AWS_ECR_DAEMON_SOCKET":        true,
+	"AWS_ECR_FALLBACK_HELPER":      true,
+	"AWS_ECR_IGNORE_CREDS_STORAGE": true,
+	"AWS_ECR_LIST_CONCURRENCY":     true,
+	"AWS_ECR_LIST_REGIONS":         true,
+	"AWS_ECR_LIST_REGISTRY_IDS":    true,
+}
+
+// environmentFingerprint returns a digest of the AWS environment variables
+// of the current process, which tells whether two processes would get the
+// same credentials without revealing the values of the variables. Every
+// AWS_ variable is included, as the helper and the AWS SDK read many of them
+// to select the identity, region, endpoints and caching of the tokens.
+func environmentFingerprint() string {
+	var variables []string
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		// empty variables are ignored by the AWS SDK, as if they were unset
+		if !strings.HasPrefix(name, "AWS_") || callerEnvironment[name] || value == "" {
+			continue
+		}
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+
+	hasher := sha256.New()
+	for _, variable := range variables {
+		hasher.Write([]byte(variable + "\x00"))
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
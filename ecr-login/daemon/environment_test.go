@@ -0,0 +1,71 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironmentFingerprint(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "")
+	empty := environmentFingerprint()
+
+	t.Setenv("AWS_PROFILE", "build")
+	build := environmentFingerprint()
+	assert.NotEqual(t, empty, build)
+	assert.NotContains(t, build, "build", "the values should not be revealed")
+
+	t.Setenv("AWS_PROFILE", "deploy")
+	assert.NotEqual(t, build, environmentFingerprint())
+
+	t.Setenv("AWS_PROFILE", "")
+	assert.Equal(t, empty, environmentFingerprint(), "empty variables should be ignored")
+	t.Setenv("HOME", t.TempDir())
+	assert.Equal(t, empty, environmentFingerprint(), "other variables should be ignored")
+}
+
+func TestEnvironmentFingerprintVariables(t *testing.T) {
+	for _, name := range []string{
+		"AWS_SECRET_ACCESS_KEY",
+		"AWS_SESSION_TOKEN",
+		"AWS_ECR_ENDPOINT_URL",
+		"AWS_ECR_PUBLIC_ENDPOINT_URL",
+		"AWS_ECR_PUBLIC_REGION",
+		"AWS_ECR_CA_BUNDLE",
+		"AWS_ECR_DISABLE_CACHE",
+		"AWS_ECR_TOKEN_MIN_REMAINING",
+		"AWS_ECR_TOKEN_REFRESH_FRACTION",
+		"AWS_ECR_TOKEN_REFRESH_MARGIN",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, "")
+			before := environmentFingerprint()
+			t.Setenv(name, "changed")
+			assert.NotEqual(t, before, environmentFingerprint())
+		})
+	}
+}
+
+func TestEnvironmentFingerprintCallerVariables(t *testing.T) {
+	for name := range callerEnvironment {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, "")
+			before := environmentFingerprint()
+			t.Setenv(name, "changed")
+			assert.Equal(t, before, environmentFingerprint())
+		})
+	}
+}
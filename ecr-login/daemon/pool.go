@@ -0,0 +1,104 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	ecrconfig "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// clientPool is a ClientFactory that keeps the clients it creates for a
+// region, so that the AWS configuration and credentials are only resolved
+// once per region for the lifetime of the daemon. Clients created from an
+// explicit configuration are not pooled, and clients for other endpoints
+// are kept in pools of their own.
+type clientPool struct {
+	factory api.ClientFactory
+
+	mu      sync.Mutex
+	clients map[string]api.Client
+	pools   map[ecrconfig.Endpoints]*clientPool
+}
+
+var _ api.EndpointsClientFactory = (*clientPool)(nil)
+
+func newClientPool(factory api.ClientFactory) *clientPool {
+	return &clientPool{
+		factory: factory,
+		clients: make(map[string]api.Client),
+		pools:   make(map[ecrconfig.Endpoints]*clientPool),
+	}
+}
+
+func (p *clientPool) client(key string, newClient func() (api.Client, error)) (api.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = client
+	return client, nil
+}
+
+func (p *clientPool) NewClient(ctx context.Context, awsConfig aws.Config) (api.Client, error) {
+	return p.factory.NewClient(ctx, awsConfig)
+}
+
+func (p *clientPool) NewClientWithOptions(ctx context.Context, opts api.Options) (api.Client, error) {
+	return p.factory.NewClientWithOptions(ctx, opts)
+}
+
+func (p *clientPool) NewClientFromRegion(ctx context.Context, region string) (api.Client, error) {
+	return p.client("region/"+region, func() (api.Client, error) {
+		return p.factory.NewClientFromRegion(ctx, region)
+	})
+}
+
+func (p *clientPool) NewClientWithFipsEndpoint(ctx context.Context, region string) (api.Client, error) {
+	return p.client("fips/"+region, func() (api.Client, error) {
+		return p.factory.NewClientWithFipsEndpoint(ctx, region)
+	})
+}
+
+func (p *clientPool) NewClientWithDefaults(ctx context.Context) (api.Client, error) {
+	return p.client("defaults", func() (api.Client, error) {
+		return p.factory.NewClientWithDefaults(ctx)
+	})
+}
+
+// WithEndpoints returns the pool of the clients for endpoints, or p if the
+// factory does not support other endpoints.
+func (p *clientPool) WithEndpoints(endpoints ecrconfig.Endpoints) api.ClientFactory {
+	factory, ok := p.factory.(api.EndpointsClientFactory)
+	if !ok {
+		return p
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pool, ok := p.pools[endpoints]
+	if !ok {
+		pool = newClientPool(factory.WithEndpoints(endpoints))
+		p.pools[endpoints] = pool
+	}
+	return pool
+}
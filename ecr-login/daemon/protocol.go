@@ -0,0 +1,54 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package daemon implements a long-running credential daemon that keeps
+// tokens and ECR clients in memory, and the client used by the credential
+// helper to reach it over a Unix socket.
+//
+// Each connection carries a single JSON encoded Request followed by a single
+// JSON encoded Response.
+package daemon
+
+import (
+	"time"
+)
+
+const (
+	// ActionGet requests the credentials of a registry.
+	ActionGet = "get"
+	// ActionDelete removes the cached credentials of a registry.
+	ActionDelete = "delete"
+)
+
+// Request is sent by the client to the daemon. Environment is the
+// fingerprint of the AWS variables of the caller's environment, which must
+// match the daemon's.
+type Request struct {
+	Action      string `json:"action"`
+	ServerURL   string `json:"serverURL,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+// Response is sent by the daemon to the client. Error is set instead of the
+// credentials when the request failed. EnvironmentMismatch is set together
+// with Error when the daemon refused to serve a caller whose environment
+// differs from its own.
+type Response struct {
+	ProxyEndpoint string    `json:"proxyEndpoint,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Secret        string    `json:"secret,omitempty"`
+	ExpiresAt     time.Time `json:"expiresAt,omitempty"`
+	Error         string    `json:"error,omitempty"`
+
+	EnvironmentMismatch bool `json:"environmentMismatch,omitempty"`
+}
@@ -0,0 +1,378 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+)
+
+const (
+	// DefaultRefreshAhead is how long before the end of a token's validity
+	// window the daemon refreshes it.
+	DefaultRefreshAhead = 10 * time.Minute
+	// DefaultRefreshInterval is how often the daemon looks for tokens to
+	// refresh.
+	DefaultRefreshInterval = time.Minute
+
+	// idleTimeout is how long a registry is kept refreshed after it was last
+	// requested.
+	idleTimeout = 24 * time.Hour
+	// requestTimeout bounds the time spent serving a single connection.
+	requestTimeout = time.Minute
+)
+
+// Server serves credentials over a Unix socket from an in-memory cache, and
+// refreshes the cached tokens of recently requested registries before they
+// stop being valid according to its RefreshPolicy. It only serves callers
+// whose AWS environment, such as AWS_PROFILE, matches its own.
+type Server struct {
+	helper          *ecr.ECRHelper
+	cache           cache.CredentialsCache
+	clock           clock.Clock
+	refreshAhead    time.Duration
+	refreshInterval time.Duration
+	refreshPolicy   cache.RefreshPolicy
+	helperOptions   []ecr.Option
+	// environment is the fingerprint of the environment the daemon gets
+	// credentials with, the only one it serves.
+	environment string
+
+	mu         sync.Mutex
+	registries map[string]*trackedRegistry
+}
+
+// trackedRegistry is a registry whose token is kept fresh by the daemon.
+type trackedRegistry struct {
+	serverURL     string
+	service       cache.Service
+	lastRequested time.Time
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithRefreshAhead sets how long before the end of a token's validity window
+// the daemon refreshes it.
+func WithRefreshAhead(refreshAhead time.Duration) Option {
+	return func(s *Server) {
+		s.refreshAhead = refreshAhead
+	}
+}
+
+// WithRefreshInterval sets how often the daemon looks for tokens to refresh.
+func WithRefreshInterval(refreshInterval time.Duration) Option {
+	return func(s *Server) {
+		s.refreshInterval = refreshInterval
+	}
+}
+
+// WithRefreshPolicy sets when cached tokens stop being served, instead of
+// the policy set in the environment.
+func WithRefreshPolicy(policy cache.RefreshPolicy) Option {
+	return func(s *Server) {
+		s.refreshPolicy = policy
+	}
+}
+
+// WithClock sets the clock used to tell when tokens need to be refreshed,
+// instead of the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithHelperOptions sets options of the ECRHelper used to fetch tokens.
+func WithHelperOptions(opts ...ecr.Option) Option {
+	return func(s *Server) {
+		s.helperOptions = append(s.helperOptions, opts...)
+	}
+}
+
+// NewServer returns a Server fetching tokens with clients made by
+// clientFactory. Clients are kept for the lifetime of the server, so the
+// factory should not give them a cache of their own.
+func NewServer(clientFactory api.ClientFactory, opts ...Option) *Server {
+	s := &Server{
+		cache:           cache.NewMemoryCredentialsCache(),
+		clock:           clock.System(),
+		refreshAhead:    DefaultRefreshAhead,
+		refreshInterval: DefaultRefreshInterval,
+		registries:      make(map[string]*trackedRegistry),
+		environment:     environmentFingerprint(),
+	}
+	policy, err := cache.RefreshPolicyFromEnv()
+	if err != nil {
+		logrus.WithError(err).Warning("Ignoring invalid token refresh policy")
+	}
+	s.refreshPolicy = policy
+	for _, o := range opts {
+		o(s)
+	}
+	helperOptions := append(s.helperOptions,
+		ecr.WithClientFactory(newClientPool(clientFactory)),
+		ecr.WithClock(s.clock))
+	s.helper = ecr.NewECRHelper(helperOptions...)
+	return s
+}
+
+// Serve accepts connections on listener until ctx is done, and refreshes
+// cached tokens in the background.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go s.refreshLoop(ctx)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	var request Request
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		logrus.WithError(err).Debug("Could not read daemon request")
+		return
+	}
+
+	if err := json.NewEncoder(conn).Encode(s.respond(request)); err != nil {
+		logrus.WithError(err).Debug("Could not write daemon response")
+	}
+}
+
+// respond serves request.
+func (s *Server) respond(request Request) Response {
+	if request.Environment != s.environment {
+		// the credentials cached by the daemon belong to its own identity
+		return Response{
+			Error:               "caller environment differs from the daemon's",
+			EnvironmentMismatch: true,
+		}
+	}
+
+	var response Response
+	switch request.Action {
+	case ActionGet:
+		auth, err := s.GetAuth(request.ServerURL)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response = Response{
+				ProxyEndpoint: auth.ProxyEndpoint,
+				Username:      auth.Username,
+				Secret:        auth.Password,
+				ExpiresAt:     auth.ExpiresAt,
+			}
+		}
+	case ActionDelete:
+		if err := s.Delete(request.ServerURL); err != nil {
+			response.Error = err.Error()
+		}
+	default:
+		response.Error = fmt.Sprintf("unknown action %q", request.Action)
+	}
+	return response
+}
+
+// GetAuth returns the credentials of serverURL from the in-memory cache,
+// fetching them if they are missing or no longer valid.
+func (s *Server) GetAuth(serverURL string) (*api.Auth, error) {
+	registry, err := s.helper.ResolveRegistry(serverURL)
+	if err != nil {
+		logrus.
+			WithError(err).
+			WithField("serverURL", serverURL).
+			Error("Error parsing the serverURL")
+		return nil, credentials.NewErrCredentialsNotFound()
+	}
+	key := registryHost(serverURL)
+	service := cache.Service(registry.Service)
+	now := s.clock.Now()
+	s.track(key, serverURL, service, now)
+
+	if entry := s.lookup(key, service); entry != nil && s.refreshPolicy.IsValid(entry, now) {
+		return api.AuthFromEntry(entry)
+	}
+	return s.fetch(key, serverURL, service, now)
+}
+
+// Delete removes the credentials of serverURL from the in-memory cache, and
+// stops refreshing them. Hosts that are not registries have nothing to remove.
+func (s *Server) Delete(serverURL string) error {
+	registry, err := s.helper.ResolveRegistry(serverURL)
+	if err != nil {
+		if errors.Is(err, api.ErrUnsupportedHost) {
+			return nil
+		}
+		return err
+	}
+	key := registryHost(serverURL)
+	if registry.Service == api.ServiceECRPublic {
+		s.cache.Delete(cache.PublicRegistry)
+	} else {
+		s.cache.Delete(key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.registries, key)
+	logrus.WithField("registry", key).Debug("Removed cached credentials")
+	return nil
+}
+
+func (s *Server) track(key string, serverURL string, service cache.Service, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registries[key] = &trackedRegistry{
+		serverURL:     serverURL,
+		service:       service,
+		lastRequested: now,
+	}
+}
+
+func (s *Server) lookup(key string, service cache.Service) *cache.AuthEntry {
+	if service == cache.ServiceECRPublic {
+		return s.cache.GetPublic()
+	}
+	return s.cache.Get(key)
+}
+
+func (s *Server) fetch(key string, serverURL string, service cache.Service, now time.Time) (*api.Auth, error) {
+	auth, err := s.helper.GetAuth(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(key, &cache.AuthEntry{
+		AuthorizationToken: base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+		RequestedAt:        now,
+		ExpiresAt:          auth.ExpiresAt,
+		ProxyEndpoint:      auth.ProxyEndpoint,
+		Service:            service,
+	})
+	return auth, nil
+}
+
+func (s *Server) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refresh(s.clock.Now())
+		}
+	}
+}
+
+// refresh fetches new tokens for the registries requested within
+// idleTimeout whose cached token stops being valid within refreshAhead.
+func (s *Server) refresh(now time.Time) {
+	s.mu.Lock()
+	registries := make(map[string]trackedRegistry, len(s.registries))
+	for key, registry := range s.registries {
+		if now.Sub(registry.lastRequested) > idleTimeout {
+			delete(s.registries, key)
+			continue
+		}
+		registries[key] = *registry
+	}
+	s.mu.Unlock()
+
+	for key, registry := range registries {
+		if entry := s.lookup(key, registry.service); entry != nil && s.refreshPolicy.IsValid(entry, now.Add(s.refreshAhead)) {
+			continue
+		}
+		logrus.WithField("registry", key).Debug("Refreshing credentials")
+		if _, err := s.fetch(key, registry.serverURL, registry.service, now); err != nil {
+			logrus.WithError(err).WithField("registry", key).Info("Could not refresh credentials")
+		}
+	}
+}
+
+// registryHost returns the hostname of serverURL, which may omit the scheme
+// and include a path.
+func registryHost(serverURL string) string {
+	parsed, err := url.Parse("https://" + strings.TrimPrefix(serverURL, "https://"))
+	if err != nil {
+		return serverURL
+	}
+	return parsed.Hostname()
+}
+
+// Listen listens on the Unix socket at path, replacing a stale socket left
+// behind by a daemon that is no longer running. The socket is only
+// accessible by the current user.
+func Listen(path string) (net.Listener, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("daemon: already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("daemon: could not remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,357 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package daemon
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/stretchr/testify/assert"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+)
+
+const (
+	testRegistry      = "123456789012.dkr.ecr.us-west-2.amazonaws.com"
+	testOtherRegistry = "210987654321.dkr.ecr.us-west-2.amazonaws.com"
+	testUsername      = "AWS"
+	testPassword      = "password"
+)
+
+var testNow = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakeECR counts the clients created and the tokens fetched for each registry.
+type fakeECR struct {
+	mu      sync.Mutex
+	clients map[string]int
+	fetches map[string]int
+	clock   clock.Clock
+	err     error
+}
+
+func newFakeECR() *fakeECR {
+	return &fakeECR{
+		clients: make(map[string]int),
+		fetches: make(map[string]int),
+		clock:   clock.NewFake(testNow),
+	}
+}
+
+func (f *fakeECR) factory() api.ClientFactory {
+	newClient := func(region string) (api.Client, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.clients[region]++
+		return &mock_api.MockClient{
+			GetCredentialsFn: func(_ context.Context, serverURL string) (*api.Auth, error) {
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				if f.err != nil {
+					return nil, f.err
+				}
+				f.fetches[serverURL]++
+				return &api.Auth{
+					ProxyEndpoint: "https://" + serverURL,
+					Username:      testUsername,
+					Password:      testPassword,
+					ExpiresAt:     f.clock.Now().Add(12 * time.Hour),
+				}, nil
+			},
+			GetCredentialsByRegistryIDFn: func(_ context.Context, registryID string) (*api.Auth, error) {
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				f.fetches[registryID]++
+				return &api.Auth{
+					ProxyEndpoint: "https://" + registryID + ".dkr.ecr." + region + ".amazonaws.com",
+					Username:      testUsername,
+					Password:      testPassword,
+					ExpiresAt:     f.clock.Now().Add(12 * time.Hour),
+				}, nil
+			},
+		}, nil
+	}
+	return mock_api.MockClientFactory{
+		NewClientFromRegionFn: func(_ context.Context, region string) (api.Client, error) {
+			return newClient(region)
+		},
+	}
+}
+
+func (f *fakeECR) counts(serverURL string) (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clients["us-west-2"], f.fetches[serverURL]
+}
+
+// newTestServer returns a Server whose tokens are issued by fake, which is
+// set to use fakeClock.
+func newTestServer(fake *fakeECR, fakeClock *clock.Fake, opts ...Option) *Server {
+	fake.clock = fakeClock
+	opts = append(opts, WithClock(fakeClock), WithHelperOptions(ecr.WithConfig(&config.File{})))
+	return NewServer(fake.factory(), opts...)
+}
+
+func TestServerCachesTokensAndClients(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(fake, fakeClock)
+
+	for i := 0; i < 3; i++ {
+		auth, err := server.GetAuth(testRegistry)
+		assert.NoError(t, err)
+		assert.Equal(t, testUsername, auth.Username)
+		assert.Equal(t, testPassword, auth.Password)
+		assert.Equal(t, "https://"+testRegistry, auth.ProxyEndpoint)
+		assert.Equal(t, testNow.Add(12*time.Hour), auth.ExpiresAt)
+	}
+	_, err := server.GetAuth("https://" + testOtherRegistry + "/v2/")
+	assert.NoError(t, err)
+
+	clients, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 1, clients, "clients should be reused across requests")
+	assert.Equal(t, 1, fetches)
+
+	// tokens are fetched again once they are past their half-life
+	fakeClock.Set(testNow.Add(7 * time.Hour))
+	_, err = server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	_, fetches = fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestServerAlias(t *testing.T) {
+	t.Setenv("AWS_ECR_REGISTRY_ALIASES", "registry.example.com=123456789012:us-west-2")
+	fake := newFakeECR()
+	server := newTestServer(fake, clock.NewFake(testNow))
+
+	for i := 0; i < 2; i++ {
+		auth, err := server.GetAuth("https://registry.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://registry.example.com", auth.ProxyEndpoint)
+	}
+	_, fetches := fake.counts("123456789012")
+	assert.Equal(t, 1, fetches)
+}
+
+func TestServerInvalidRegistry(t *testing.T) {
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(newFakeECR(), fakeClock)
+
+	_, err := server.GetAuth("registry.example.com")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+}
+
+func TestServerFetchError(t *testing.T) {
+	fake := newFakeECR()
+	fake.err = errors.New("access denied")
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(fake, fakeClock)
+
+	_, err := server.GetAuth(testRegistry)
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+}
+
+func TestServerDelete(t *testing.T) {
+	fake := newFakeECR()
+	server := newTestServer(fake, clock.NewFake(testNow))
+
+	_, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Delete("https://"+testRegistry))
+	assert.Empty(t, server.registries, "deleted registries should not be refreshed")
+
+	_, err = server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches, "deleted credentials should be fetched again")
+
+	assert.NoError(t, server.Delete("registry.example.com"))
+}
+
+func TestServerConfiguredEndpoints(t *testing.T) {
+	var requests atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		token := base64.StdEncoding.EncodeToString([]byte(testUsername + ":" + testPassword))
+		fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": %q, "expiresAt": %d, "proxyEndpoint": "https://%s"}]}`,
+			token, testNow.Add(12*time.Hour).Unix(), testRegistry)
+	}))
+	defer stub.Close()
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_ECR_ENDPOINT_URL", "")
+
+	factory := api.DefaultClientFactory{
+		Cache:       cache.NewNullCredentialsCache(),
+		RetryPolicy: api.RetryPolicy{MaxAttempts: 1},
+	}
+	helperConfig := &config.File{Endpoints: config.Endpoints{ECR: stub.URL}}
+	server := NewServer(factory, WithClock(clock.NewFake(testNow)), WithHelperOptions(ecr.WithConfig(helperConfig)))
+
+	auth, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	if assert.NotNil(t, auth) {
+		assert.Equal(t, testPassword, auth.Password)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "the token should be requested from the configured endpoint")
+}
+
+func TestServerRefresh(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(fake, fakeClock)
+
+	_, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+
+	// still valid for longer than the refresh window
+	server.refresh(testNow.Add(5 * time.Hour))
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 1, fetches)
+
+	// refreshed ahead of the half-life, so the next request is served from memory
+	fakeClock.Set(testNow.Add(5*time.Hour + 55*time.Minute))
+	server.refresh(fakeClock.Now())
+	_, fetches = fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches)
+
+	fakeClock.Set(testNow.Add(6*time.Hour + time.Minute))
+	auth, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, testNow.Add(17*time.Hour+55*time.Minute), auth.ExpiresAt)
+	_, fetches = fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestServerRefreshForgetsIdleRegistries(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(fake, fakeClock)
+
+	_, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+
+	server.refresh(testNow.Add(idleTimeout + time.Minute))
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 1, fetches)
+	assert.Empty(t, server.registries)
+}
+
+// testSocket returns a socket path short enough for the limits on Unix
+// socket paths.
+func testSocket(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "ecr")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "daemon.sock")
+}
+
+func serve(t *testing.T, server *Server, socket string) {
+	listener, err := Listen(socket)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestServeOverSocket(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	socket := testSocket(t)
+	serve(t, newTestServer(fake, fakeClock), socket)
+
+	info, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	client := NewClient(socket)
+	auth, err := client.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	assert.Equal(t, testUsername, auth.Username)
+	assert.Equal(t, testPassword, auth.Password)
+	assert.True(t, testNow.Add(12*time.Hour).Equal(auth.ExpiresAt))
+
+	_, err = client.GetAuth("registry.example.com")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+}
+
+func TestListenAlreadyListening(t *testing.T) {
+	socket := testSocket(t)
+	fakeClock := clock.NewFake(testNow)
+	serve(t, newTestServer(newFakeECR(), fakeClock), socket)
+
+	_, err := Listen(socket)
+	assert.Error(t, err)
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	socket := testSocket(t)
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	listener, err = Listen(socket)
+	assert.NoError(t, err)
+	listener.Close()
+}
+
+func TestServerRefreshPolicy(t *testing.T) {
+	fake := newFakeECR()
+	fakeClock := clock.NewFake(testNow)
+	server := newTestServer(fake, fakeClock, WithRefreshPolicy(cache.RefreshPolicy{Margin: time.Hour}))
+
+	_, err := server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+
+	// served from memory past the default half-life
+	fakeClock.Set(testNow.Add(10 * time.Hour))
+	_, err = server.GetAuth(testRegistry)
+	assert.NoError(t, err)
+	_, fetches := fake.counts(testRegistry)
+	assert.Equal(t, 1, fetches)
+
+	server.refresh(testNow.Add(10*time.Hour + 55*time.Minute))
+	_, fetches = fake.counts(testRegistry)
+	assert.Equal(t, 2, fetches)
+}
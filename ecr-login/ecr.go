@@ -18,12 +18,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
 	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	"github.com/docker/docker-credential-helpers/client"
 	"github.com/docker/docker-credential-helpers/credentials"
 )
 
@@ -35,6 +40,16 @@ type ECRHelper struct {
 	ctx context.Context
 	clientFactory api.ClientFactory
 	logger        *logrus.Logger
+	config        *config.File
+	refreshPolicy cache.RefreshPolicy
+	clock         clock.Clock
+	resolver      api.RegistryResolver
+	// descriptiveErrors makes Get return why credentials could not be
+	// retrieved from ECR, instead of reporting them as not found.
+	descriptiveErrors bool
+	// fallback is the credential helper that the requests for hosts that are
+	// not ECR registries are forwarded to, if any.
+	fallback client.ProgramFunc
 }
 
 type Option func(*ECRHelper)
@@ -60,6 +75,55 @@ func WithLogger(w io.Writer) Option {
 	}
 }
 
+// WithConfig sets the helper configuration, instead of reading it from the
+// configuration file.
+func WithConfig(file *config.File) Option {
+	return func(e *ECRHelper) {
+		e.config = file
+	}
+}
+
+// WithRefreshPolicy sets when cached tokens are refreshed, instead of the
+// policy set in the environment. It applies to clients made by the default
+// ClientFactory; custom factories are responsible for their own clients.
+func WithRefreshPolicy(policy cache.RefreshPolicy) Option {
+	return func(e *ECRHelper) {
+		e.refreshPolicy = policy
+	}
+}
+
+// WithClock sets the clock used to tell when tokens were requested and when
+// they need to be refreshed, instead of the system clock. Like
+// WithRefreshPolicy, it applies to clients made by the default ClientFactory.
+func WithClock(c clock.Clock) Option {
+	return func(e *ECRHelper) {
+		e.clock = c
+	}
+}
+
+// WithRegistryResolver sets how server URLs are resolved to registries,
+// instead of api.DefaultRegistryResolver. Use api.ChainRegistryResolver to
+// extend rather than replace the default. Aliases from the configuration file
+// are always resolved first. Like WithRefreshPolicy, it also applies to
+// clients made by the default ClientFactory.
+func WithRegistryResolver(resolver api.RegistryResolver) Option {
+	return func(e *ECRHelper) {
+		e.resolver = resolver
+	}
+}
+
+// WithDescriptiveErrors sets whether Get and GetAuth return descriptive
+// errors for failures to get credentials from ECR, instead of the
+// credentials-not-found error of the credential helper protocol. Hosts that
+// are not ECR registries are always reported as not found, so that Docker can
+// fall back to its other credential stores. It defaults to the
+// AWS_ECR_DESCRIPTIVE_ERRORS env variable.
+func WithDescriptiveErrors(descriptive bool) Option {
+	return func(e *ECRHelper) {
+		e.descriptiveErrors = descriptive
+	}
+}
+
 // WithContext sets the context used for network calls made by the helper.
 func WithContext(ctx context.Context) Option {
 	return func(e *ECRHelper) {
@@ -71,14 +135,33 @@ func WithContext(ctx context.Context) Option {
 // default behavior.
 func NewECRHelper(opts ...Option) *ECRHelper {
 	e := &ECRHelper{
-		ctx:           context.Background(),
-		clientFactory: api.DefaultClientFactory{},
-		logger:        logrus.StandardLogger(),
+		ctx:               context.Background(),
+		clientFactory:     api.DefaultClientFactory{},
+		logger:            logrus.StandardLogger(),
+		descriptiveErrors: os.Getenv("AWS_ECR_DESCRIPTIVE_ERRORS") == "true",
+		fallback:          fallbackProgram(os.Getenv("AWS_ECR_FALLBACK_HELPER")),
 	}
 	for _, o := range opts {
 		o(e)
 	}
 
+	if err := e.refreshPolicy.Validate(); err != nil {
+		e.logger.WithError(err).Warning("Ignoring invalid token refresh policy")
+		e.refreshPolicy = cache.RefreshPolicy{}
+	}
+	if factory, ok := e.clientFactory.(api.DefaultClientFactory); ok {
+		if !e.refreshPolicy.IsZero() {
+			factory.RefreshPolicy = e.refreshPolicy
+		}
+		if e.clock != nil {
+			factory.Clock = e.clock
+		}
+		if e.resolver != nil {
+			factory.Resolver = e.resolver
+		}
+		e.clientFactory = factory
+	}
+
 	return e
 }
 
@@ -90,8 +173,12 @@ func shouldIgnoreCredsStorage() bool {
 }
 
 // Add tries to store credentials when docker requests it. This usually happens during `docker login` calls. In our context,
-// storing arbitrary user given credentials makes no sense.
+// storing arbitrary user given credentials makes no sense. The credentials of hosts that are not ECR registries are
+// stored by the fallback helper, if there is one.
 func (self ECRHelper) Add(creds *credentials.Credentials) error {
+	if self.ForwardsToFallback(creds.ServerURL) {
+		return client.Store(self.fallback, creds)
+	}
 	if shouldIgnoreCredsStorage() {
 		self.logger.
 			WithField("serverURL", creds.ServerURL).
@@ -105,8 +192,21 @@ func (self ECRHelper) Add(creds *credentials.Credentials) error {
 }
 
 // Delete tries to delete credentials when docker requests it. This usually happens during `docker logout` calls. In our context, we
-// don't store arbitrary user given credentials so deleting them makes no sense.
+// don't store arbitrary user given credentials, but the cached token of an ECR registry is removed so that the next
+// request gets a new one. The credentials of hosts that are not ECR registries are deleted by the fallback helper, if
+// there is one.
 func (self ECRHelper) Delete(serverURL string) error {
+	if self.ForwardsToFallback(serverURL) {
+		return client.Erase(self.fallback, serverURL)
+	}
+	err := self.invalidate(serverURL)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, api.ErrUnsupportedHost) {
+		self.logger.WithError(err).WithField("serverURL", serverURL).Error("Error removing cached credentials")
+		return err
+	}
 	if shouldIgnoreCredsStorage() {
 		self.logger.
 			WithField("serverURL", serverURL).
@@ -119,54 +219,205 @@ func (self ECRHelper) Delete(serverURL string) error {
 	}
 }
 
+// Get returns the username and password of serverURL. The credentials of
+// hosts that are not ECR registries are returned by the fallback helper, if
+// there is one.
 func (self ECRHelper) Get(serverURL string) (string, string, error) {
-	registry, err := api.ExtractRegistry(serverURL)
+	if self.ForwardsToFallback(serverURL) {
+		creds, err := client.Get(self.fallback, serverURL)
+		if err != nil {
+			return "", "", err
+		}
+		return creds.Username, creds.Secret, nil
+	}
+	auth, err := self.GetAuth(serverURL)
+	if err != nil {
+		return "", "", err
+	}
+	return auth.Username, auth.Password, nil
+}
+
+// GetAuth behaves like Get, but returns the full set of credentials including
+// the proxy endpoint and the time at which the token expires.
+func (self ECRHelper) GetAuth(serverURL string) (*api.Auth, error) {
+	helperConfig, err := self.loadConfig()
+	if err != nil {
+		self.logger.WithError(err).Error("Error loading configuration")
+		return nil, self.authError(err)
+	}
+
+	registry, err := self.registryResolver(helperConfig).ResolveRegistry(serverURL)
 	if err != nil {
 		self.logger.
 			WithError(err).
 			WithField("serverURL", serverURL).
 			Error("Error parsing the serverURL")
-		return "", "", credentials.NewErrCredentialsNotFound()
+		return nil, self.authError(err)
 	}
 
-	var client api.Client
-	if registry.FIPS {
-		client, err = self.clientFactory.NewClientWithFipsEndpoint(self.ctx, registry.Region)
-	} else {
-		client, err = self.clientFactory.NewClientFromRegion(self.ctx, registry.Region)
-	}
+	client, err := self.newClient(helperConfig, serverURL, registry)
 	if err != nil {
 		self.logger.WithError(err).Error("Error creating ECR client")
-		return "", "", credentials.NewErrCredentialsNotFound()
+		return nil, self.authError(fmt.Errorf("ecr: could not create client: %w", err))
 	}
 
-	auth, err := client.GetCredentials(self.ctx, serverURL)
+	auth, err := self.getCredentials(client, serverURL, registry)
 	if err != nil {
 		self.logger.WithError(err).Error("Error retrieving credentials")
-		return "", "", credentials.NewErrCredentialsNotFound()
+		return nil, self.authError(err)
 	}
-	return auth.Username, auth.Password, nil
+	return auth, nil
 }
 
-func (self ECRHelper) List() (map[string]string, error) {
-	self.logger.Debug("Listing credentials")
-	client, err := self.clientFactory.NewClientWithDefaults(self.ctx)
+// authError returns the error reported to callers of GetAuth for err. Unless
+// descriptive errors are enabled, or for hosts that are not ECR registries,
+// it is the credentials-not-found error of the credential helper protocol.
+func (self ECRHelper) authError(err error) error {
+	if !self.descriptiveErrors || errors.Is(err, api.ErrUnsupportedHost) {
+		return credentials.NewErrCredentialsNotFound()
+	}
+	return err
+}
+
+// ResolveRegistry returns the ECR registry behind serverURL, which is either
+// an alias from the configuration or a registry known to the helper's
+// RegistryResolver.
+func (self ECRHelper) ResolveRegistry(serverURL string) (*api.Registry, error) {
+	helperConfig, err := self.loadConfig()
 	if err != nil {
-		self.logger.WithError(err).Error("Error creating ECR client")
-		return nil, fmt.Errorf("ecr: could not create client: %v", err)
+		return nil, err
+	}
+	return self.registryResolver(helperConfig).ResolveRegistry(serverURL)
+}
+
+func (self ECRHelper) registryResolver(helperConfig *config.File) api.RegistryResolver {
+	return api.ChainRegistryResolver(aliasResolver{helperConfig}, api.ResolverOrDefault(self.resolver))
+}
+
+// aliasResolver resolves the aliases of the helper configuration.
+type aliasResolver struct {
+	config *config.File
+}
+
+func (r aliasResolver) ResolveRegistry(serverURL string) (*api.Registry, error) {
+	host := registryHost(serverURL)
+	alias := r.config.AliasFor(host)
+	if alias == nil {
+		return nil, fmt.Errorf("ecr: %w: %s is not a registry alias", api.ErrUnsupportedHost, host)
+	}
+	return &api.Registry{
+		Service: api.ServiceECR,
+		ID:      alias.RegistryID,
+		FIPS:    alias.FIPS,
+		Region:  alias.Region,
+		Alias:   host,
+	}, nil
+}
+
+// getCredentials gets the credentials of registry. The credentials of an
+// alias are requested by registry ID, and keep the alias as their proxy
+// endpoint so that they match the hostname the client asked for.
+func (self ECRHelper) getCredentials(client api.Client, serverURL string, registry *api.Registry) (*api.Auth, error) {
+	if registry.Alias == "" {
+		return client.GetCredentials(self.ctx, serverURL)
+	}
+	auth, err := client.GetCredentialsByRegistryID(self.ctx, registry.ID)
+	if err != nil {
+		return nil, err
+	}
+	return auth.ForAlias(registry.Alias), nil
+}
+
+// invalidate removes the cached credentials of serverURL.
+func (self ECRHelper) invalidate(serverURL string) error {
+	client, registry, err := self.RegistryClient(serverURL)
+	if err != nil {
+		return err
 	}
+	invalidator, ok := client.(api.CredentialsInvalidator)
+	if !ok {
+		return fmt.Errorf("ecr: cannot remove the cached credentials of %s", serverURL)
+	}
+	invalidator.InvalidateCredentials(registry)
+	self.logger.WithField("serverURL", serverURL).Info("Removed cached credentials")
+	return nil
+}
 
-	auths, err := client.ListCredentials(self.ctx)
+// RegistryClient returns the registry behind serverURL together with a client
+// for it, made the same way as the clients used by GetAuth. It is meant for
+// callers that need more than the credentials of serverURL.
+func (self ECRHelper) RegistryClient(serverURL string) (api.Client, *api.Registry, error) {
+	helperConfig, err := self.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	registry, err := self.registryResolver(helperConfig).ResolveRegistry(serverURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := self.newClient(helperConfig, serverURL, registry)
 	if err != nil {
-		self.logger.WithError(err).Error("Error listing credentials")
-		return nil, fmt.Errorf("ecr: could not list credentials: %v", err)
+		return nil, nil, fmt.Errorf("ecr: could not create client: %w", err)
+	}
+	return client, registry, nil
+}
+
+// newClient creates a client for registry, using the AWS identity configured
+// for it in the configuration file if there is one.
+func (self ECRHelper) newClient(helperConfig *config.File, serverURL string, registry *api.Registry) (api.Client, error) {
+	registryConfig := helperConfig.RegistryConfigFor(registryHost(serverURL), registry.ID, registry.Region)
+	if registryConfig != nil {
+		self.logger.
+			WithField("registry", registry.ID).
+			WithField("profile", registryConfig.Profile).
+			WithField("roleArn", registryConfig.RoleARN).
+			Debug("Using configured identity")
+		awsConfig, err := api.LoadConfigForRegistry(self.ctx, registry, registryConfig)
+		if err != nil {
+			return nil, err
+		}
+		return self.clientFactory.NewClientWithOptions(self.ctx, api.Options{
+			Config:        awsConfig,
+			CacheIdentity: registryConfig.Identity(),
+			RefreshPolicy: self.refreshPolicy,
+			Clock:         self.clock,
+			Resolver:      self.resolver,
+			Endpoints:     helperConfig.Endpoints,
+		})
 	}
 
-	result := map[string]string{}
+	clientFactory := self.clientFactoryFor(helperConfig)
+	if registry.FIPS {
+		return clientFactory.NewClientWithFipsEndpoint(self.ctx, registry.Region)
+	}
+	return clientFactory.NewClientFromRegion(self.ctx, registry.Region)
+}
+
+// clientFactoryFor returns the client factory used with helperConfig, which
+// applies its endpoints when the factory supports other endpoints.
+func (self ECRHelper) clientFactoryFor(helperConfig *config.File) api.ClientFactory {
+	factory, ok := self.clientFactory.(api.EndpointsClientFactory)
+	if !ok || helperConfig.Endpoints.IsZero() {
+		return self.clientFactory
+	}
+	return factory.WithEndpoints(helperConfig.Endpoints)
+}
 
-	for _, auth := range auths {
-		serverURL := auth.ProxyEndpoint
-		result[serverURL] = auth.Username
+// loadConfig returns the configuration given with WithConfig, or reads it from
+// the configuration file.
+func (self ECRHelper) loadConfig() (*config.File, error) {
+	if self.config != nil {
+		return self.config, nil
+	}
+	return config.LoadFile(config.GetConfigFile())
+}
+
+// registryHost returns the hostname of serverURL, which may omit the scheme
+// and include a path.
+func registryHost(serverURL string) string {
+	parsed, err := url.Parse("https://" + strings.TrimPrefix(serverURL, "https://"))
+	if err != nil {
+		return serverURL
 	}
-	return result, nil
+	return parsed.Hostname()
 }
@@ -15,12 +15,20 @@ package ecr
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/cache"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
 	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
 	"github.com/docker/docker-credential-helpers/credentials"
 	"github.com/stretchr/testify/assert"
@@ -80,6 +88,360 @@ func TestGetSuccess(t *testing.T) {
 	assert.Equal(t, expectedPassword, password)
 }
 
+func TestGetAuthSuccess(t *testing.T) {
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+
+	helper := NewECRHelper(WithClientFactory(factory))
+
+	expiresAt := time.Now().Add(12 * time.Hour)
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) { return client, nil }
+	client.GetCredentialsFn = func(_ context.Context, serverURL string) (*ecr.Auth, error) {
+		return &ecr.Auth{
+			Username:      expectedUsername,
+			Password:      expectedPassword,
+			ProxyEndpoint: proxyEndpointUrl,
+			ExpiresAt:     expiresAt,
+		}, nil
+	}
+
+	auth, err := helper.GetAuth(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUsername, auth.Username)
+	assert.Equal(t, expectedPassword, auth.Password)
+	assert.Equal(t, proxyEndpointUrl, auth.ProxyEndpoint)
+	assert.Equal(t, expiresAt, auth.ExpiresAt)
+}
+
+func TestGetWithConfiguredIdentity(t *testing.T) {
+	sharedConfig := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(sharedConfig, []byte("[profile build]\naws_access_key_id = AKIDBUILD\naws_secret_access_key = SECRET\n"), 0600))
+	t.Setenv("AWS_CONFIG_FILE", sharedConfig)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	testCases := []struct {
+		name             string
+		registryConfig   config.RegistryConfig
+		expectedIdentity string
+	}{{
+		name:           "profile",
+		registryConfig: config.RegistryConfig{RegistryIDs: []string{"123456789012"}, Profile: "build"},
+	}, {
+		name: "role",
+		registryConfig: config.RegistryConfig{
+			Hosts:   []string{"*.dkr.ecr.us-east-1.amazonaws.com"},
+			Profile: "build",
+			RoleARN: "arn:aws:iam::123456789012:role/pull",
+		},
+		expectedIdentity: "arn:aws:iam::123456789012:role/pull||",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &mock_api.MockClientFactory{}
+			client := &mock_api.MockClient{}
+
+			helper := NewECRHelper(
+				WithClientFactory(factory),
+				WithConfig(&config.File{Registries: []config.RegistryConfig{tc.registryConfig}}),
+			)
+
+			factory.NewClientWithOptionsFn = func(_ context.Context, opts ecr.Options) (ecr.Client, error) {
+				assert.Equal(t, region, opts.Config.Region)
+				assert.Equal(t, tc.expectedIdentity, opts.CacheIdentity)
+				return client, nil
+			}
+			client.GetCredentialsFn = func(_ context.Context, _ string) (*ecr.Auth, error) {
+				return &ecr.Auth{
+					Username:      expectedUsername,
+					Password:      expectedPassword,
+					ProxyEndpoint: proxyEndpointUrl,
+				}, nil
+			}
+
+			username, password, err := helper.Get(proxyEndpointUrl)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedUsername, username)
+			assert.Equal(t, expectedPassword, password)
+		})
+	}
+}
+
+func TestGetWithEndpointOverride(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		token := base64.StdEncoding.EncodeToString([]byte(expectedUsername + ":" + expectedPassword))
+		fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": %q, "expiresAt": %d, "proxyEndpoint": %q}]}`,
+			token, time.Now().Add(12*time.Hour).Unix(), proxyEndpointUrl)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENDPOINT")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_CONFIG_FILE", os.DevNull)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_ECR_DISABLE_CACHE", "true")
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("AWS_ECR_ENDPOINT_URL", server.URL)
+		username, password, err := NewECRHelper(WithConfig(&config.File{})).Get(proxyEndpointUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUsername, username)
+		assert.Equal(t, expectedPassword, password)
+	})
+
+	t.Run("config file", func(t *testing.T) {
+		t.Setenv("AWS_ECR_ENDPOINT_URL", "")
+		helper := NewECRHelper(WithConfig(&config.File{Endpoints: config.Endpoints{ECR: server.URL}}))
+		username, password, err := helper.Get(proxyEndpointUrl)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUsername, username)
+		assert.Equal(t, expectedPassword, password)
+	})
+
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetWithoutMatchingConfig(t *testing.T) {
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+
+	helper := NewECRHelper(
+		WithClientFactory(factory),
+		WithConfig(&config.File{Registries: []config.RegistryConfig{{
+			RegistryIDs: []string{"210987654321"},
+			Profile:     "other",
+		}}}),
+	)
+
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) { return client, nil }
+	client.GetCredentialsFn = func(_ context.Context, _ string) (*ecr.Auth, error) {
+		return &ecr.Auth{Username: expectedUsername, Password: expectedPassword}, nil
+	}
+
+	username, _, err := helper.Get(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUsername, username)
+}
+
+func TestGetInvalidConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("registries: {nope"), 0600))
+	t.Setenv("AWS_ECR_CONFIG_FILE", configFile)
+
+	helper := NewECRHelper(WithClientFactory(&mock_api.MockClientFactory{}))
+
+	username, password, err := helper.Get(proxyEndpoint)
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+	assert.Empty(t, username)
+	assert.Empty(t, password)
+}
+
+func TestWithRefreshPolicy(t *testing.T) {
+	policy := cache.RefreshPolicy{Margin: time.Hour}
+
+	helper := NewECRHelper(WithRefreshPolicy(policy))
+	assert.Equal(t, policy, helper.clientFactory.(ecr.DefaultClientFactory).RefreshPolicy)
+
+	// invalid policies are ignored
+	helper = NewECRHelper(WithRefreshPolicy(cache.RefreshPolicy{Fraction: 2}))
+	assert.True(t, helper.refreshPolicy.IsZero())
+	assert.True(t, helper.clientFactory.(ecr.DefaultClientFactory).RefreshPolicy.IsZero())
+}
+
+func TestWithClock(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	helper := NewECRHelper(WithClock(fakeClock))
+	assert.Same(t, fakeClock, helper.clientFactory.(ecr.DefaultClientFactory).Clock)
+
+	helper = NewECRHelper()
+	assert.Nil(t, helper.clientFactory.(ecr.DefaultClientFactory).Clock)
+}
+
+func TestGetWithConfiguredIdentityOptions(t *testing.T) {
+	sharedConfig := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(sharedConfig, []byte("[profile build]\naws_access_key_id = AKIDBUILD\naws_secret_access_key = SECRET\n"), 0600))
+	t.Setenv("AWS_CONFIG_FILE", sharedConfig)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	policy := cache.RefreshPolicy{MinRemaining: 2 * time.Hour}
+	fakeClock := clock.NewFake(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+	helper := NewECRHelper(
+		WithClientFactory(factory),
+		WithConfig(&config.File{Registries: []config.RegistryConfig{{Profile: "build"}}}),
+		WithRefreshPolicy(policy),
+		WithClock(fakeClock),
+	)
+
+	factory.NewClientWithOptionsFn = func(_ context.Context, opts ecr.Options) (ecr.Client, error) {
+		assert.Equal(t, policy, opts.RefreshPolicy)
+		assert.Same(t, fakeClock, opts.Clock)
+		return client, nil
+	}
+	client.GetCredentialsFn = func(_ context.Context, _ string) (*ecr.Auth, error) {
+		return &ecr.Auth{Username: expectedUsername, Password: expectedPassword}, nil
+	}
+
+	username, _, err := helper.Get(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUsername, username)
+}
+
+func TestGetAuthWithAlias(t *testing.T) {
+	unsetEnv(t, "AWS_ECR_REGISTRY_ALIASES")
+
+	testCases := []struct {
+		name  string
+		alias config.RegistryAlias
+	}{{
+		name:  "region",
+		alias: config.RegistryAlias{Host: "registry.example.com", RegistryID: "123456789012", Region: "us-west-2"},
+	}, {
+		name:  "fips",
+		alias: config.RegistryAlias{Host: "registry.example.com", RegistryID: "123456789012", Region: "us-gov-west-1", FIPS: true},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := &mock_api.MockClientFactory{}
+			client := &mock_api.MockClient{}
+
+			helper := NewECRHelper(
+				WithClientFactory(factory),
+				WithConfig(&config.File{Aliases: []config.RegistryAlias{tc.alias}}),
+			)
+
+			var gotRegion string
+			newClient := func(_ context.Context, region string) (ecr.Client, error) {
+				gotRegion = region
+				return client, nil
+			}
+			if tc.alias.FIPS {
+				factory.NewClientWithFipsEndpointFn = newClient
+			} else {
+				factory.NewClientFromRegionFn = newClient
+			}
+			client.GetCredentialsByRegistryIDFn = func(_ context.Context, registryID string) (*ecr.Auth, error) {
+				assert.Equal(t, tc.alias.RegistryID, registryID)
+				return &ecr.Auth{
+					Username:      expectedUsername,
+					Password:      expectedPassword,
+					ProxyEndpoint: "https://123456789012.dkr.ecr." + tc.alias.Region + ".amazonaws.com",
+				}, nil
+			}
+
+			auth, err := helper.GetAuth("https://registry.example.com/v2/")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.alias.Region, gotRegion)
+			assert.Equal(t, "https://registry.example.com", auth.ProxyEndpoint)
+			assert.Equal(t, expectedUsername, auth.Username)
+			assert.Equal(t, expectedPassword, auth.Password)
+		})
+	}
+}
+
+func TestResolveRegistryWithEnvAlias(t *testing.T) {
+	t.Setenv("AWS_ECR_REGISTRY_ALIASES", "registry.example.com=123456789012:us-west-2")
+	helper := NewECRHelper(WithConfig(&config.File{}))
+
+	registry, err := helper.ResolveRegistry("registry.example.com:443")
+	assert.NoError(t, err)
+	assert.Equal(t, &ecr.Registry{
+		Service: ecr.ServiceECR,
+		ID:      "123456789012",
+		Region:  "us-west-2",
+		Alias:   "registry.example.com",
+	}, registry)
+
+	registry, err = helper.ResolveRegistry(proxyEndpointUrl)
+	assert.NoError(t, err)
+	assert.Empty(t, registry.Alias)
+
+	_, err = helper.ResolveRegistry("other.example.com")
+	assert.Error(t, err)
+}
+
+func TestGetWithRegistryResolver(t *testing.T) {
+	unsetEnv(t, "AWS_ECR_REGISTRY_ALIASES")
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+
+	privateEndpoint := "vpce-0123.ecr.example.internal"
+	resolver := ecr.ChainRegistryResolver(
+		ecr.RegistryResolverFunc(func(serverURL string) (*ecr.Registry, error) {
+			if serverURL != privateEndpoint {
+				return nil, fmt.Errorf("%s is not the private endpoint", serverURL)
+			}
+			return &ecr.Registry{Service: ecr.ServiceECR, ID: "123456789012", Region: "eu-central-1"}, nil
+		}),
+		ecr.DefaultRegistryResolver,
+	)
+	helper := NewECRHelper(
+		WithClientFactory(factory),
+		WithConfig(&config.File{}),
+		WithRegistryResolver(resolver),
+	)
+
+	var gotRegions []string
+	factory.NewClientFromRegionFn = func(_ context.Context, region string) (ecr.Client, error) {
+		gotRegions = append(gotRegions, region)
+		return client, nil
+	}
+	client.GetCredentialsFn = func(_ context.Context, _ string) (*ecr.Auth, error) {
+		return &ecr.Auth{Username: expectedUsername, Password: expectedPassword}, nil
+	}
+
+	username, _, err := helper.Get(privateEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUsername, username)
+
+	_, _, err = helper.Get(proxyEndpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eu-central-1", region}, gotRegions)
+
+	_, _, err = helper.Get("other.example.com")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+}
+
+func TestWithRegistryResolver(t *testing.T) {
+	resolver := ecr.ChainRegistryResolver(ecr.DefaultRegistryResolver)
+	helper := NewECRHelper(WithRegistryResolver(resolver))
+	assert.Equal(t, resolver, helper.clientFactory.(ecr.DefaultClientFactory).Resolver)
+}
+
+func TestRegistryClient(t *testing.T) {
+	unsetEnv(t, "AWS_ECR_REGISTRY_ALIASES")
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+	helper := NewECRHelper(WithClientFactory(factory), WithConfig(&config.File{}))
+
+	factory.NewClientFromRegionFn = func(_ context.Context, gotRegion string) (ecr.Client, error) {
+		assert.Equal(t, region, gotRegion)
+		return client, nil
+	}
+	gotClient, registry, err := helper.RegistryClient(proxyEndpointUrl)
+	assert.NoError(t, err)
+	assert.Equal(t, client, gotClient)
+	assert.Equal(t, "123456789012", registry.ID)
+
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) {
+		return nil, errors.New("no credentials")
+	}
+	_, _, err = helper.RegistryClient(proxyEndpointUrl)
+	assert.ErrorContains(t, err, "no credentials")
+
+	_, _, err = helper.RegistryClient("registry.example.com")
+	assert.Error(t, err)
+}
+
 func TestGetError(t *testing.T) {
 	factory := &mock_api.MockClientFactory{}
 	client := &mock_api.MockClient{}
@@ -106,6 +468,33 @@ func TestGetNoMatch(t *testing.T) {
 	assert.Empty(t, password)
 }
 
+func TestGetDescriptiveErrors(t *testing.T) {
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) { return client, nil }
+	client.GetCredentialsFn = func(_ context.Context, serverURL string) (*ecr.Auth, error) {
+		return nil, fmt.Errorf("ecr: Failed to get authorization token: %w: test error", ecr.ErrThrottled)
+	}
+
+	helper := NewECRHelper(WithClientFactory(factory), WithDescriptiveErrors(true))
+
+	_, _, err := helper.Get(proxyEndpoint)
+	assert.ErrorIs(t, err, ecr.ErrThrottled)
+	assert.False(t, credentials.IsErrCredentialsNotFound(err))
+
+	_, _, err = helper.Get("not-ecr-server-url")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err), "hosts that are not ECR registries should still be not found")
+}
+
+func TestDescriptiveErrorsFromEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_DESCRIPTIVE_ERRORS", "true")
+	assert.True(t, NewECRHelper().descriptiveErrors)
+	assert.False(t, NewECRHelper(WithDescriptiveErrors(false)).descriptiveErrors, "options should override the environment")
+
+	t.Setenv("AWS_ECR_DESCRIPTIVE_ERRORS", "")
+	assert.False(t, NewECRHelper().descriptiveErrors)
+}
+
 func TestListSuccess(t *testing.T) {
 	factory := &mock_api.MockClientFactory{}
 	client := &mock_api.MockClient{}
@@ -193,7 +582,7 @@ func TestDeleteIgnored(t *testing.T) {
 	helper := NewECRHelper(WithClientFactory(factory))
 
 	t.Setenv("AWS_ECR_IGNORE_CREDS_STORAGE", "true")
-	err := helper.Delete(proxyEndpoint)
+	err := helper.Delete("registry.example.com")
 
 	assert.Nil(t, err)
 }
@@ -216,13 +605,63 @@ func TestDeleteNotImplemented(t *testing.T) {
 			helper := NewECRHelper(WithClientFactory(factory))
 
 			test.setEnv(tt)
-			err := helper.Delete(proxyEndpoint)
+			err := helper.Delete("registry.example.com")
 
 			assert.Error(tt, err, "not implemented")
 		})
 	}
 }
 
+func TestDeleteInvalidatesCachedCredentials(t *testing.T) {
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+
+	helper := NewECRHelper(WithClientFactory(factory))
+
+	var invalidated *ecr.Registry
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) { return client, nil }
+	client.InvalidateCredentialsFn = func(registry *ecr.Registry) { invalidated = registry }
+
+	t.Setenv("AWS_ECR_IGNORE_CREDS_STORAGE", "false")
+	err := helper.Delete(proxyEndpointUrl)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, invalidated) {
+		assert.Equal(t, "123456789012", invalidated.ID)
+		assert.Equal(t, region, invalidated.Region)
+	}
+}
+
+func TestDeleteClientError(t *testing.T) {
+	factory := &mock_api.MockClientFactory{}
+
+	helper := NewECRHelper(WithClientFactory(factory))
+
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) {
+		return nil, fmt.Errorf("%w: bad profile", ecr.ErrAWSConfig)
+	}
+
+	err := helper.Delete(proxyEndpoint)
+
+	assert.ErrorIs(t, err, ecr.ErrAWSConfig)
+	assert.NotErrorIs(t, err, ecr.ErrAWSCredentials)
+}
+
+func TestGetAuthMissingProfile(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", os.DevNull)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+
+	helper := NewECRHelper(
+		WithClientFactory(&mock_api.MockClientFactory{}),
+		WithConfig(&config.File{Registries: []config.RegistryConfig{{Profile: "missing"}}}),
+		WithDescriptiveErrors(true),
+	)
+
+	_, err := helper.GetAuth(proxyEndpoint)
+	assert.ErrorIs(t, err, ecr.ErrAWSConfig, "a missing profile is a configuration error")
+	assert.NotErrorIs(t, err, ecr.ErrAWSCredentials)
+}
+
 func TestGetPropagatesContext(t *testing.T) {
 	factory := &mock_api.MockClientFactory{}
 	client := &mock_api.MockClient{}
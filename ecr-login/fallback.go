@@ -0,0 +1,85 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/sirupsen/logrus"
+)
+
+// fallbackHelperPrefix starts the name of every credential helper binary.
+const fallbackHelperPrefix = "docker-credential-"
+
+// helperName is the name of this credential helper, which cannot be its own
+// fallback helper.
+const helperName = "ecr-login"
+
+// WithFallbackHelper forwards the requests for hosts that are not ECR
+// registries to another credential helper, such as pass or secretservice,
+// instead of reporting their credentials as not found. name is the suffix of
+// the docker-credential-<name> binary, found in PATH. It defaults to the
+// AWS_ECR_FALLBACK_HELPER env variable.
+func WithFallbackHelper(name string) Option {
+	return func(e *ECRHelper) {
+		e.fallback = fallbackProgram(name)
+	}
+}
+
+// fallbackProgram returns the program of the credential helper called name,
+// or nil if name is empty or names this helper, which would forward the
+// requests to itself.
+func fallbackProgram(name string) client.ProgramFunc {
+	if name == "" {
+		return nil
+	}
+	name = strings.TrimPrefix(name, fallbackHelperPrefix)
+	if strings.TrimSuffix(name, ".exe") == helperName {
+		logrus.WithField("helper", name).Warning("Ignoring fallback helper, which is this credential helper")
+		return nil
+	}
+	return client.NewShellProgramFunc(fallbackHelperPrefix + name)
+}
+
+// ForwardsToFallback reports whether the requests for serverURL are forwarded
+// to the fallback helper, rather than served as those of an ECR registry.
+func (self ECRHelper) ForwardsToFallback(serverURL string) bool {
+	if self.fallback == nil {
+		return false
+	}
+	_, err := self.ResolveRegistry(serverURL)
+	if !errors.Is(err, api.ErrUnsupportedHost) {
+		return false
+	}
+	self.logger.WithField("serverURL", serverURL).Debug("Forwarding request to the fallback helper")
+	return true
+}
+
+// listFallback adds the credentials of the fallback helper to result, without
+// replacing the credentials of ECR registries.
+func (self ECRHelper) listFallback(result map[string]string) error {
+	fallbackResult, err := client.List(self.fallback)
+	if err != nil {
+		return err
+	}
+	for serverURL, username := range fallbackResult {
+		if _, ok := result[serverURL]; !ok {
+			result[serverURL] = username
+		}
+	}
+	return nil
+}
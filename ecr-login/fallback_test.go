@@ -0,0 +1,180 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/docker/docker-credential-helpers/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHelperSource is a credential helper that keeps credentials in the JSON
+// file named by FAKE_CREDENTIAL_STORE.
+const fakeHelperSource = `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func main() {
+	path := os.Getenv("FAKE_CREDENTIAL_STORE")
+	store := map[string]credentials{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &store)
+	}
+	input, _ := io.ReadAll(os.Stdin)
+	serverURL := strings.TrimSpace(string(input))
+
+	switch os.Args[1] {
+	case "get":
+		creds, ok := store[serverURL]
+		if !ok {
+			fmt.Print("credentials not found in native keychain")
+			os.Exit(1)
+		}
+		json.NewEncoder(os.Stdout).Encode(creds)
+		return
+	case "store":
+		var creds credentials
+		json.Unmarshal(input, &creds)
+		store[creds.ServerURL] = creds
+	case "erase":
+		delete(store, serverURL)
+	case "list":
+		list := map[string]string{}
+		for url, creds := range store {
+			list[url] = creds.Username
+		}
+		json.NewEncoder(os.Stdout).Encode(list)
+		return
+	}
+	data, _ := json.Marshal(store)
+	os.WriteFile(path, data, 0600)
+}
+`
+
+// buildFakeHelper builds the docker-credential-fake helper into a directory
+// prepended to PATH, and returns the file it stores credentials in.
+func buildFakeHelper(t *testing.T) string {
+	t.Helper()
+	goBinary, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is needed to build the fake helper")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(source, []byte(fakeHelperSource), 0600))
+	binary := filepath.Join(dir, "docker-credential-fake")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	build := exec.Command(goBinary, "build", "-o", binary, source)
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOFLAGS=")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("could not build the fake helper: %v\n%s", err, output)
+	}
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	store := filepath.Join(dir, "store.json")
+	t.Setenv("FAKE_CREDENTIAL_STORE", store)
+	return store
+}
+
+func TestFallbackHelper(t *testing.T) {
+	buildFakeHelper(t)
+	t.Setenv("AWS_ECR_IGNORE_CREDS_STORAGE", "")
+
+	factory := &mock_api.MockClientFactory{}
+	client := &mock_api.MockClient{}
+	factory.NewClientFromRegionFn = func(_ context.Context, _ string) (ecr.Client, error) { return client, nil }
+	factory.NewClientWithDefaultsFn = func(_ context.Context) (ecr.Client, error) { return client, nil }
+	client.GetCredentialsFn = func(_ context.Context, _ string) (*ecr.Auth, error) {
+		return &ecr.Auth{Username: expectedUsername, Password: expectedPassword, ProxyEndpoint: proxyEndpointUrl}, nil
+	}
+	client.ListCredentialsFn = func(_ context.Context) ([]*ecr.Auth, error) {
+		return []*ecr.Auth{{Username: expectedUsername, Password: expectedPassword, ProxyEndpoint: proxyEndpointUrl}}, nil
+	}
+	client.InvalidateCredentialsFn = func(_ *ecr.Registry) {}
+
+	helper := NewECRHelper(WithClientFactory(factory), WithConfig(&config.File{}), WithFallbackHelper("fake"))
+	const dockerHub = "https://index.docker.io/v1/"
+
+	_, _, err := helper.Get(dockerHub)
+	assert.True(t, credentials.IsErrCredentialsNotFound(err), "not found should be reported as is: %v", err)
+
+	assert.NoError(t, helper.Add(&credentials.Credentials{ServerURL: dockerHub, Username: "hubuser", Secret: "hubsecret"}))
+	username, password, err := helper.Get(dockerHub)
+	assert.NoError(t, err)
+	assert.Equal(t, "hubuser", username)
+	assert.Equal(t, "hubsecret", password)
+
+	username, password, err = helper.Get(proxyEndpointUrl)
+	assert.NoError(t, err, "ECR registries should not be forwarded")
+	assert.Equal(t, expectedUsername, username)
+	assert.Equal(t, expectedPassword, password)
+	assert.ErrorIs(t, helper.Add(&credentials.Credentials{ServerURL: proxyEndpointUrl, Username: "AWS", Secret: "token"}), notImplemented)
+
+	serverList, err := helper.List()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{proxyEndpointUrl: expectedUsername, dockerHub: "hubuser"}, serverList)
+
+	assert.NoError(t, helper.Delete(dockerHub))
+	_, _, err = helper.Get(dockerHub)
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+	assert.NoError(t, helper.Delete(proxyEndpointUrl), "ECR registries should not be forwarded")
+}
+
+func TestFallbackHelperFromEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_FALLBACK_HELPER", "pass")
+	assert.NotNil(t, NewECRHelper().fallback)
+	assert.Nil(t, NewECRHelper(WithFallbackHelper("")).fallback, "options should override the environment")
+
+	t.Setenv("AWS_ECR_FALLBACK_HELPER", "")
+	assert.Nil(t, NewECRHelper().fallback)
+}
+
+func TestFallbackHelperIsNotItself(t *testing.T) {
+	for _, name := range []string{"ecr-login", "docker-credential-ecr-login", "ecr-login.exe"} {
+		assert.Nil(t, NewECRHelper(WithFallbackHelper(name)).fallback, name)
+	}
+	t.Setenv("AWS_ECR_FALLBACK_HELPER", "ecr-login")
+	assert.Nil(t, NewECRHelper().fallback)
+}
+
+func TestWithoutFallbackHelper(t *testing.T) {
+	t.Setenv("AWS_ECR_FALLBACK_HELPER", "")
+	helper := NewECRHelper(WithConfig(&config.File{}))
+	_, _, err := helper.Get("https://index.docker.io/v1/")
+	assert.True(t, credentials.IsErrCredentialsNotFound(err))
+}
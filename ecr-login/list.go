@@ -0,0 +1,274 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// List returns the usernames of the registries the helper has credentials
+// for, by proxy endpoint. It lists the registries selected in the
+// configuration, or the default registry of the default region together with
+// the cached credentials if none are selected, and the credentials of the
+// fallback helper if there is one.
+func (self ECRHelper) List() (map[string]string, error) {
+	self.logger.Debug("Listing credentials")
+	result, err := self.listECR()
+	if self.fallback == nil {
+		return result, err
+	}
+	if err != nil {
+		self.logger.WithError(err).Warning("Listing the credentials of the fallback helper only")
+		result = map[string]string{}
+	}
+	if fallbackErr := self.listFallback(result); fallbackErr != nil {
+		self.logger.WithError(fallbackErr).Warning("Could not list the credentials of the fallback helper")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// listECR lists the credentials of ECR registries.
+func (self ECRHelper) listECR() (map[string]string, error) {
+	helperConfig, err := self.loadConfig()
+	if err != nil {
+		self.logger.WithError(err).Error("Error loading configuration")
+		return nil, fmt.Errorf("ecr: could not load configuration: %w", err)
+	}
+	list, err := helperConfig.ListFor()
+	if err != nil {
+		self.logger.WithError(err).Error("Error loading the registries to list")
+		return nil, fmt.Errorf("ecr: could not load the registries to list: %w", err)
+	}
+	if len(list.Regions) == 0 {
+		return self.listDefault()
+	}
+	return self.listRegistries(helperConfig, list)
+}
+
+// listDefault lists the default registry of the default region, and the
+// registries of the cached credentials.
+func (self ECRHelper) listDefault() (map[string]string, error) {
+	client, err := self.clientFactory.NewClientWithDefaults(self.ctx)
+	if err != nil {
+		self.logger.WithError(err).Error("Error creating ECR client")
+		return nil, fmt.Errorf("ecr: could not create client: %v", err)
+	}
+
+	auths, err := client.ListCredentials(self.ctx)
+	if err != nil {
+		self.logger.WithError(err).Error("Error listing credentials")
+		return nil, fmt.Errorf("ecr: could not list credentials: %v", err)
+	}
+
+	result := map[string]string{}
+
+	for _, auth := range auths {
+		serverURL := auth.ProxyEndpoint
+		result[serverURL] = auth.Username
+	}
+	return result, nil
+}
+
+// listTarget is the registries selected for listing in a region. No
+// registry IDs selects the default registry of the region.
+type listTarget struct {
+	region      string
+	registryIDs []string
+}
+
+// listRegistries gets the credentials of the registries selected by list,
+// with the regions in parallel. Registries whose credentials cannot be
+// retrieved are logged and left out, unless none can be retrieved.
+func (self ECRHelper) listRegistries(helperConfig *config.File, list config.List) (map[string]string, error) {
+	clients := newRegistryClients(self, helperConfig)
+	var (
+		mu     sync.Mutex
+		errs   []error
+		result = map[string]string{}
+	)
+	forEachTarget(listTargets(list), list.Concurrency, func(_ int, target listTarget) {
+		credentials := clients.getCredentials(target)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, registry := range credentials {
+			if registry.Err != nil {
+				self.logger.
+					WithError(registry.Err).
+					WithField("region", target.region).
+					WithField("registry", registry.RegistryID).
+					Warning("Could not list credentials")
+				errs = append(errs, registry.Err)
+				continue
+			}
+			result[registry.Auth.ProxyEndpoint] = registry.Auth.Username
+		}
+	})
+
+	if len(result) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("ecr: could not list credentials: %w", errors.Join(errs...))
+	}
+	return result, nil
+}
+
+// listTargets returns the registries selected by list, by region.
+func listTargets(list config.List) []listTarget {
+	targets := make([]listTarget, 0, len(list.Regions))
+	for _, region := range list.Regions {
+		targets = append(targets, listTarget{region: region, registryIDs: list.RegistryIDs})
+	}
+	return targets
+}
+
+// forEachTarget calls fn for each of targets and its index in parallel, with
+// at most concurrency calls at once, and waits for them to return.
+func forEachTarget(targets []listTarget, concurrency int, fn func(int, listTarget)) {
+	if concurrency == 0 {
+		concurrency = config.DefaultListConcurrency
+	}
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, concurrency)
+	)
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			fn(i, target)
+		}()
+	}
+	wg.Wait()
+}
+
+// registryClients makes the clients of the listed registries the same way
+// as GetAuth, with the identity configured for them in the configuration
+// file. Registries of a region that share an identity share a client.
+type registryClients struct {
+	helper       ECRHelper
+	helperConfig *config.File
+
+	mu      sync.Mutex
+	clients map[registryClientKey]*registryClient
+}
+
+type registryClientKey struct {
+	region string
+	// registryConfig is nil for the registries without a configured identity.
+	registryConfig *config.RegistryConfig
+}
+
+type registryClient struct {
+	once   sync.Once
+	client api.Client
+	err    error
+}
+
+func newRegistryClients(helper ECRHelper, helperConfig *config.File) *registryClients {
+	return &registryClients{
+		helper:       helper,
+		helperConfig: helperConfig,
+		clients:      map[registryClientKey]*registryClient{},
+	}
+}
+
+// client returns the client of registryID in region, creating it on first
+// use.
+func (c *registryClients) client(key registryClientKey, registryID string) (api.Client, error) {
+	c.mu.Lock()
+	entry, ok := c.clients[key]
+	if !ok {
+		entry = &registryClient{}
+		c.clients[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		registry := &api.Registry{Service: api.ServiceECR, ID: registryID, Region: key.region}
+		entry.client, entry.err = c.helper.newClient(c.helperConfig, listedRegistryHost(registryID, key.region), registry)
+	})
+	return entry.client, entry.err
+}
+
+// getCredentials returns the credentials of the registries of target, with
+// the registry IDs of the region that share a client requested together.
+func (c *registryClients) getCredentials(target listTarget) []api.RegistryCredentials {
+	registryIDs := target.registryIDs
+	if len(registryIDs) == 0 {
+		registryIDs = []string{""}
+	}
+
+	var keys []registryClientKey
+	groups := map[registryClientKey][]string{}
+	for _, registryID := range registryIDs {
+		key := registryClientKey{
+			region:         target.region,
+			registryConfig: c.helperConfig.RegistryConfigFor(listedRegistryHost(registryID, target.region), registryID, target.region),
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], registryID)
+	}
+
+	byID := make(map[string]api.RegistryCredentials, len(registryIDs))
+	for _, key := range keys {
+		for _, registry := range c.getGroupCredentials(key, groups[key]) {
+			byID[registry.RegistryID] = registry
+		}
+	}
+	credentials := make([]api.RegistryCredentials, len(registryIDs))
+	for i, registryID := range registryIDs {
+		credentials[i] = byID[registryID]
+	}
+	return credentials
+}
+
+func (c *registryClients) getGroupCredentials(key registryClientKey, registryIDs []string) []api.RegistryCredentials {
+	client, err := c.client(key, registryIDs[0])
+	if err != nil {
+		err = fmt.Errorf("ecr: could not create client for %s: %w", key.region, err)
+		credentials := make([]api.RegistryCredentials, len(registryIDs))
+		for i, registryID := range registryIDs {
+			credentials[i] = api.RegistryCredentials{RegistryID: registryID, Err: err}
+		}
+		return credentials
+	}
+	// the errors are reported by registry in the credentials
+	credentials, _ := client.GetCredentialsByRegistryIDs(c.helper.ctx, registryIDs)
+	return credentials
+}
+
+// listedRegistryHost returns the hostname of registryID in region, which is
+// matched against the hosts of the configured identities. The default
+// registry of a region has no known hostname.
+func listedRegistryHost(registryID string, region string) string {
+	if registryID == "" {
+		return ""
+	}
+	host := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", registryID, region)
+	if strings.HasPrefix(region, "cn-") {
+		host += ".cn"
+	}
+	return host
+}
@@ -0,0 +1,187 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// listTestFactory returns a factory of clients whose registries are named
+// after their region. The default registry of a region is 000000000000.
+func listTestFactory(getCredentials func(region string, registryID string) error) (*mock_api.MockClientFactory, *sync.Map) {
+	var clientsMade sync.Map
+	factory := &mock_api.MockClientFactory{}
+	factory.NewClientFromRegionFn = func(_ context.Context, region string) (ecr.Client, error) {
+		count, _ := clientsMade.LoadOrStore(region, new(atomic.Int32))
+		count.(*atomic.Int32).Add(1)
+		client := &mock_api.MockClient{}
+		client.GetCredentialsByRegistryIDFn = func(_ context.Context, registryID string) (*ecr.Auth, error) {
+			if err := getCredentials(region, registryID); err != nil {
+				return nil, err
+			}
+			if registryID == "" {
+				registryID = "000000000000"
+			}
+			return &ecr.Auth{
+				Username:      expectedUsername,
+				Password:      expectedPassword,
+				ProxyEndpoint: fmt.Sprintf("https://%s.dkr.ecr.%s.amazonaws.com", registryID, region),
+			}, nil
+		}
+		client.GetCredentialsByRegistryIDsFn = func(ctx context.Context, registryIDs []string) ([]ecr.RegistryCredentials, error) {
+			credentials := make([]ecr.RegistryCredentials, len(registryIDs))
+			var errs []error
+			for i, registryID := range registryIDs {
+				auth, err := client.GetCredentialsByRegistryID(ctx, registryID)
+				credentials[i] = ecr.RegistryCredentials{RegistryID: registryID, Auth: auth, Err: err}
+				errs = append(errs, err)
+			}
+			return credentials, errors.Join(errs...)
+		}
+		return client, nil
+	}
+	return factory, &clientsMade
+}
+
+func TestListRegistries(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	factory, clientsMade := listTestFactory(func(region string, registryID string) error {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			previous := maxInFlight.Load()
+			if current <= previous || maxInFlight.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if region == "us-west-2" && registryID == "222222222222" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+	var logs bytes.Buffer
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&logs), WithConfig(&config.File{List: config.List{
+		Regions:     []string{"us-east-1", "us-west-2"},
+		RegistryIDs: []string{"111111111111", "222222222222"},
+		Concurrency: 2,
+	}}))
+
+	serverList, err := helper.List()
+	assert.NoError(t, err, "partial failures should be tolerated")
+	assert.Equal(t, map[string]string{
+		"https://111111111111.dkr.ecr.us-east-1.amazonaws.com": expectedUsername,
+		"https://222222222222.dkr.ecr.us-east-1.amazonaws.com": expectedUsername,
+		"https://111111111111.dkr.ecr.us-west-2.amazonaws.com": expectedUsername,
+	}, serverList)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2), "at most Concurrency regions should be listed at once")
+	assert.Contains(t, logs.String(), "access denied")
+
+	for _, region := range []string{"us-east-1", "us-west-2"} {
+		count, ok := clientsMade.Load(region)
+		if assert.True(t, ok) {
+			assert.Equal(t, int32(1), count.(*atomic.Int32).Load(), "one client should be made per region")
+		}
+	}
+}
+
+func TestListRegistriesFailure(t *testing.T) {
+	factory, _ := listTestFactory(func(region string, registryID string) error {
+		return fmt.Errorf("%s unavailable", region)
+	})
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{List: config.List{
+		Regions: []string{"us-east-1", "us-west-2"},
+	}}))
+
+	serverList, err := helper.List()
+	assert.ErrorContains(t, err, "us-east-1 unavailable")
+	assert.ErrorContains(t, err, "us-west-2 unavailable")
+	assert.Empty(t, serverList)
+}
+
+func TestListRegistriesFromEnv(t *testing.T) {
+	t.Setenv("AWS_ECR_LIST_REGIONS", "eu-west-1, eu-central-1")
+	t.Setenv("AWS_ECR_LIST_REGISTRY_IDS", "")
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "")
+	factory, _ := listTestFactory(func(string, string) error { return nil })
+	helper := NewECRHelper(WithClientFactory(factory), WithConfig(&config.File{}))
+
+	serverList, err := helper.List()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"https://000000000000.dkr.ecr.eu-west-1.amazonaws.com":    expectedUsername,
+		"https://000000000000.dkr.ecr.eu-central-1.amazonaws.com": expectedUsername,
+	}, serverList, "the default registry of each region should be listed")
+}
+
+func TestListRegistriesWithConfiguredIdentity(t *testing.T) {
+	sharedConfig := filepath.Join(t.TempDir(), "config")
+	assert.NoError(t, os.WriteFile(sharedConfig, []byte("[profile build]\naws_access_key_id = AKIDBUILD\naws_secret_access_key = SECRET\n"), 0600))
+	t.Setenv("AWS_CONFIG_FILE", sharedConfig)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.DevNull)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	factory, _ := listTestFactory(func(string, string) error { return nil })
+	var requested [][]string
+	factory.NewClientWithOptionsFn = func(_ context.Context, opts ecr.Options) (ecr.Client, error) {
+		assert.Equal(t, "us-west-2", opts.Config.Region)
+		assert.Equal(t, "arn:aws:iam::222222222222:role/pull||", opts.CacheIdentity)
+		client := &mock_api.MockClient{}
+		client.GetCredentialsByRegistryIDsFn = func(_ context.Context, registryIDs []string) ([]ecr.RegistryCredentials, error) {
+			requested = append(requested, registryIDs)
+			credentials := make([]ecr.RegistryCredentials, len(registryIDs))
+			for i, registryID := range registryIDs {
+				credentials[i] = ecr.RegistryCredentials{RegistryID: registryID, Auth: &ecr.Auth{
+					Username:      "role-user",
+					ProxyEndpoint: fmt.Sprintf("https://%s.dkr.ecr.us-west-2.amazonaws.com", registryID),
+				}}
+			}
+			return credentials, nil
+		}
+		return client, nil
+	}
+	helper := NewECRHelper(WithClientFactory(factory), WithConfig(&config.File{
+		List: config.List{
+			Regions:     []string{"us-west-2"},
+			RegistryIDs: []string{"111111111111", "222222222222"},
+		},
+		Registries: []config.RegistryConfig{{
+			RegistryIDs: []string{"222222222222"},
+			Profile:     "build",
+			RoleARN:     "arn:aws:iam::222222222222:role/pull",
+		}},
+	}))
+
+	serverList, err := helper.List()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"https://111111111111.dkr.ecr.us-west-2.amazonaws.com": expectedUsername,
+		"https://222222222222.dkr.ecr.us-west-2.amazonaws.com": "role-user",
+	}, serverList, "registries with a configured identity should use it")
+	assert.Equal(t, [][]string{{"222222222222"}}, requested)
+}
@@ -51,12 +51,15 @@ func (m MockClientFactory) NewClientWithDefaults(ctx context.Context) (api.Clien
 var _ api.ClientFactory = (*MockClientFactory)(nil)
 
 type MockClient struct {
-	GetCredentialsFn             func(ctx context.Context, serverURL string) (*api.Auth, error)
-	GetCredentialsByRegistryIDFn func(ctx context.Context, registryID string) (*api.Auth, error)
-	ListCredentialsFn            func(ctx context.Context) ([]*api.Auth, error)
+	GetCredentialsFn              func(ctx context.Context, serverURL string) (*api.Auth, error)
+	GetCredentialsByRegistryIDFn  func(ctx context.Context, registryID string) (*api.Auth, error)
+	GetCredentialsByRegistryIDsFn func(ctx context.Context, registryIDs []string) ([]api.RegistryCredentials, error)
+	ListCredentialsFn             func(ctx context.Context) ([]*api.Auth, error)
+	InvalidateCredentialsFn       func(registry *api.Registry)
 }
 
 var _ api.Client = (*MockClient)(nil)
+var _ api.CredentialsInvalidator = (*MockClient)(nil)
 
 func (m *MockClient) GetCredentials(ctx context.Context, serverURL string) (*api.Auth, error) {
 	return m.GetCredentialsFn(ctx, serverURL)
@@ -66,6 +69,14 @@ func (m *MockClient) GetCredentialsByRegistryID(ctx context.Context, registryID
 	return m.GetCredentialsByRegistryIDFn(ctx, registryID)
 }
 
+func (m *MockClient) GetCredentialsByRegistryIDs(ctx context.Context, registryIDs []string) ([]api.RegistryCredentials, error) {
+	return m.GetCredentialsByRegistryIDsFn(ctx, registryIDs)
+}
+
 func (m *MockClient) ListCredentials(ctx context.Context) ([]*api.Auth, error) {
 	return m.ListCredentialsFn(ctx)
 }
+
+func (m *MockClient) InvalidateCredentials(registry *api.Registry) {
+	m.InvalidateCredentialsFn(registry)
+}
@@ -0,0 +1,114 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+)
+
+// WarmResult is the outcome of getting the credentials of a registry with
+// Warm.
+type WarmResult struct {
+	Region string
+	// RegistryID is empty for the default registry of Region.
+	RegistryID string
+	Auth       *api.Auth
+	Err        error
+}
+
+// Warm gets the credentials of the registries selected by list, with the
+// regions in parallel and the registries of a region requested together, so
+// that they are cached before they are needed. The regions, registry IDs
+// and concurrency that list leaves unset are taken from the configuration
+// when list selects no regions. It returns the result of every registry, and
+// an error if the credentials of any of them could not be retrieved. Expired
+// tokens returned from the cache are failures too.
+func (self ECRHelper) Warm(list config.List) ([]WarmResult, error) {
+	helperConfig, err := self.loadConfig()
+	if err != nil {
+		self.logger.WithError(err).Error("Error loading configuration")
+		return nil, fmt.Errorf("ecr: could not load configuration: %w", err)
+	}
+	if len(list.Regions) == 0 {
+		configured, err := helperConfig.ListFor()
+		if err != nil {
+			self.logger.WithError(err).Error("Error loading the registries to list")
+			return nil, fmt.Errorf("ecr: could not load the registries to list: %w", err)
+		}
+		list.Regions = configured.Regions
+		if len(list.RegistryIDs) == 0 {
+			list.RegistryIDs = configured.RegistryIDs
+		}
+		if list.Concurrency == 0 {
+			list.Concurrency = configured.Concurrency
+		}
+	}
+	if err := list.Validate(); err != nil {
+		return nil, err
+	}
+	if len(list.Regions) == 0 {
+		return nil, fmt.Errorf("ecr: no regions to warm")
+	}
+
+	targets := listTargets(list)
+	credentials := make([][]api.RegistryCredentials, len(targets))
+	clients := newRegistryClients(self, helperConfig)
+	forEachTarget(targets, list.Concurrency, func(i int, target listTarget) {
+		credentials[i] = clients.getCredentials(target)
+	})
+
+	now := clock.OrSystem(self.clock).Now()
+	var results []WarmResult
+	for i, target := range targets {
+		for _, registry := range credentials[i] {
+			result := WarmResult{Region: target.region, RegistryID: registry.RegistryID, Auth: registry.Auth, Err: registry.Err}
+			// clients fall back to cached tokens when they cannot get new
+			// ones, which does not warm anything if the tokens have expired
+			if result.Err == nil && result.Auth != nil && !result.Auth.ExpiresAt.IsZero() && !result.Auth.ExpiresAt.After(now) {
+				result.Auth = nil
+				result.Err = fmt.Errorf("ecr: could not refresh the token, which expired at %s", registry.Auth.ExpiresAt.Format(time.RFC3339))
+			}
+			results = append(results, result)
+			if result.Err != nil {
+				self.logger.
+					WithError(result.Err).
+					WithField("region", target.region).
+					WithField("registry", registry.RegistryID).
+					Warning("Could not warm credentials")
+			}
+		}
+	}
+
+	var errs []error
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		registry := result.RegistryID
+		if registry == "" {
+			registry = "default registry"
+		}
+		errs = append(errs, fmt.Errorf("%s in %s: %w", registry, result.Region, result.Err))
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("ecr: could not get credentials for %d of %d registries: %w", len(errs), len(results), errors.Join(errs...))
+	}
+	return results, nil
+}
@@ -0,0 +1,133 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ecr "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/clock"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/config"
+	mock_api "github.com/awslabs/amazon-ecr-credential-helper/ecr-login/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarm(t *testing.T) {
+	var calls atomic.Int32
+	factory, _ := listTestFactory(func(region string, registryID string) error {
+		calls.Add(1)
+		if region == "us-west-2" && registryID == "222222222222" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{}))
+
+	results, err := helper.Warm(config.List{
+		Regions:     []string{"us-east-1", "us-west-2"},
+		RegistryIDs: []string{"111111111111", "222222222222"},
+		Concurrency: 2,
+	})
+	assert.ErrorContains(t, err, "could not get credentials for 1 of 4 registries")
+	assert.ErrorContains(t, err, "222222222222 in us-west-2: access denied")
+	assert.Equal(t, int32(4), calls.Load())
+	if assert.Len(t, results, 4) {
+		assert.Equal(t, "https://111111111111.dkr.ecr.us-east-1.amazonaws.com", results[0].Auth.ProxyEndpoint)
+		assert.Equal(t, "https://222222222222.dkr.ecr.us-east-1.amazonaws.com", results[1].Auth.ProxyEndpoint)
+		assert.Equal(t, "https://111111111111.dkr.ecr.us-west-2.amazonaws.com", results[2].Auth.ProxyEndpoint)
+		assert.Equal(t, "us-west-2", results[3].Region)
+		assert.Equal(t, "222222222222", results[3].RegistryID)
+		assert.Error(t, results[3].Err)
+		assert.Nil(t, results[3].Auth)
+	}
+}
+
+func TestWarmConfiguredRegistries(t *testing.T) {
+	factory, _ := listTestFactory(func(string, string) error { return nil })
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{List: config.List{
+		Regions:     []string{"eu-west-1"},
+		RegistryIDs: []string{"111111111111"},
+	}}))
+
+	results, err := helper.Warm(config.List{})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "https://111111111111.dkr.ecr.eu-west-1.amazonaws.com", results[0].Auth.ProxyEndpoint)
+	}
+
+	results, err = helper.Warm(config.List{RegistryIDs: []string{"222222222222"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "https://222222222222.dkr.ecr.eu-west-1.amazonaws.com", results[0].Auth.ProxyEndpoint,
+			"registry IDs should override the configured ones")
+	}
+}
+
+func TestWarmDefaultRegistries(t *testing.T) {
+	factory, _ := listTestFactory(func(string, string) error { return nil })
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{}))
+
+	results, err := helper.Warm(config.List{Regions: []string{"eu-west-1"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Empty(t, results[0].RegistryID)
+		assert.Equal(t, "https://000000000000.dkr.ecr.eu-west-1.amazonaws.com", results[0].Auth.ProxyEndpoint)
+	}
+}
+
+func TestWarmExpiredCachedToken(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	factory := &mock_api.MockClientFactory{}
+	factory.NewClientFromRegionFn = func(_ context.Context, region string) (ecr.Client, error) {
+		return &mock_api.MockClient{
+			GetCredentialsByRegistryIDsFn: func(_ context.Context, registryIDs []string) ([]ecr.RegistryCredentials, error) {
+				// the API is down and the cached tokens are returned instead
+				return []ecr.RegistryCredentials{
+					{RegistryID: registryIDs[0], Auth: &ecr.Auth{ExpiresAt: now.Add(time.Hour)}},
+					{RegistryID: registryIDs[1], Auth: &ecr.Auth{ExpiresAt: now.Add(-time.Hour)}},
+				}, nil
+			},
+		}, nil
+	}
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{}),
+		WithClock(clock.NewFake(now)))
+
+	results, err := helper.Warm(config.List{Regions: []string{"us-east-1"}, RegistryIDs: []string{"111111111111", "222222222222"}})
+	assert.ErrorContains(t, err, "could not get credentials for 1 of 2 registries")
+	assert.ErrorContains(t, err, "222222222222 in us-east-1: ecr: could not refresh the token, which expired at 2024-01-02T02:04:05Z")
+	if assert.Len(t, results, 2) {
+		assert.NoError(t, results[0].Err)
+		assert.Error(t, results[1].Err)
+		assert.Nil(t, results[1].Auth)
+	}
+}
+
+func TestWarmErrors(t *testing.T) {
+	t.Setenv("AWS_ECR_LIST_REGIONS", "")
+	t.Setenv("AWS_ECR_LIST_REGISTRY_IDS", "")
+	t.Setenv("AWS_ECR_LIST_CONCURRENCY", "")
+	factory, _ := listTestFactory(func(string, string) error { return nil })
+	helper := NewECRHelper(WithClientFactory(factory), WithLogger(&bytes.Buffer{}), WithConfig(&config.File{}))
+
+	_, err := helper.Warm(config.List{})
+	assert.ErrorContains(t, err, "no regions")
+
+	_, err = helper.Warm(config.List{Regions: []string{"us-east-1"}, RegistryIDs: []string{"not-an-id"}})
+	assert.ErrorContains(t, err, "invalid registry ID")
+}